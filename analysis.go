@@ -0,0 +1,400 @@
+package pongo2
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AnalysisReference is a single reference to a variable, filter or tag
+// found while analyzing a template.
+type AnalysisReference struct {
+	// Name is the variable path (e. g. "user.profile.name"), the filter
+	// name or the tag name.
+	Name     string
+	Filename string
+	Line     int
+	Column   int
+}
+
+// AnalysisDependency is a reference to another template or file through
+// one of the tags extends, include, import or ssi.
+type AnalysisDependency struct {
+	// Kind is the tag name: "extends", "include", "import" or "ssi".
+	Kind string
+
+	// Name is the resolved filename of the dependency. It is empty
+	// for lazy (variable) filenames which are only known at execution time.
+	Name string
+	Lazy bool
+
+	Filename string
+	Line     int
+	Column   int
+}
+
+// Analysis is the result of a static analysis of a template; see Template.Analyze().
+type Analysis struct {
+	// Variables contains every variable path which is resolved from the
+	// template's context. Variables defined within the template (e. g. by
+	// for, set, with, macro arguments) are not included.
+	Variables []AnalysisReference
+
+	// Filters contains every filter application.
+	Filters []AnalysisReference
+
+	// Tags contains every tag usage (without end tags like endfor).
+	Tags []AnalysisReference
+
+	// Dependencies contains every extends, include, import and ssi usage.
+	Dependencies []AnalysisDependency
+
+	// Blocks and Macros contain the block and macro definitions of the
+	// template (positioned at their names).
+	Blocks []AnalysisReference
+	Macros []AnalysisReference
+}
+
+// VariableNames returns the unique variable paths referenced by the template, sorted.
+func (a *Analysis) VariableNames() []string {
+	return uniqueReferenceNames(a.Variables)
+}
+
+// FilterNames returns the unique filter names used by the template, sorted.
+func (a *Analysis) FilterNames() []string {
+	return uniqueReferenceNames(a.Filters)
+}
+
+// TagNames returns the unique tag names used by the template, sorted.
+func (a *Analysis) TagNames() []string {
+	return uniqueReferenceNames(a.Tags)
+}
+
+func uniqueReferenceNames(refs []AnalysisReference) []string {
+	seen := make(map[string]bool, len(refs))
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if !seen[ref.Name] {
+			seen[ref.Name] = true
+			names = append(names, ref.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Analyze walks the parsed template and reports all referenced variables,
+// filters, tags and dependencies. Dependencies are reported, but not
+// analyzed themselves (use TemplateSet.Analyze() on them if required).
+// Nodes of custom tags are reported as tags, but their content can't be
+// analyzed.
+func (tpl *Template) Analyze() *Analysis {
+	a := &analyzer{
+		tpl:    tpl,
+		result: &Analysis{},
+	}
+	a.push()
+	for _, name := range []string{"pongo2", "forloop", "block", "nil"} {
+		a.define(name)
+	}
+
+	for _, t := range tpl.tagTokens {
+		a.result.Tags = append(a.result.Tags, a.reference(t.Val, t))
+	}
+
+	a.node(tpl.root)
+	return a.result
+}
+
+// Analyze loads the template with the given name using FromCache() and analyzes it.
+func (set *TemplateSet) Analyze(name string) (*Analysis, error) {
+	tpl, err := set.FromCache(name)
+	if err != nil {
+		return nil, err
+	}
+	return tpl.Analyze(), nil
+}
+
+type analyzer struct {
+	tpl    *Template
+	result *Analysis
+	scopes []map[string]bool
+}
+
+func (a *analyzer) push() {
+	a.scopes = append(a.scopes, make(map[string]bool))
+}
+
+func (a *analyzer) pop() {
+	a.scopes = a.scopes[:len(a.scopes)-1]
+}
+
+func (a *analyzer) define(name string) {
+	if name != "" {
+		a.scopes[len(a.scopes)-1][name] = true
+	}
+}
+
+func (a *analyzer) isDefined(name string) bool {
+	for i := len(a.scopes) - 1; i >= 0; i-- {
+		if a.scopes[i][name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *analyzer) reference(name string, t *Token) AnalysisReference {
+	ref := AnalysisReference{
+		Name:     name,
+		Filename: a.tpl.name,
+	}
+	if t != nil {
+		ref.Filename = t.Filename
+		ref.Line = t.Line
+		ref.Column = t.Col
+	}
+	return ref
+}
+
+func (a *analyzer) dependency(kind, name string, lazy bool, t *Token) {
+	ref := a.reference(name, t)
+	a.result.Dependencies = append(a.result.Dependencies, AnalysisDependency{
+		Kind:     kind,
+		Name:     name,
+		Lazy:     lazy,
+		Filename: ref.Filename,
+		Line:     ref.Line,
+		Column:   ref.Column,
+	})
+}
+
+func (a *analyzer) filter(name string, t *Token) {
+	a.result.Filters = append(a.result.Filters, a.reference(name, t))
+}
+
+func (a *analyzer) wrapper(w *NodeWrapper) {
+	if w == nil {
+		return
+	}
+	for _, n := range w.nodes {
+		a.node(n)
+	}
+}
+
+func (a *analyzer) scopedWrapper(w *NodeWrapper, names ...string) {
+	a.push()
+	for _, name := range names {
+		a.define(name)
+	}
+	a.wrapper(w)
+	a.pop()
+}
+
+func (a *analyzer) exprs(exprs ...IEvaluator) {
+	for _, e := range exprs {
+		if e != nil {
+			a.node(e)
+		}
+	}
+}
+
+func (a *analyzer) node(n INode) {
+	switch n := n.(type) {
+	case *nodeDocument:
+		for _, child := range n.Nodes {
+			a.node(child)
+		}
+	case *NodeWrapper:
+		a.wrapper(n)
+	case *nodeVariable:
+		a.node(n.expr)
+	case *nodeFilteredVariable:
+		a.node(n.resolver)
+		for _, f := range n.filterChain {
+			a.filter(f.name, f.token)
+			a.exprs(f.parameter)
+		}
+	case *variableResolver:
+		a.variable(n)
+	case *Expression:
+		a.exprs(n.expr1, n.expr2)
+	case *relationalExpression:
+		a.exprs(n.expr1, n.expr2)
+	case *simpleExpression:
+		a.exprs(n.term1, n.term2)
+	case *namedTerm:
+		a.exprs(n.term)
+	case *term:
+		a.exprs(n.factor1, n.factor2)
+	case *power:
+		a.exprs(n.power1, n.power2)
+
+	case *tagAutoescapeNode:
+		a.wrapper(n.wrapper)
+	case *tagAllowMissingVal:
+		a.wrapper(n.bodyWrapper)
+	case *tagBlockNode:
+		a.result.Blocks = append(a.result.Blocks, a.reference(n.name, n.position))
+		a.wrapper(a.tpl.blocks[n.name])
+	case *tagCycleNode:
+		a.exprs(n.args...)
+		a.define(n.asName)
+	case *tagExecNode:
+		a.wrapper(n.bodyWrapper)
+	case *tagExtendsNode:
+		a.dependency("extends", n.filename, false, n.position)
+	case *tagFilterNode:
+		for _, f := range n.filterChain {
+			a.filter(f.name, f.token)
+			a.exprs(f.paramExpr)
+		}
+		a.wrapper(n.bodyWrapper)
+	case *tagFirstofNode:
+		a.exprs(n.args...)
+	case *tagForNode:
+		a.exprs(n.objectEvaluator)
+		a.scopedWrapper(n.bodyWrapper, n.key, n.value)
+		a.wrapper(n.emptyWrapper)
+	case *tagIfNode:
+		a.exprs(n.conditions...)
+		for _, w := range n.wrappers {
+			a.wrapper(w)
+		}
+	case *tagIfchangedNode:
+		a.exprs(n.watchedExpr...)
+		a.wrapper(n.thenWrapper)
+		a.wrapper(n.elseWrapper)
+	case *tagIfEqualNode:
+		a.exprs(n.var1, n.var2)
+		a.wrapper(n.thenWrapper)
+		a.wrapper(n.elseWrapper)
+	case *tagIfNotEqualNode:
+		a.exprs(n.var1, n.var2)
+		a.wrapper(n.thenWrapper)
+		a.wrapper(n.elseWrapper)
+	case *tagImportNode:
+		a.dependency("import", n.filename, false, n.position)
+		for name := range n.macros {
+			a.define(name)
+		}
+	case *tagIncludeNode:
+		for _, key := range sortedEvaluatorKeys(n.withPairs) {
+			a.exprs(n.withPairs[key])
+		}
+		if n.lazy {
+			a.dependency("include", "", true, n.position)
+			a.exprs(n.filenameEvaluator)
+		} else {
+			a.dependency("include", n.filename, false, n.position)
+		}
+	case *tagIncludeEmptyNode:
+		a.dependency("include", n.filename, false, n.position)
+	case *tagMacroNode:
+		a.result.Macros = append(a.result.Macros, a.reference(n.name, n.nameToken))
+		a.define(n.name)
+		for _, name := range n.argsOrder {
+			a.exprs(n.args[name])
+		}
+		a.scopedWrapper(n.wrapper, n.argsOrder...)
+	case *tagSetNode:
+		a.exprs(n.expression)
+		a.define(n.name)
+	case *tagSpacelessNode:
+		a.wrapper(n.wrapper)
+	case *tagSSINode:
+		if n.lazy {
+			a.dependency("ssi", "", true, n.position)
+			a.exprs(n.filenameEvaluator)
+		} else {
+			a.dependency("ssi", n.filename, false, n.position)
+		}
+	case *tagWidthratioNode:
+		a.exprs(n.current, n.max, n.width)
+		a.define(n.ctxName)
+	case *tagWithNode:
+		names := make([]string, 0, len(n.withPairs))
+		for _, key := range sortedEvaluatorKeys(n.withPairs) {
+			a.exprs(n.withPairs[key])
+			names = append(names, key)
+		}
+		a.scopedWrapper(n.wrapper, names...)
+	}
+}
+
+func sortedEvaluatorKeys(m map[string]IEvaluator) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (a *analyzer) variable(vr *variableResolver) {
+	if len(vr.parts) == 0 {
+		return
+	}
+
+	// In-template array definition ([a, b, c])
+	if vr.parts[0].typ == varTypeArray {
+		for _, part := range vr.parts {
+			a.exprs(part.subscript)
+		}
+		return
+	}
+
+	path := make([]string, 0, len(vr.parts))
+	complete := true
+	for _, part := range vr.parts {
+		if complete {
+			switch part.typ {
+			case varTypeIdent:
+				path = append(path, part.s)
+			case varTypeInt:
+				path = append(path, strconv.Itoa(part.i))
+			case varTypeSubscript:
+				if s, ok := literalSubscript(part.subscript); ok {
+					path = append(path, s)
+				} else {
+					complete = false
+				}
+			default:
+				complete = false
+			}
+			if part.isFunctionCall {
+				complete = false
+			}
+		}
+
+		// Subscripts and function call arguments might reference variables as well
+		if part.typ == varTypeSubscript {
+			a.exprs(part.subscript)
+		}
+		for _, arg := range part.callingArgs {
+			if e, ok := arg.(IEvaluator); ok {
+				a.exprs(e)
+			}
+		}
+	}
+
+	if a.isDefined(vr.parts[0].s) {
+		return
+	}
+	a.result.Variables = append(a.result.Variables, a.reference(strings.Join(path, "."), vr.locationToken))
+}
+
+// literalSubscript returns the subscript as a path element if it's a
+// string or integer literal.
+func literalSubscript(e IEvaluator) (string, bool) {
+	if fv, ok := e.(*nodeFilteredVariable); ok && len(fv.filterChain) == 0 {
+		e = fv.resolver
+	}
+	switch s := e.(type) {
+	case *stringResolver:
+		return s.val, true
+	case *intResolver:
+		return strconv.Itoa(s.val), true
+	}
+	return "", false
+}
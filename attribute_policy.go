@@ -0,0 +1,175 @@
+package pongo2
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// valueFormat is a way values are converted to text by templates, which
+// accesses fields and methods of structs without the template naming them.
+type valueFormat uint8
+
+const (
+	formatString valueFormat = iota // Value.String() (calls the String method)
+	formatFmt                       // the fmt package (the stringformat filter)
+	formatJSON                      // encoding/json (JSON and JavaScript values, the tojson filter)
+)
+
+// Structs nested deeper than this aren't checked by checkFormat (fmt doesn't
+// print them either, encoding/json fails on such cycles).
+const maxFormatDepth = 32
+
+var (
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	formatterType     = reflect.TypeOf((*fmt.Formatter)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// attributeError is the error of an access to the field or method name of
+// type t denied by the AttributePolicy, what describes the access.
+func attributeError(t reflect.Type, name string, isMethod bool, what string) *Error {
+	kind := "field"
+	if isMethod {
+		kind = "method"
+	}
+	return &Error{
+		Sender:    "sandbox:attribute",
+		Kind:      ErrorKindSandbox,
+		OrigError: fmt.Errorf("access to %s '%s' of type %s is not allowed (%s)", kind, name, t, what),
+	}
+}
+
+// checkFormat enforces the set's AttributePolicy (if any) on the fields and
+// methods accessed by converting value to text in the given format: fmt and
+// encoding/json output the fields of structs (and of the structs within
+// them) or call their String, Error, Format, MarshalJSON or MarshalText
+// method, Value.String() calls the String method only.
+func checkFormat(ctx *ExecutionContext, value *Value, format valueFormat) *Error {
+	policy := ctx.template.set.AttributePolicy
+	if policy == nil || !value.val.IsValid() || !value.val.CanInterface() {
+		return nil
+	}
+	if format == formatString {
+		if value.IsNil() {
+			return nil
+		}
+		if _, ok := value.Interface().(fmt.Stringer); ok {
+			t := reflect.TypeOf(value.Interface())
+			if !policy(t, "String", true) {
+				return attributeError(t, "String", true, "printing the value")
+			}
+		}
+		return nil
+	}
+	return checkFormatValue(policy, format, value.val, 0)
+}
+
+// checkContains enforces the set's AttributePolicy (if any) on checking
+// whether a struct has the field named by item (item in container).
+func checkContains(ctx *ExecutionContext, container, item *Value) *Error {
+	policy := ctx.template.set.AttributePolicy
+	if policy == nil || container.getResolvedValue().Kind() != reflect.Struct {
+		return nil
+	}
+	t, name := container.getResolvedValue().Type(), item.String()
+	if policy(t, name, false) {
+		return nil
+	}
+	return attributeError(t, name, false, "checking for the field")
+}
+
+func checkFormatValue(policy AttributePolicy, format valueFormat, v reflect.Value, depth int) *Error {
+	if !v.IsValid() || depth > maxFormatDepth {
+		return nil
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	// Methods of unexported fields can't be called by fmt and encoding/json
+	if v.CanInterface() {
+		if name := formatMethod(v, format); name != "" {
+			if !policy(v.Type(), name, true) {
+				return attributeError(v.Type(), name, true, "formatting the value")
+			}
+			return nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return checkFormatValue(policy, format, v.Elem(), depth+1)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if format == formatJSON && (!field.IsExported() || field.Tag.Get("json") == "-") {
+				// Not encoded
+				continue
+			}
+			if !policy(t, field.Name, false) {
+				return attributeError(t, field.Name, false, "formatting the value")
+			}
+			if err := checkFormatValue(policy, format, v.Field(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := checkFormatValue(policy, format, iter.Key(), depth+1); err != nil {
+				return err
+			}
+			if err := checkFormatValue(policy, format, iter.Value(), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		switch v.Type().Elem().Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+			// Lists of scalars (like []byte) don't need to be checked
+			for i := 0; i < v.Len(); i++ {
+				if err := checkFormatValue(policy, format, v.Index(i), depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// formatMethod returns the name of the method v is formatted with (if any).
+func formatMethod(v reflect.Value, format valueFormat) string {
+	t := v.Type()
+	if format == formatJSON {
+		// encoding/json uses the pointer's methods of addressable values, too
+		implements := func(iface reflect.Type) bool {
+			return t.Implements(iface) || v.CanAddr() && reflect.PtrTo(t).Implements(iface)
+		}
+		switch {
+		case implements(jsonMarshalerType):
+			return "MarshalJSON"
+		case implements(textMarshalerType):
+			return "MarshalText"
+		}
+		return ""
+	}
+	switch {
+	case t.Implements(formatterType):
+		return "Format"
+	case t.Implements(errorType):
+		return "Error"
+	case t.Implements(stringerType):
+		return "String"
+	}
+	return ""
+}
@@ -0,0 +1,13 @@
+module github.com/rudderlabs/pongo2/v6/cmd
+
+go 1.18
+
+require (
+	github.com/rudderlabs/pongo2/v6 v6.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.19.0 // indirect
+
+// The commands are built with the library of the same checkout
+replace github.com/rudderlabs/pongo2/v6 => ../
@@ -0,0 +1,41 @@
+// Command pongo2-lsp is a language server (LSP) for pongo2 templates. It
+// communicates with the editor through stdin/stdout and provides
+//
+//   - diagnostics (all lexer and parser errors) when a template is opened or saved,
+//   - completion of tag and filter names,
+//   - hover documentation for the built-in filters and
+//   - go to definition for blocks, macros and the targets of include,
+//     import, extends and ssi.
+//
+// Templates are loaded from the local filesystem; use -basedir if your
+// application uses a LocalFilesystemLoader with a base directory:
+//
+//	pongo2-lsp -basedir ./templates
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func main() {
+	baseDir := flag.String("basedir", "", "base directory of the templates (like NewLocalFileSystemLoader's baseDir)")
+	flag.Parse()
+
+	// stdout is reserved for the protocol
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("pongo2-lsp: ")
+
+	loader, err := pongo2.NewLocalFileSystemLoader(*baseDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	set := pongo2.NewSet("pongo2-lsp", loader)
+
+	if err := newServer(set, os.Stdout).run(os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+}
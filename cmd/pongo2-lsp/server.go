@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+// server implements the language server. Templates are compiled through
+// set (and therefore through its loader), documents contains the text of
+// all open documents (by URI).
+type server struct {
+	set *pongo2.TemplateSet
+
+	documents map[string]string
+
+	out      io.Writer
+	outMutex sync.Mutex
+}
+
+func newServer(set *pongo2.TemplateSet, out io.Writer) *server {
+	return &server{
+		set:       set,
+		documents: make(map[string]string),
+		out:       out,
+	}
+}
+
+// run processes messages until the client sends "exit" or in is closed.
+func (s *server) run(in io.Reader) error {
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+func (s *server) handle(msg *message) {
+	result, err := s.dispatch(msg.Method, msg.Params)
+	if msg.ID == nil {
+		// Notification, no response
+		return
+	}
+
+	resp := &message{ID: msg.ID}
+	if err != nil {
+		resp.Error = err
+	} else {
+		raw, merr := json.Marshal(result)
+		if merr != nil {
+			resp.Error = &responseError{Code: codeInvalidParams, Message: merr.Error()}
+		} else {
+			resp.Result = raw
+		}
+	}
+	s.send(resp)
+}
+
+func (s *server) send(msg *message) {
+	s.outMutex.Lock()
+	defer s.outMutex.Unlock()
+	_ = writeMessage(s.out, msg)
+}
+
+func (s *server) notify(method string, params any) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.send(&message{Method: method, Params: raw})
+}
+
+func (s *server) dispatch(method string, params json.RawMessage) (any, *responseError) {
+	switch method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    1, // full document
+					"save":      map[string]any{"includeText": false},
+				},
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"|", "%", " "},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "pongo2-lsp"},
+		}, nil
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration":
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.documents[p.TextDocument.URI] = p.TextDocument.Text
+		s.publishDiagnostics(p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.documents[p.TextDocument.URI] = p.ContentChanges[n-1].Text
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		var p didSaveParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.publishDiagnostics(p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didClose":
+		var p didSaveParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.documents, p.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/completion":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(p), nil
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(p), nil
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.definition(p), nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not supported", method)}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// Diagnostics
+
+// publishDiagnostics compiles the saved document (through the set's loader,
+// so relative includes are resolved as they will be in production) and
+// reports all lexer and parser errors.
+func (s *server) publishDiagnostics(uri string) {
+	filename, ok := uriToFilename(uri)
+	if !ok {
+		return
+	}
+	_, errs := s.set.FromFileAll(filename)
+
+	diagnostics := make([]diagnostic, 0, len(errs))
+	for _, err := range errs {
+		diagnostics = append(diagnostics, s.diagnostic(uri, filename, err))
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *server) diagnostic(uri, filename string, err *pongo2.Error) diagnostic {
+	msg := err.OrigError.Error()
+	line, col, endCol := err.Line, err.Column, err.Column+1
+	if snippet, ok := err.Snippet(0); ok {
+		endCol = snippet.EndColumn
+	}
+
+	if err.Filename != filename {
+		// The error belongs to an included/extended/imported template,
+		// report it at the tag referencing it.
+		msg = fmt.Sprintf("%s:%d:%d: %s", err.Filename, err.Line, err.Column, msg)
+		line, col, endCol = 1, 1, 1
+		for _, frame := range err.Stack {
+			if frame.Filename == filename {
+				line, col, endCol = frame.Line, frame.Column, frame.Column+1
+				break
+			}
+		}
+	}
+
+	text := lineAt(s.documents[uri], line-1)
+	return diagnostic{
+		Range: lspRange{
+			Start: position{Line: max0(line - 1), Character: utf16Column(text, max0(col-1))},
+			End:   position{Line: max0(line - 1), Character: utf16Column(text, max0(endCol-1))},
+		},
+		Severity: severityError,
+		Source:   "pongo2",
+		Message:  msg,
+	}
+}
+
+// Completion and hover
+
+var (
+	reTagName    = regexp.MustCompile(`\{%-?\s*(\w*)$`)
+	reFilterName = regexp.MustCompile(`\|\s*(\w*)$`)
+)
+
+func (s *server) completion(p textDocumentPositionParams) []completionItem {
+	text := lineAt(s.documents[p.TextDocument.URI], p.Position.Line)
+	prefix := text[:byteColumn(text, p.Position.Character)]
+
+	items := []completionItem{}
+	if !insideCode(prefix) {
+		return items
+	}
+
+	if m := reTagName.FindStringSubmatch(prefix); m != nil {
+		for _, name := range s.set.TagNames() {
+			if strings.HasPrefix(name, m[1]) {
+				items = append(items, completionItem{Label: name, Kind: completionKindKeyword})
+			}
+		}
+		return items
+	}
+
+	if m := reFilterName.FindStringSubmatch(prefix); m != nil {
+		for _, name := range s.set.FilterNames() {
+			if strings.HasPrefix(name, m[1]) {
+				item := completionItem{Label: name, Kind: completionKindFunction}
+				if doc, ok := pongo2.FilterDoc(name); ok {
+					item.Documentation = &markupContent{Kind: "plaintext", Value: doc}
+				}
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func (s *server) hover(p textDocumentPositionParams) *hover {
+	text := lineAt(s.documents[p.TextDocument.URI], p.Position.Line)
+	start, end := wordAt(text, byteColumn(text, p.Position.Character))
+	if start == end || !insideCode(text[:start]) {
+		return nil
+	}
+	// Filter names are preceded by "|" (or "{% filter ")
+	before := strings.TrimRight(text[:start], " ")
+	if !strings.HasSuffix(before, "|") && !strings.HasSuffix(before, "filter") {
+		return nil
+	}
+	name := text[start:end]
+	doc, ok := pongo2.FilterDoc(name)
+	if !ok {
+		return nil
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: fmt.Sprintf("**%s** (filter)\n\n%s", name, doc)},
+		Range: &lspRange{
+			Start: position{Line: p.Position.Line, Character: utf16Column(text, start)},
+			End:   position{Line: p.Position.Line, Character: utf16Column(text, end)},
+		},
+	}
+}
+
+// Go to definition
+
+var (
+	reQuoted    = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	reBlockName = regexp.MustCompile(`\{%-?\s*(?:end)?block\s+$`)
+)
+
+func (s *server) definition(p textDocumentPositionParams) *location {
+	filename, ok := uriToFilename(p.TextDocument.URI)
+	if !ok {
+		return nil
+	}
+	tpl, err := s.set.FromFile(filename)
+	if err != nil {
+		return nil
+	}
+	analysis := tpl.Analyze()
+
+	text := lineAt(s.documents[p.TextDocument.URI], p.Position.Line)
+	offset := byteColumn(text, p.Position.Character)
+	line := p.Position.Line + 1
+
+	// include/import/extends/ssi targets
+	for _, quoted := range reQuoted.FindAllStringIndex(text, -1) {
+		if offset < quoted[0] || offset >= quoted[1] {
+			continue
+		}
+		var target *pongo2.AnalysisDependency
+		for i, dep := range analysis.Dependencies {
+			if dep.Line == line && !dep.Lazy && dep.Column <= quoted[0] &&
+				(target == nil || dep.Column > target.Column) {
+				target = &analysis.Dependencies[i]
+			}
+		}
+		if target != nil {
+			return fileLocation(target.Name, 1, 1)
+		}
+	}
+
+	start, end := wordAt(text, offset)
+	if start == end {
+		return nil
+	}
+	name := text[start:end]
+
+	// Blocks: the definition within the closest parent template
+	if reBlockName.MatchString(text[:start]) {
+		if ref := s.findInParents(analysis, func(a *pongo2.Analysis) []pongo2.AnalysisReference { return a.Blocks }, name); ref != nil {
+			return fileLocation(refFilename(ref, filename), ref.Line, ref.Column)
+		}
+		return nil
+	}
+
+	// Macros: defined within the template itself or imported
+	for _, ref := range analysis.Macros {
+		if ref.Name == name {
+			return fileLocation(refFilename(&ref, filename), ref.Line, ref.Column)
+		}
+	}
+	for _, dep := range analysis.Dependencies {
+		if dep.Kind != "import" {
+			continue
+		}
+		imported, err := s.set.FromFile(dep.Name)
+		if err != nil {
+			continue
+		}
+		for _, ref := range imported.Analyze().Macros {
+			if ref.Name == name {
+				return fileLocation(refFilename(&ref, dep.Name), ref.Line, ref.Column)
+			}
+		}
+	}
+	return nil
+}
+
+// findInParents looks for a reference called name in the parent templates
+// (following extends), falling back to the template itself.
+func (s *server) findInParents(analysis *pongo2.Analysis, refs func(*pongo2.Analysis) []pongo2.AnalysisReference, name string) *pongo2.AnalysisReference {
+	var own *pongo2.AnalysisReference
+	for _, ref := range refs(analysis) {
+		if ref.Name == name {
+			ref := ref
+			own = &ref
+			break
+		}
+	}
+
+	seen := make(map[string]bool)
+	for current := analysis; current != nil; {
+		var parent *pongo2.Analysis
+		for _, dep := range current.Dependencies {
+			if dep.Kind != "extends" || seen[dep.Name] {
+				continue
+			}
+			seen[dep.Name] = true
+			tpl, err := s.set.FromFile(dep.Name)
+			if err != nil {
+				break
+			}
+			parent = tpl.Analyze()
+			for _, ref := range refs(parent) {
+				if ref.Name == name {
+					ref := ref
+					return &ref
+				}
+			}
+		}
+		current = parent
+	}
+	return own
+}
+
+// Helpers
+
+func refFilename(ref *pongo2.AnalysisReference, fallback string) string {
+	if ref.Filename != "" {
+		return ref.Filename
+	}
+	return fallback
+}
+
+func fileLocation(filename string, line, col int) *location {
+	pos := position{Line: max0(line - 1), Character: max0(col - 1)}
+	return &location{
+		URI:   filenameToURI(filename),
+		Range: lspRange{Start: pos, End: pos},
+	}
+}
+
+func uriToFilename(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+func filenameToURI(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err == nil {
+		filename = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
+
+func lineAt(text string, line int) string {
+	lines := strings.Split(text, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line], "\r")
+}
+
+// insideCode reports whether the end of prefix is within a tag or variable.
+func insideCode(prefix string) bool {
+	open := strings.LastIndex(prefix, "{%")
+	if i := strings.LastIndex(prefix, "{{"); i > open {
+		open = i
+	}
+	if open < 0 {
+		return false
+	}
+	rest := prefix[open:]
+	return !strings.Contains(rest, "%}") && !strings.Contains(rest, "}}")
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// wordAt returns the bounds of the identifier around offset.
+func wordAt(text string, offset int) (start, end int) {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	start, end = offset, offset
+	for start > 0 && isWordChar(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWordChar(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+func max0(i int) int {
+	if i < 0 {
+		return 0
+	}
+	return i
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+type testClient struct {
+	t      *testing.T
+	in     bytes.Buffer
+	nextID int
+}
+
+func (c *testClient) send(method string, params any) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg := &message{Method: method, Params: raw}
+	if !strings.HasPrefix(method, "textDocument/did") {
+		c.nextID++
+		id := json.RawMessage(strings.Repeat("1", c.nextID)) // unique numeric IDs
+		msg.ID = &id
+	}
+	if err := writeMessage(&c.in, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// run processes all sent messages and returns the server's messages.
+func (c *testClient) run() []*message {
+	var out bytes.Buffer
+	set := pongo2.NewSet("test", pongo2.MustNewLocalFileSystemLoader(""))
+	if err := newServer(set, &out).run(&c.in); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var msgs []*message
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func openParams(uri, text string) map[string]any {
+	return map[string]any{"textDocument": map[string]any{"uri": uri, "text": text}}
+}
+
+func positionParams(uri string, line, char int) textDocumentPositionParams {
+	return textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri},
+		Position:     position{Line: line, Character: char},
+	}
+}
+
+func TestServer(t *testing.T) {
+	files := map[string]string{
+		"base.html":   "<title>{% block title %}{% endblock %}</title>",
+		"macros.html": "{% macro greet(name) export %}Hi {{ name }}{% endmacro %}",
+		"page.html": "{% extends \"base.html\" %}\n" +
+			"{% import \"macros.html\" greet %}\n" +
+			"{% block title %}{{ greet(user.name)|upper }}{% endblock %}",
+		"broken.html": "{{ a|unknown }}\n{% if %}{% endif %}",
+	}
+	dir := writeTemplates(t, files)
+	pageURI := filenameToURI(filepath.Join(dir, "page.html"))
+	brokenURI := filenameToURI(filepath.Join(dir, "broken.html"))
+
+	c := &testClient{t: t}
+	c.send("initialize", map[string]any{})
+	c.send("textDocument/didOpen", openParams(pageURI, files["page.html"]))
+	c.send("textDocument/didOpen", openParams(brokenURI, files["broken.html"]))
+	c.send("textDocument/completion", positionParams(pageURI, 2, 41)) // after "|up"
+	c.send("textDocument/hover", positionParams(pageURI, 2, 40))      // on "upper"
+	c.send("textDocument/definition", positionParams(pageURI, 0, 14)) // "base.html"
+	c.send("textDocument/definition", positionParams(pageURI, 2, 10)) // block title
+	c.send("textDocument/definition", positionParams(pageURI, 2, 21)) // greet(...)
+	c.send("shutdown", nil)
+	c.send("exit", nil)
+	msgs := c.run()
+
+	responses := make(map[string]*message)
+	var diagnostics []publishDiagnosticsParams
+	for _, msg := range msgs {
+		if msg.ID != nil {
+			responses[string(*msg.ID)] = msg
+			continue
+		}
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var p publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &p); err != nil {
+				t.Fatal(err)
+			}
+			diagnostics = append(diagnostics, p)
+		}
+	}
+
+	// Diagnostics
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics notifications, got %d", len(diagnostics))
+	}
+	if len(diagnostics[0].Diagnostics) != 0 {
+		t.Errorf("expected page.html to be valid, got %+v", diagnostics[0].Diagnostics)
+	}
+	if d := diagnostics[1].Diagnostics; len(d) != 2 || d[0].Range.Start.Line != 0 || d[1].Range.Start.Line != 1 {
+		t.Errorf("unexpected diagnostics for broken.html: %+v", d)
+	}
+
+	// Completion
+	var items []completionItem
+	mustResult(t, responses["11"], &items)
+	if len(items) != 1 || items[0].Label != "upper" || items[0].Documentation == nil {
+		t.Errorf("unexpected completion: %+v", items)
+	}
+
+	// Hover
+	var h hover
+	mustResult(t, responses["111"], &h)
+	if !strings.Contains(h.Contents.Value, "uppercase") {
+		t.Errorf("unexpected hover: %+v", h)
+	}
+
+	// Definitions
+	var loc location
+	mustResult(t, responses["1111"], &loc)
+	if loc.URI != filenameToURI(filepath.Join(dir, "base.html")) {
+		t.Errorf("extends: unexpected location %+v", loc)
+	}
+	mustResult(t, responses["11111"], &loc)
+	if loc.URI != filenameToURI(filepath.Join(dir, "base.html")) || loc.Range.Start.Character != 16 {
+		t.Errorf("block: unexpected location %+v", loc)
+	}
+	mustResult(t, responses["111111"], &loc)
+	if loc.URI != filenameToURI(filepath.Join(dir, "macros.html")) || loc.Range.Start.Character != 9 {
+		t.Errorf("macro: unexpected location %+v", loc)
+	}
+}
+
+func mustResult(t *testing.T, msg *message, v any) {
+	t.Helper()
+	if msg == nil {
+		t.Fatal("missing response")
+	}
+	if msg.Error != nil {
+		t.Fatalf("unexpected error: %+v", msg.Error)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rudderlabs/pongo2/v6"
+	"gopkg.in/yaml.v3"
+)
+
+// config configures the template set like an application would (options,
+// sandbox and limits). It's read from a YAML or JSON file, e. g.:
+//
+//	trim_blocks: true
+//	undefined: strict
+//	banned_tags: [ssi, exec]
+//	allowed_filters: [escape, safe, upper, lower, default]
+//	limits:
+//	  max_loop_iterations: 10000
+type config struct {
+	TrimBlocks   bool   `yaml:"trim_blocks"`
+	LStripBlocks bool   `yaml:"lstrip_blocks"`
+	Undefined    string `yaml:"undefined"` // default, strict, lenient or chainable
+
+	BannedTags     []string `yaml:"banned_tags"`
+	BannedFilters  []string `yaml:"banned_filters"`
+	AllowedTags    []string `yaml:"allowed_tags"`
+	AllowedFilters []string `yaml:"allowed_filters"`
+
+	Limits struct {
+		MaxOutputBytes     int `yaml:"max_output_bytes"`
+		MaxLoopIterations  int `yaml:"max_loop_iterations"`
+		MaxNodeEvaluations int `yaml:"max_node_evaluations"`
+		MaxExecDepth       int `yaml:"max_exec_depth"`
+	} `yaml:"limits"`
+}
+
+var undefinedPolicies = map[string]pongo2.UndefinedPolicy{
+	"":          pongo2.UndefinedDefault,
+	"default":   pongo2.UndefinedDefault,
+	"strict":    pongo2.UndefinedStrict,
+	"lenient":   pongo2.UndefinedLenient,
+	"chainable": pongo2.UndefinedChainable,
+}
+
+func loadConfig(filename string) (*config, error) {
+	cfg := &config{}
+	if filename == "" {
+		return cfg, nil
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("config %s: %w", filename, err)
+	}
+	if _, has := undefinedPolicies[cfg.Undefined]; !has {
+		return nil, fmt.Errorf("config %s: unknown undefined policy '%s'", filename, cfg.Undefined)
+	}
+	return cfg, nil
+}
+
+// newSet creates the template set used by all commands. Templates are
+// loaded through a LocalFilesystemLoader, so names are resolved exactly
+// like in an application using NewLocalFileSystemLoader(baseDir).
+func newSet(baseDir string, cfg *config) (*pongo2.TemplateSet, error) {
+	loader, err := pongo2.NewLocalFileSystemLoader(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	set := pongo2.NewSet("pongo2", loader)
+
+	set.Options.TrimBlocks = cfg.TrimBlocks
+	set.Options.LStripBlocks = cfg.LStripBlocks
+	set.Options.UndefinedPolicy = undefinedPolicies[cfg.Undefined]
+
+	for _, name := range cfg.BannedTags {
+		if err := set.BanTag(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range cfg.BannedFilters {
+		if err := set.BanFilter(name); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AllowedTags != nil {
+		if err := set.AllowTags(cfg.AllowedTags...); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AllowedFilters != nil {
+		if err := set.AllowFilters(cfg.AllowedFilters...); err != nil {
+			return nil, err
+		}
+	}
+
+	set.Limits = pongo2.Limits{
+		MaxOutputBytes:     cfg.Limits.MaxOutputBytes,
+		MaxLoopIterations:  cfg.Limits.MaxLoopIterations,
+		MaxNodeEvaluations: cfg.Limits.MaxNodeEvaluations,
+		MaxExecDepth:       cfg.Limits.MaxExecDepth,
+	}
+	return set, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func depsCommand(e *env, args []string) int {
+	fs, sf := newFlagSet(e, "deps")
+	extensions := fs.String("ext", defaultExtensions, "comma-separated file extensions of templates in directories")
+	dot := fs.Bool("dot", false, "print the dependency graph in Graphviz dot format")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(sf.configFile)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	set, err := newSet(sf.baseDir, cfg)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	files, err := findTemplates(templatePaths(fs.Args(), sf.baseDir), *extensions)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+
+	if *dot {
+		fmt.Fprintln(e.stdout, "digraph templates {")
+	}
+	exitCode := 0
+	for _, filename := range files {
+		analysis, err := set.Analyze(filename)
+		if err != nil {
+			e.errorf("%v", err)
+			exitCode = 1
+			continue
+		}
+
+		from := displayName(filename)
+		printed := make(map[string]bool)
+		for _, dep := range analysis.Dependencies {
+			to := displayName(dep.Name)
+			if dep.Lazy {
+				to = "(dynamic)"
+			}
+			var line string
+			switch {
+			case *dot && dep.Lazy:
+				line = fmt.Sprintf("\t%s -> %s [label=%s, style=dashed];", strconv.Quote(from), strconv.Quote(to), strconv.Quote(dep.Kind))
+			case *dot:
+				line = fmt.Sprintf("\t%s -> %s [label=%s];", strconv.Quote(from), strconv.Quote(to), strconv.Quote(dep.Kind))
+			default:
+				line = fmt.Sprintf("%s -> %s (%s)", from, to, dep.Kind)
+			}
+			if !printed[line] {
+				printed[line] = true
+				fmt.Fprintln(e.stdout, line)
+			}
+		}
+	}
+	if *dot {
+		fmt.Fprintln(e.stdout, "}")
+	}
+	return exitCode
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func fmtCommand(e *env, args []string) int {
+	fs := flag.NewFlagSet("pongo2 fmt", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	list := fs.Bool("l", false, "list templates whose formatting differs (exit code 1 if there are any)")
+	write := fs.Bool("w", false, "write the result to the template files instead of stdout")
+	extensions := fs.String("ext", defaultExtensions, "comma-separated file extensions of templates in directories")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		if *write {
+			e.errorf("can't use -w on stdin")
+			return 2
+		}
+		src, err := io.ReadAll(e.stdin)
+		if err != nil {
+			e.errorf("%v", err)
+			return 2
+		}
+		out, err := pongo2.Format(src)
+		if err != nil {
+			e.errorf("<stdin>: %v", err)
+			return 1
+		}
+		if *list {
+			if !bytes.Equal(src, out) {
+				fmt.Fprintln(e.stdout, "<stdin>")
+				return 1
+			}
+			return 0
+		}
+		e.stdout.Write(out)
+		return 0
+	}
+
+	files, err := findTemplates(fs.Args(), *extensions)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	exitCode := 0
+	for _, filename := range files {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			e.errorf("%v", err)
+			exitCode = 1
+			continue
+		}
+		out, err := pongo2.Format(src)
+		if err != nil {
+			e.errorf("%s: %v", displayName(filename), err)
+			exitCode = 1
+			continue
+		}
+		changed := !bytes.Equal(src, out)
+		if *list && changed {
+			fmt.Fprintln(e.stdout, displayName(filename))
+			if !*write {
+				exitCode = 1
+			}
+		}
+		if *write {
+			if changed {
+				if err := writeFile(filename, out); err != nil {
+					e.errorf("%v", err)
+					exitCode = 1
+				}
+			}
+		} else if !*list {
+			e.stdout.Write(out)
+		}
+	}
+	return exitCode
+}
+
+// writeFile replaces the content of an existing file, keeping its permissions.
+func writeFile(filename string, content []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, content, info.Mode().Perm())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func genCommand(e *env, args []string) int {
+	fs, sf := newFlagSet(e, "gen")
+	pkg := fs.String("pkg", "templates", "package name of the generated code")
+	output := fs.String("o", "", "file to write the generated code to (default: stdout)")
+	extensions := fs.String("ext", defaultExtensions, "comma-separated file extensions of templates in directories")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if sf.baseDir == "" {
+		e.errorf("gen requires -basedir (template names are relative to it)")
+		return 2
+	}
+
+	cfg, err := loadConfig(sf.configFile)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	set, err := newSet(sf.baseDir, cfg)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	files, err := findTemplates(templatePaths(fs.Args(), sf.baseDir), *extensions)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	baseDir, err := filepath.Abs(sf.baseDir)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	names := make([]string, 0, len(files))
+	for _, filename := range files {
+		name, err := filepath.Rel(baseDir, filename)
+		if err != nil || strings.HasPrefix(name, "..") {
+			e.errorf("%s: template isn't in the base directory", displayName(filename))
+			return 2
+		}
+		names = append(names, filepath.ToSlash(name))
+	}
+
+	src, err := pongo2.GenerateGo(set, *pkg, names)
+	if err != nil {
+		e.errorf("%v", err)
+		return 1
+	}
+	if *output == "" {
+		e.stdout.Write(src)
+		return 0
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		e.errorf("%v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func lintCommand(e *env, args []string) int {
+	fs, sf := newFlagSet(e, "lint")
+	extensions := fs.String("ext", defaultExtensions, "comma-separated file extensions of templates in directories")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(sf.configFile)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	set, err := newSet(sf.baseDir, cfg)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	files, err := findTemplates(templatePaths(fs.Args(), sf.baseDir), *extensions)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+
+	// Errors of included/imported templates are reported by every template
+	// including them, so only print each error once.
+	reported := make(map[string]bool)
+	problems := 0
+	for _, filename := range files {
+		_, errs := set.FromFileAll(filename)
+		for _, err := range errs {
+			msg := formatLintError(filename, err)
+			if reported[msg] {
+				continue
+			}
+			reported[msg] = true
+			problems++
+			fmt.Fprintln(e.stdout, msg)
+		}
+	}
+
+	if problems > 0 {
+		e.errorf("%d problem(s) found in %d template(s)", problems, len(files))
+		return 1
+	}
+	return 0
+}
+
+// formatLintError formats err as "file:line:col: kind: message".
+func formatLintError(filename string, err *pongo2.Error) string {
+	if err.Filename != "" && err.Filename != "<string>" {
+		filename = err.Filename
+	}
+	pos := displayName(filename)
+	if err.Line > 0 {
+		pos += fmt.Sprintf(":%d:%d", err.Line, err.Column)
+	}
+	return fmt.Sprintf("%s: %s: %v", pos, err.Kind, err.OrigError)
+}
@@ -0,0 +1,104 @@
+// Command pongo2 renders, lints, inspects and compiles pongo2 templates
+// without having to write a Go program:
+//
+//	pongo2 render [-basedir dir] [-config file] [-context file] template
+//	pongo2 lint   [-basedir dir] [-config file] [-ext .html,.tpl] [path ...]
+//	pongo2 deps   [-basedir dir] [-config file] [-ext .html,.tpl] [-dot] [path ...]
+//	pongo2 fmt    [-l] [-w] [-ext .html,.tpl] [path ...]
+//	pongo2 gen    -basedir dir [-config file] [-ext .html,.tpl] [-pkg name] [-o file] [path ...]
+//
+// render executes a template (use "-" to read it from stdin) with a context
+// read from a JSON or YAML file (use "-" for stdin).
+//
+// lint reports all lexer and parser errors of the templates found in the
+// given files and directories, including unknown tags and filters and
+// tags/filters which are banned or not allowed by the config file.
+//
+// deps prints the extends, include, import and ssi dependencies of the
+// templates, optionally as Graphviz dot graph.
+//
+// fmt formats templates (see pongo2.Format) like gofmt: it prints the
+// formatted templates (or stdin if no path is given), lists the templates
+// whose formatting differs (-l, e. g. for CI checks) or rewrites them (-w).
+//
+// gen compiles the templates ahead of time to a Go package (see
+// pongo2.GenerateGo), e. g. in a go:generate directive:
+//
+//	//go:generate pongo2 gen -basedir templates -pkg templates -o templates/templates.go
+//
+// render, lint, deps and gen load templates through a LocalFilesystemLoader with the given
+// base directory and apply the options, sandbox settings and limits of the
+// config file (YAML or JSON, see config), so the results match your
+// application's template set.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage:
+  pongo2 render [-basedir dir] [-config file] [-context file] template
+  pongo2 lint   [-basedir dir] [-config file] [-ext .html,.tpl] [path ...]
+  pongo2 deps   [-basedir dir] [-config file] [-ext .html,.tpl] [-dot] [path ...]
+  pongo2 fmt    [-l] [-w] [-ext .html,.tpl] [path ...]
+  pongo2 gen    -basedir dir [-config file] [-ext .html,.tpl] [-pkg name] [-o file] [path ...]
+
+Run 'pongo2 <command> -h' for the flags of a command.
+`
+
+var commands = map[string]func(env *env, args []string) int{
+	"render": renderCommand,
+	"lint":   lintCommand,
+	"deps":   depsCommand,
+	"fmt":    fmtCommand,
+	"gen":    genCommand,
+}
+
+// env contains the standard streams of a command invocation.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (e *env) errorf(format string, args ...any) {
+	fmt.Fprintf(e.stderr, "pongo2: "+format+"\n", args...)
+}
+
+func main() {
+	os.Exit(run(&env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
+}
+
+// run executes the command given in args and returns the exit code
+// (0: success, 1: template errors, 2: usage errors).
+func run(e *env, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(e.stderr, usage)
+		return 2
+	}
+	cmd, has := commands[args[0]]
+	if !has {
+		e.errorf("unknown command '%s'", args[0])
+		fmt.Fprint(e.stderr, usage)
+		return 2
+	}
+	return cmd(e, args[1:])
+}
+
+// setFlags are the flags shared by all commands.
+type setFlags struct {
+	baseDir    string
+	configFile string
+}
+
+func newFlagSet(e *env, name string) (*flag.FlagSet, *setFlags) {
+	fs := flag.NewFlagSet("pongo2 "+name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	sf := &setFlags{}
+	fs.StringVar(&sf.baseDir, "basedir", "", "base directory of the templates (like NewLocalFileSystemLoader's baseDir)")
+	fs.StringVar(&sf.configFile, "config", "", "YAML or JSON file with options, sandbox settings and limits")
+	return fs, sf
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func runCommand(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(&env{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut}, args)
+	return code, out.String(), errOut.String()
+}
+
+func TestRender(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.html":   "<h1>{% block title %}{% endblock %}</h1>",
+		"page.html":   `{% extends "base.html" %}{% block title %}{{ user.name|upper }}{% endblock %}`,
+		"ctx.json":    `{"user": {"name": "alice"}}`,
+		"strict.yaml": "undefined: strict",
+	})
+
+	code, out, errOut := runCommand("", "render", "-basedir", dir, "-context", filepath.Join(dir, "ctx.json"), "page.html")
+	if code != 0 || out != "<h1>ALICE</h1>" {
+		t.Errorf("render with JSON context: %d, %q, %q", code, out, errOut)
+	}
+
+	code, out, errOut = runCommand("user:\n  name: bob\n", "render", "-basedir", dir, "-context", "-", "page.html")
+	if code != 0 || out != "<h1>BOB</h1>" {
+		t.Errorf("render with YAML context from stdin: %d, %q, %q", code, out, errOut)
+	}
+
+	code, out, errOut = runCommand("{{ missing.name }}", "render", "-config", filepath.Join(dir, "strict.yaml"), "-")
+	if code != 1 || out != "" || !strings.Contains(errOut, "'missing' can't be resolved") {
+		t.Errorf("render with strict config: %d, %q, %q", code, out, errOut)
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"ok.html":      `{% include "partial.html" %}`,
+		"partial.html": "{{ value|unknown }}\n{% ssi \"ok.html\" %}",
+		"broken.tpl":   "{% if %}",
+		"ignored.go":   "{{ ignored",
+		"config.yaml":  "banned_tags: [ssi]",
+	})
+
+	code, out, errOut := runCommand("", "lint", "-basedir", dir, "-config", filepath.Join(dir, "config.yaml"))
+	if code != 1 || !strings.Contains(errOut, "3 problem(s) found in 3 template(s)") {
+		t.Errorf("lint: %d, %q", code, errOut)
+	}
+	want := []string{
+		"broken.tpl:1:4: parse: ",
+		"partial.html:1:10: parse: Filter 'unknown' does not exist.",
+		"partial.html:2:4: sandbox: Usage of tag 'ssi' is not allowed",
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("lint output: %q", out)
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], filepath.Join(dir, w)) {
+			t.Errorf("line %d: got %q, want %q", i, lines[i], w)
+		}
+	}
+
+	code, out, _ = runCommand("", "lint", filepath.Join(dir, "ok.html"))
+	if code != 1 || strings.Count(out, "\n") != 1 {
+		t.Errorf("lint of a single file: %d, %q", code, out)
+	}
+}
+
+func TestDeps(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.html":   "{% block content %}{% endblock %}",
+		"macros.html": "{% macro m() export %}{% endmacro %}",
+		"page.html":   `{% extends "base.html" %}{% import "macros.html" m %}{% block content %}{% include name %}{% endblock %}`,
+	})
+	base := filepath.Join(dir, "base.html")
+	macros := filepath.Join(dir, "macros.html")
+	page := filepath.Join(dir, "page.html")
+
+	code, out, errOut := runCommand("", "deps", "-basedir", dir)
+	want := page + " -> " + base + " (extends)\n" +
+		page + " -> " + macros + " (import)\n" +
+		page + " -> (dynamic) (include)\n"
+	if code != 0 || out != want {
+		t.Errorf("deps: %d, %q, %q; want %q", code, out, errOut, want)
+	}
+
+	code, out, _ = runCommand("", "deps", "-dot", page)
+	if code != 0 || !strings.HasPrefix(out, "digraph templates {\n") ||
+		!strings.Contains(out, `"`+page+`" -> "(dynamic)" [label="include", style=dashed];`) {
+		t.Errorf("deps -dot: %d, %q", code, out)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"ok.html":   "{% if a %}{{ a }}{% endif %}",
+		"ugly.html": "{%if a%}\n{{a}}\n   {%endif%}",
+	})
+	ugly := filepath.Join(dir, "ugly.html")
+
+	code, out, _ := runCommand("{{a|upper}}", "fmt")
+	if code != 0 || out != "{{ a|upper }}" {
+		t.Errorf("fmt of stdin: %d, %q", code, out)
+	}
+
+	code, out, _ = runCommand("", "fmt", "-l", dir)
+	if code != 1 || out != ugly+"\n" {
+		t.Errorf("fmt -l: %d, %q", code, out)
+	}
+
+	if code, _, errOut := runCommand("", "fmt", "-w", dir); code != 0 {
+		t.Fatalf("fmt -w: %d, %q", code, errOut)
+	}
+	content, err := os.ReadFile(ugly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "{% if a %}\n{{ a }}\n{% endif %}" {
+		t.Errorf("fmt -w wrote %q", content)
+	}
+	if code, out, _ = runCommand("", "fmt", "-l", dir); code != 0 || out != "" {
+		t.Errorf("fmt -l after fmt -w: %d, %q", code, out)
+	}
+
+	if code, _, errOut := runCommand("{% if %}{% endfor %}", "fmt"); code != 1 || !strings.Contains(errOut, "unexpected end tag") {
+		t.Errorf("fmt of a broken template: %d, %q", code, errOut)
+	}
+}
+
+func TestGen(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"mails/welcome.html": "{% for x in xs %}{{ x }}{% endfor %}",
+		"page.html":          "{% include \"mails/welcome.html\" %}",
+	})
+
+	code, out, errOut := runCommand("", "gen", "-basedir", dir, "-pkg", "mails")
+	if code != 0 {
+		t.Fatalf("gen: %d, %q", code, errOut)
+	}
+	for _, want := range []string{"package mails", "func RenderMailsWelcomeHTML(", "func RenderPageHTML(", `"mails/welcome.html"`, "rt.For(0, "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, out)
+		}
+	}
+
+	if code, _, errOut := runCommand("", "gen", dir); code != 2 || !strings.Contains(errOut, "requires -basedir") {
+		t.Errorf("gen without -basedir: %d, %q", code, errOut)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, _ := runCommand(""); code != 2 {
+		t.Errorf("expected exit code 2 without command, got %d", code)
+	}
+	if code, _, errOut := runCommand("", "unknown"); code != 2 || !strings.Contains(errOut, "unknown command") {
+		t.Errorf("unknown command: %d, %q", code, errOut)
+	}
+	if code, _, _ := runCommand("", "render", "-context", "-", "-"); code != 2 {
+		t.Errorf("expected exit code 2 when reading template and context from stdin, got %d", code)
+	}
+}
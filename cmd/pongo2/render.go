@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rudderlabs/pongo2/v6"
+	"gopkg.in/yaml.v3"
+)
+
+func renderCommand(e *env, args []string) int {
+	fs, sf := newFlagSet(e, "render")
+	contextFile := fs.String("context", "", "JSON or YAML file with the template's context ('-' for stdin)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		e.errorf("render expects exactly one template")
+		return 2
+	}
+	name := fs.Arg(0)
+	if name == "-" && *contextFile == "-" {
+		e.errorf("template and context can't both be read from stdin")
+		return 2
+	}
+
+	cfg, err := loadConfig(sf.configFile)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	set, err := newSet(sf.baseDir, cfg)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+	ctx, err := readContext(e, *contextFile)
+	if err != nil {
+		e.errorf("%v", err)
+		return 2
+	}
+
+	var tpl *pongo2.Template
+	if name == "-" {
+		var buf []byte
+		buf, err = io.ReadAll(e.stdin)
+		if err == nil {
+			tpl, err = set.FromBytes(buf)
+		}
+	} else {
+		tpl, err = set.FromFile(name)
+	}
+	if err != nil {
+		e.errorf("%v", err)
+		return 1
+	}
+
+	// ExecuteWriter buffers, so a failing execution doesn't produce partial output
+	if err := tpl.ExecuteWriter(ctx, e.stdout); err != nil {
+		e.errorf("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// readContext reads a JSON or YAML mapping (JSON is a subset of YAML).
+func readContext(e *env, filename string) (pongo2.Context, error) {
+	ctx := pongo2.Context{}
+	if filename == "" {
+		return ctx, nil
+	}
+
+	var (
+		buf []byte
+		err error
+	)
+	if filename == "-" {
+		buf, err = io.ReadAll(e.stdin)
+	} else {
+		buf, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(buf, &values); err != nil {
+		return nil, fmt.Errorf("context %s: %w", filename, err)
+	}
+	return ctx.Update(values), nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const defaultExtensions = ".html,.htm,.tpl,.tmpl,.txt,.xml"
+
+// findTemplates returns the absolute filenames of all templates in paths.
+// Directories are searched recursively for files with one of the given
+// extensions (skipping hidden directories); files are always included.
+func findTemplates(paths []string, extensions string) ([]string, error) {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(extensions, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			exts[ext] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	add := func(filename string) error {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, abs)
+		}
+		return nil
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := add(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(filename string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if filename != path && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !exts[filepath.Ext(filename)] {
+				return nil
+			}
+			return add(filename)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// templatePaths returns the paths given on the command line, defaulting to
+// the base directory (or the working directory).
+func templatePaths(args []string, baseDir string) []string {
+	if len(args) > 0 {
+		return args
+	}
+	if baseDir != "" {
+		return []string{baseDir}
+	}
+	return []string{"."}
+}
+
+// displayName shortens filename to a path relative to the working
+// directory, if possible.
+func displayName(filename string) string {
+	if !filepath.IsAbs(filename) {
+		return filename
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return filename
+	}
+	rel, err := filepath.Rel(wd, filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filename
+	}
+	return rel
+}
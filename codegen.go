@@ -0,0 +1,681 @@
+package pongo2
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GenerateGo compiles the templates names of set ahead of time to the Go
+// source of package pkg. The generated package contains:
+//
+//   - Templates, the compiled templates (a TemplateLoader for their sources),
+//   - Set, a TemplateSet loading from Templates with the TrimBlocks and
+//     LStripBlocks options of set (globals, filters, tags, sandbox settings
+//     and limits can be configured on it like on any other set),
+//   - a function RenderXxx(w io.Writer, ctx pongo2.Context) error per template
+//     (e. g. RenderMailsWelcomeHTML for "mails/welcome.html").
+//
+// The template structure (HTML, variables, comments and the if, for and with
+// tags) and the expressions of variables and if-tags are compiled to Go
+// code, so rendering doesn't walk the node tree; the lookups of variables
+// like user.Name are cached per type (see GenerateGoWithTypes() to access
+// the fields directly instead). Filters, the arguments of tags and all
+// other tags are evaluated by the interpreter with the same Value semantics.
+// Templates using extends execute the compiled code of the template they
+// extend (with their blocks). The names must be relative to the loader's base
+// directory (e. g. a LocalFilesystemLoader's) so that templates can include,
+// import and extend each other in the generated package as well.
+func GenerateGo(set *TemplateSet, pkg string, names []string) ([]byte, error) {
+	return GenerateGoWithTypes(set, pkg, names, nil)
+}
+
+// GenerateGoWithTypes is like GenerateGo, but knows the types of context
+// variables: types maps variable names to a value of their type (like a nil
+// pointer, e. g. "order": (*shop.Order)(nil)). Variables like
+// order.Customer.Name starting with such a variable (or with the variable of
+// a for- or with-tag iterating over or assigned such a variable) are compiled
+// to Go code accessing the struct fields, string map keys and indexes
+// directly, without reflection; the packages of the types are imported by
+// the generated code. Variables of other types at runtime (or which can't be
+// accessed directly, like nil pointers, missing map keys and types with a
+// TypeResolver) are resolved like by the code GenerateGo generates, so the
+// results are the same.
+func GenerateGoWithTypes(set *TemplateSet, pkg string, names []string, types Context) ([]byte, error) {
+	g := &generator{
+		funcNames: make(map[string]bool),
+		imports:   make(map[string]string),
+		aliases:   map[string]bool{"io": true, "pongo2": true, "reflect": true, "rt": true, "ok": true},
+	}
+	if len(types) > 0 {
+		scope := make(map[string]reflect.Type, len(types))
+		for name, v := range types {
+			scope[name] = reflect.TypeOf(v)
+		}
+		g.scopes = append(g.scopes, scope)
+	}
+
+	type compiled struct {
+		name, funcName string
+		tpl            *Template
+		tree           *compiledTree
+		layout         string
+	}
+	var templates []compiled
+	for _, name := range names {
+		name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+		tpl, err := set.FromFile(name)
+		if err != nil {
+			return nil, err
+		}
+		tpl.applyWhitespaceOptions()
+		c := compiled{name: name, funcName: g.funcName(name), tpl: tpl}
+		if tpl.parent == nil {
+			c.tree = newCompiledTree(tpl)
+			c.layout = c.tree.layout()
+		}
+		templates = append(templates, c)
+	}
+
+	g.printf("// Templates are the compiled templates.\n")
+	g.printf("var Templates = pongo2.NewCompiledTemplates(\n")
+	for _, c := range templates {
+		g.printf("&pongo2.CompiledTemplate{\nName: %q,\nSource: %q,\n", c.name, c.tpl.tpl)
+		if c.tpl.parent == nil {
+			g.printf("Render: render%s,\nLayout: %q,\n", c.funcName, c.layout)
+			if c.tpl.Options.TrimBlocks {
+				g.printf("TrimBlocks: true,\n")
+			}
+			if c.tpl.Options.LStripBlocks {
+				g.printf("LStripBlocks: true,\n")
+			}
+		}
+		g.printf("},\n")
+	}
+	g.printf(")\n\n")
+
+	g.printf("// Set is the template set the compiled templates are executed with.\n")
+	if set.Options.TrimBlocks || set.Options.LStripBlocks {
+		g.printf("var Set = func() *pongo2.TemplateSet {\nset := pongo2.NewSet(%q, Templates)\n", pkg)
+		g.printf("set.Options.TrimBlocks = %t\nset.Options.LStripBlocks = %t\nreturn set\n}()\n\n",
+			set.Options.TrimBlocks, set.Options.LStripBlocks)
+	} else {
+		g.printf("var Set = pongo2.NewSet(%q, Templates)\n\n", pkg)
+	}
+
+	for _, c := range templates {
+		g.printf("// Render%s renders the template %q.\n", c.funcName, c.name)
+		g.printf("func Render%s(w io.Writer, ctx pongo2.Context) error {\n", c.funcName)
+		g.printf("return Templates.ExecuteWriter(Set, %q, ctx, w)\n}\n\n", c.name)
+		if c.tpl.parent != nil {
+			continue
+		}
+		g.printf("func render%s(rt *pongo2.Runtime) error {\n", c.funcName)
+		g.node, g.list, g.expr = 0, 0, 0
+		g.template = c.funcName
+		g.nodes(c.tpl.root.Nodes)
+		g.printf("return nil\n}\n\n")
+		g.out.Write(g.paths.Bytes())
+		g.paths.Reset()
+		if g.node != len(c.tree.nodes) || g.list != len(c.tree.lists) || g.expr != len(c.tree.exprs) {
+			return nil, fmt.Errorf("template '%s': generated code doesn't match the template's structure", c.name)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by pongo2. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	fmt.Fprintf(&out, "import (\n\t\"io\"\n")
+	if g.typed {
+		fmt.Fprintf(&out, "\t\"reflect\"\n")
+	}
+	fmt.Fprintf(&out, "\n\tpongo2 %q\n", "github.com/rudderlabs/pongo2/v6")
+	pkgPaths := make([]string, 0, len(g.imports))
+	for pkgPath := range g.imports {
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	sort.Strings(pkgPaths)
+	for _, pkgPath := range pkgPaths {
+		fmt.Fprintf(&out, "\t%s %q\n", g.imports[pkgPath], pkgPath)
+	}
+	fmt.Fprintf(&out, ")\n\n")
+	out.Write(g.out.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	out       bytes.Buffer
+	funcNames map[string]bool
+
+	// Static types of variables (see GenerateGoWithTypes()): the innermost
+	// scope (of a for- or with-tag) last. Variables of unknown types are nil.
+	scopes   []map[string]reflect.Type
+	imports  map[string]string // package path -> name
+	aliases  map[string]bool   // package names in use
+	template string            // function name of the template being generated
+	paths    bytes.Buffer      // functions of the template's typed paths
+	typed    bool              // whether any typed path has been generated
+
+	// Indexes of the next node, node list and expression (in the order of
+	// newCompiledTree())
+	node, list, expr int
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+// funcName converts a template name to a unique exported identifier
+// (e. g. "mails/welcome.html" to "MailsWelcomeHTML").
+func (g *generator) funcName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if commonInitialisms[strings.ToUpper(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	base := b.String()
+	if base == "" || !unicode.IsLetter([]rune(base)[0]) {
+		base = "T" + base
+	}
+	funcName := base
+	for i := 2; g.funcNames[funcName]; i++ {
+		funcName = base + strconv.Itoa(i)
+	}
+	g.funcNames[funcName] = true
+	return funcName
+}
+
+// commonInitialisms are written in upper case in function names.
+var commonInitialisms = map[string]bool{
+	"CSS": true, "CSV": true, "HTML": true, "JSON": true, "TXT": true, "XML": true,
+}
+
+// nodes generates the statements executing a list of nodes. The nodes,
+// lists and expressions are numbered like newCompiledTree() does.
+func (g *generator) nodes(nodes []INode) {
+	includes := ""
+	if parallelIncludeCandidates(nodes) {
+		includes = fmt.Sprintf("includes%d", g.list)
+		g.printf("%s := rt.Includes(%d)\ndefer %s.Wait()\n", includes, g.list, includes)
+		g.list++
+	}
+
+	for j, n := range nodes {
+		i := g.node
+		g.node++
+		if includes != "" {
+			g.printf("%s.Start(%d)\n", includes, j+1)
+		}
+		switch n := n.(type) {
+		case *nodeHTML:
+			res := n.token.Val
+			if n.trimLeft {
+				res = strings.TrimLeft(res, tokenSpaceChars)
+			}
+			if n.trimRight {
+				res = strings.TrimRight(res, tokenSpaceChars)
+			}
+			if res == "" {
+				g.printf("if err := rt.Skip(); err != nil {\nreturn err\n}\n")
+				break
+			}
+			g.printf("if err := rt.HTML(%q); err != nil {\nreturn err\n}\n", res)
+		case *nodeVariable:
+			g.printf("if err := rt.Enter(); err != nil {\nreturn err\n}\n")
+			g.printf("if err := rt.Output(%d, %s); err != nil {\nreturn err\n}\n", i, g.value(n.expr))
+		case *tagCommentNode:
+			g.printf("if err := rt.Skip(); err != nil {\nreturn err\n}\n")
+		case *tagIfNode:
+			// The conditions are numbered before the branches
+			conditions := make([]string, 0, len(n.conditions))
+			for _, condition := range n.conditions {
+				conditions = append(conditions, g.value(condition))
+			}
+			g.printf("if err := rt.Enter(); err != nil {\nreturn err\n}\n")
+			for j, condition := range conditions {
+				if j > 0 {
+					g.printf(" else ")
+				}
+				g.printf("if ok, err := rt.Cond(%s); err != nil {\nreturn err\n} else if ok {\n", condition)
+				g.nodes(n.wrappers[j].nodes)
+				g.printf("}")
+			}
+			if len(n.wrappers) > len(n.conditions) {
+				g.printf(" else {\n")
+				g.nodes(n.wrappers[len(n.conditions)].nodes)
+				g.printf("}")
+			}
+			g.printf("\n")
+		case *tagForNode:
+			g.printf("if err := rt.For(%d, func(rt *pongo2.Runtime) error {\n", i)
+			g.pushScope(g.loopTypes(n))
+			g.nodes(n.bodyWrapper.nodes)
+			g.popScope()
+			g.printf("return nil\n}, ")
+			if n.emptyWrapper != nil {
+				g.printf("func(rt *pongo2.Runtime) error {\n")
+				g.pushScope(g.loopTypes(n))
+				g.nodes(n.emptyWrapper.nodes)
+				g.popScope()
+				g.printf("return nil\n}")
+			} else {
+				g.printf("nil")
+			}
+			g.printf("); err != nil {\nreturn err\n}\n")
+		case *tagWithNode:
+			g.printf("if err := rt.With(%d, func(rt *pongo2.Runtime) error {\n", i)
+			scope := make(map[string]reflect.Type, len(n.withPairs))
+			for name, e := range n.withPairs {
+				scope[name] = g.exprType(e)
+			}
+			g.pushScope(scope)
+			g.nodes(n.wrapper.nodes)
+			g.popScope()
+			g.printf("return nil\n}); err != nil {\nreturn err\n}\n")
+		case *tagIncludeNode:
+			if includes == "" {
+				g.printf("if err := rt.Node(%d); err != nil {\nreturn err\n}\n", i)
+				break
+			}
+			g.printf("if err := rt.Include(%d, %s, %d); err != nil {\nreturn err\n}\n", i, includes, j)
+		default:
+			g.printf("if err := rt.Node(%d); err != nil {\nreturn err\n}\n", i)
+		}
+	}
+}
+
+// value returns the Go expression evaluating e to a *pongo2.Value. The
+// operands are numbered (and generated) before it's decided how e is
+// evaluated, like newCompiledTree() numbers them.
+func (g *generator) value(e IEvaluator) string {
+	k := g.expr
+	g.expr++
+	operands := func(e1, e2 IEvaluator) (string, string) {
+		v1, v2 := g.value(e1), "nil"
+		if e2 != nil {
+			v2 = g.value(e2)
+		}
+		return v1, v2
+	}
+
+	switch e := e.(type) {
+	case *Expression:
+		v1, v2 := operands(e.expr1, e.expr2)
+		switch {
+		case e.expr2 == nil:
+			return v1
+		case e.opToken.Val == "and" || e.opToken.Val == "&&":
+			return fmt.Sprintf("rt.Bool(rt.True(%s) && rt.True(%s))", v1, v2)
+		case e.opToken.Val == "or" || e.opToken.Val == "||":
+			return fmt.Sprintf("rt.Bool(rt.True(%s) || rt.True(%s))", v1, v2)
+		}
+	case *relationalExpression:
+		if e.expr2 == nil && e.opToken != nil {
+			// The "is defined" test
+			break
+		}
+		v1, v2 := operands(e.expr1, e.expr2)
+		if e.expr2 == nil {
+			return v1
+		}
+		return fmt.Sprintf("rt.Rel(%d, %s, %s)", k, v1, v2)
+	case *simpleExpression:
+		t1, t2 := operands(e.term1, e.term2)
+		if e.term2 == nil && !e.negate && !e.negativeSign {
+			return t1
+		}
+		return fmt.Sprintf("rt.Simple(%d, %s, %s)", k, t1, t2)
+	case *term:
+		f1, f2 := operands(e.factor1, e.factor2)
+		if e.factor2 == nil {
+			return f1
+		}
+		return fmt.Sprintf("rt.Term(%d, %s, %s)", k, f1, f2)
+	case *power:
+		p1, p2 := operands(e.power1, e.power2)
+		if e.power2 == nil {
+			return p1
+		}
+		return fmt.Sprintf("rt.Power(%s, %s)", p1, p2)
+	case *nodeFilteredVariable:
+		if e.handlesUndefined() {
+			break
+		}
+		v := g.value(e.resolver)
+		for j := range e.filterChain {
+			v = fmt.Sprintf("rt.Filter(%d, %d, %s)", k, j, v)
+		}
+		return v
+	case *variableResolver:
+		if e.isPath() {
+			if fn := g.typedPath(k, e); fn != "" {
+				return fn + "(rt)"
+			}
+			return fmt.Sprintf("rt.Path(%d)", k)
+		}
+	case *stringResolver:
+		return fmt.Sprintf("pongo2.AsValue(%q)", e.val)
+	case *intResolver:
+		return fmt.Sprintf("pongo2.AsValue(%d)", e.val)
+	case *floatResolver:
+		return fmt.Sprintf("pongo2.AsValue(float64(%s))", strconv.FormatFloat(e.val, 'g', -1, 64))
+	case *boolResolver:
+		return fmt.Sprintf("pongo2.AsValue(%t)", e.val)
+	}
+	return fmt.Sprintf("rt.Eval(%d)", k)
+}
+
+func (g *generator) pushScope(scope map[string]reflect.Type) {
+	g.scopes = append(g.scopes, scope)
+}
+
+func (g *generator) popScope() {
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+// varType returns the static type of a variable (nil if unknown).
+func (g *generator) varType(name string) reflect.Type {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if t, has := g.scopes[i][name]; has {
+			return t
+		}
+	}
+	return nil
+}
+
+// loopTypes returns the types of the variables of a for-tag iterating over
+// a typed path. The variables are in the scope even if their types are
+// unknown, so they hide variables of outer scopes.
+func (g *generator) loopTypes(n *tagForNode) map[string]reflect.Type {
+	scope := map[string]reflect.Type{n.key: nil}
+	if n.value != "" {
+		scope[n.value] = nil
+	}
+	t := g.exprType(n.objectEvaluator)
+	if t == nil {
+		return scope
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if n.value == "" {
+			scope[n.key] = t.Elem()
+		}
+	case reflect.Map:
+		scope[n.key] = t.Key()
+		if n.value != "" {
+			scope[n.value] = t.Elem()
+		}
+	}
+	return scope
+}
+
+// exprType returns the static type of an expression which is a plain path
+// (without operators or filters), nil if it's unknown.
+func (g *generator) exprType(e IEvaluator) reflect.Type {
+	for {
+		switch x := e.(type) {
+		case *Expression:
+			if x.expr2 != nil {
+				return nil
+			}
+			e = x.expr1
+			continue
+		case *relationalExpression:
+			if x.expr2 != nil || x.opToken != nil {
+				return nil
+			}
+			e = x.expr1
+			continue
+		case *simpleExpression:
+			if x.term2 != nil || x.negate || x.negativeSign {
+				return nil
+			}
+			e = x.term1
+			continue
+		case *term:
+			if x.factor2 != nil {
+				return nil
+			}
+			e = x.factor1
+			continue
+		case *power:
+			if x.power2 != nil {
+				return nil
+			}
+			e = x.power1
+			continue
+		case *nodeFilteredVariable:
+			if len(x.filterChain) > 0 {
+				return nil
+			}
+			e = x.resolver
+			continue
+		case *variableResolver:
+			if !x.isPath() {
+				return nil
+			}
+			_, t := g.pathSteps(x)
+			return t
+		}
+		return nil
+	}
+}
+
+// typedPathStep is a lookup of a typed path.
+type typedPathStep struct {
+	in    reflect.Type // type of the value looked up in
+	deref bool         // whether it's a pointer (to a struct) to check for nil
+	code  string       // Go code of the lookup (the selector, key or index)
+	check string       // Go code of the check whether the lookup succeeded ("ok" or a length)
+}
+
+// pathSteps returns the lookups of a path starting with a variable of a
+// static type and the type of the result (nil if the path can't be looked
+// up directly). The lookups are the ones compiledPath does (struct fields,
+// string map keys and indexes); the values must not need to be unpacked
+// (*Value, interfaces or functions), which is left to the resolver.
+func (g *generator) pathSteps(vr *variableResolver) ([]typedPathStep, reflect.Type) {
+	t := g.varType(vr.parts[0].s)
+	if !directType(t) {
+		return nil, nil
+	}
+	steps := make([]typedPathStep, 0, len(vr.parts)-1)
+	for _, part := range vr.parts[1:] {
+		info := typeInfoOf(t)
+		if info.resolver || t == typeOfJSONRawMessage {
+			return nil, nil
+		}
+		step := typedPathStep{in: t}
+		switch {
+		case part.typ == varTypeIdent:
+			if _, has := info.methods[part.s]; has {
+				return nil, nil
+			}
+			st := t
+			if st.Kind() == reflect.Ptr {
+				st = st.Elem()
+				step.deref = true
+			}
+			switch {
+			case st.Kind() == reflect.Struct:
+				index, has := typeInfoOf(st).fields[part.s]
+				if !has {
+					return nil, nil
+				}
+				// Embedded pointers might be nil
+				for i := range index[:len(index)-1] {
+					if st.FieldByIndex(index[:i+1]).Type.Kind() == reflect.Ptr {
+						return nil, nil
+					}
+				}
+				field := st.FieldByIndex(index)
+				if !field.IsExported() {
+					return nil, nil
+				}
+				step.code = "." + part.s
+				t = field.Type
+			case !step.deref && st.Kind() == reflect.Map && st.Key() == typeOfString:
+				step.code = fmt.Sprintf("[%q]", part.s)
+				step.check = "ok"
+				t = st.Elem()
+			default:
+				return nil, nil
+			}
+		case part.typ == varTypeInt && part.i >= 0 && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+			step.code = fmt.Sprintf("[%d]", part.i)
+			step.check = strconv.Itoa(part.i)
+			t = t.Elem()
+		default:
+			return nil, nil
+		}
+		if !directType(t) {
+			return nil, nil
+		}
+		steps = append(steps, step)
+	}
+	return steps, t
+}
+
+// directType reports whether values of type t are used as they are by the
+// resolver (unlike *Values, interfaces and functions).
+func directType(t reflect.Type) bool {
+	if t == nil || t == typeOfValuePtr {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Invalid:
+		return false
+	}
+	return true
+}
+
+// typedPath generates a function resolving the path k by accessing the
+// fields directly and returns its name ("" if the path isn't typed).
+func (g *generator) typedPath(k int, vr *variableResolver) string {
+	steps, result := g.pathSteps(vr)
+	if result == nil || len(steps) == 0 {
+		// Variables are looked up without reflection anyway
+		return ""
+	}
+	imports := make(map[string]string)
+	startType, ok := g.typeExpr(g.varType(vr.parts[0].s), imports)
+	if !ok {
+		return ""
+	}
+	typeExprs := make([]string, 0, len(steps))
+	for _, step := range steps {
+		expr, ok := g.typeExpr(step.in, imports)
+		if !ok {
+			return ""
+		}
+		typeExprs = append(typeExprs, fmt.Sprintf("reflect.TypeOf((*%s)(nil)).Elem()", expr))
+	}
+	for pkgPath, name := range imports {
+		g.imports[pkgPath] = name
+		g.aliases[name] = true
+	}
+	g.typed = true
+
+	fn := fmt.Sprintf("path%s%d", g.template, k)
+	fmt.Fprintf(&g.paths, "var types%s%d = []reflect.Type{%s}\n\n", g.template, k, strings.Join(typeExprs, ", "))
+	fmt.Fprintf(&g.paths, "func %s(rt *pongo2.Runtime) *pongo2.Value {\n", fn)
+	fmt.Fprintf(&g.paths, "v0, ok := rt.Var(%q).(%s)\n", vr.parts[0].s, startType)
+	fmt.Fprintf(&g.paths, "if !ok || !rt.Typed(%d, types%s%d) {\nreturn rt.Path(%d)\n}\n", k, g.template, k, k)
+	for i, step := range steps {
+		if step.deref {
+			fmt.Fprintf(&g.paths, "if v%d == nil {\nreturn rt.Path(%d)\n}\n", i, k)
+		}
+		switch step.check {
+		case "":
+			fmt.Fprintf(&g.paths, "v%d := v%d%s\n", i+1, i, step.code)
+		case "ok":
+			fmt.Fprintf(&g.paths, "v%d, ok := v%d%s\nif !ok {\nreturn rt.Path(%d)\n}\n", i+1, i, step.code, k)
+		default:
+			fmt.Fprintf(&g.paths, "if len(v%d) <= %s {\nreturn rt.Path(%d)\n}\nv%d := v%d%s\n", i, step.check, k, i+1, i, step.code)
+		}
+	}
+	fmt.Fprintf(&g.paths, "return pongo2.AsValue(v%d)\n}\n\n", len(steps))
+	return fn
+}
+
+// typeExpr returns the Go expression of type t, adding the packages it
+// refers to to imports. It reports false for types which can't be referred
+// to (like unexported ones).
+func (g *generator) typeExpr(t reflect.Type, imports map[string]string) (string, bool) {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			// Predeclared
+			return t.Name(), true
+		}
+		if !isExportedName(t.Name()) || strings.ContainsRune(t.Name(), '[') || t.PkgPath() == "main" {
+			return "", false
+		}
+		name, has := g.imports[t.PkgPath()]
+		if !has {
+			name, has = imports[t.PkgPath()]
+		}
+		if !has {
+			// The package's name (which might differ from the last element
+			// of its path)
+			base := strings.SplitN(t.String(), ".", 2)[0]
+			name = base
+			for i := 2; g.aliases[name] || aliasUsed(imports, name); i++ {
+				name = base + strconv.Itoa(i)
+			}
+			imports[t.PkgPath()] = name
+		}
+		return name + "." + t.Name(), true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		elem, ok := g.typeExpr(t.Elem(), imports)
+		if t.Kind() == reflect.Ptr {
+			return "*" + elem, ok
+		}
+		return "[]" + elem, ok
+	case reflect.Array:
+		elem, ok := g.typeExpr(t.Elem(), imports)
+		return fmt.Sprintf("[%d]%s", t.Len(), elem), ok
+	case reflect.Map:
+		key, ok := g.typeExpr(t.Key(), imports)
+		if !ok {
+			return "", false
+		}
+		elem, ok := g.typeExpr(t.Elem(), imports)
+		return fmt.Sprintf("map[%s]%s", key, elem), ok
+	}
+	return "", false
+}
+
+func aliasUsed(imports map[string]string, name string) bool {
+	for _, n := range imports {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isExportedName(name string) bool {
+	r := []rune(name)
+	return len(r) > 0 && unicode.IsUpper(r[0])
+}
@@ -1,16 +1,24 @@
 package pongo2
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 )
 
-var reIdentifiers = regexp.MustCompile("^[a-zA-Z0-9_]+$")
-
-var autoescape = true
+// Escaper used by templates without Options.Escaper
+var defaultEscaper = "html"
 
+// SetAutoescape enables or disables autoescaping for all templates which
+// don't choose an escaper using Options.Escaper.
+//
+// Deprecated: Set Options.Escaper of the template set instead ("none"
+// disables autoescaping).
 func SetAutoescape(newValue bool) {
-	autoescape = newValue
+	if newValue {
+		defaultEscaper = "html"
+	} else {
+		defaultEscaper = "none"
+	}
 }
 
 // A Context type provides constants, variables, instances or functions to a template.
@@ -29,7 +37,7 @@ type Context map[string]any
 
 func (c Context) checkForValidIdentifiers() *Error {
 	for k, v := range c {
-		if !reIdentifiers.MatchString(k) {
+		if !isIdentifier(k) {
 			return &Error{
 				Sender:    "checkForValidIdentifiers",
 				OrigError: fmt.Errorf("context-key '%s' (value: '%+v') is not a valid identifier", k, v),
@@ -39,6 +47,21 @@ func (c Context) checkForValidIdentifiers() *Error {
 	return nil
 }
 
+// isIdentifier reports whether s matches ^[a-zA-Z0-9_]+$ (without a regexp,
+// it's called for each context key on every execution).
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 // Update updates this context with the key/value-pairs from another context.
 func (c Context) Update(other Context) Context {
 	for k, v := range other {
@@ -62,9 +85,19 @@ func (c Context) Update(other Context) Context {
 //
 // To create your own execution context within tags, use the
 // NewChildExecutionContext(parent) function.
+//
+// ExecutionContexts (and their contexts) may be kept after the execution,
+// but they can't be executed with anymore: the internal state of the
+// execution (like its limits and cancellation) is reused by later ones.
 type ExecutionContext struct {
 	template   *Template
-	macroDepth int
+	macroDepth int32 // accessed atomically, macros may be called by includes rendered in parallel
+	execDepth  int
+	state      *executionState
+
+	undefinedPolicy      UndefinedPolicy
+	contextualAutoescape bool
+	escaper              Escaper
 
 	AllowMissingVal bool
 	Autoescape      bool
@@ -77,24 +110,33 @@ var pongo2MetaContext = Context{
 	"version": Version,
 }
 
-func newExecutionContext(tpl *Template, ctx Context) *ExecutionContext {
+func newExecutionContext(state *executionState, tpl *Template, ctx Context) *ExecutionContext {
 	privateCtx := make(Context)
 
 	// Make the pongo2-related funcs/vars available to the context
 	privateCtx["pongo2"] = pongo2MetaContext
 	ctx["nil"] = nil
+
 	return &ExecutionContext{
 		template: tpl,
+		state:    state,
 
 		Public:     ctx,
 		Private:    privateCtx,
-		Autoescape: autoescape,
+		Autoescape: true,
+		escaper:    htmlValueEscaper{},
 	}
 }
 
 func NewChildExecutionContext(parent *ExecutionContext) *ExecutionContext {
 	newctx := &ExecutionContext{
-		template: parent.template,
+		template:  parent.template,
+		execDepth: parent.execDepth,
+		state:     parent.state,
+
+		undefinedPolicy:      parent.undefinedPolicy,
+		contextualAutoescape: parent.contextualAutoescape,
+		escaper:              parent.escaper,
 
 		Public:     parent.Public,
 		Private:    make(Context),
@@ -108,11 +150,50 @@ func NewChildExecutionContext(parent *ExecutionContext) *ExecutionContext {
 	return newctx
 }
 
+// GoContext returns the context.Context the template is being executed with.
+// Custom tags doing long-running work should honor its cancellation.
+func (ctx *ExecutionContext) GoContext() context.Context {
+	return ctx.state.goCtx
+}
+
+// checkCancelled returns an execution error if the execution's
+// context.Context has been cancelled or its deadline has been exceeded.
+func (ctx *ExecutionContext) checkCancelled(token *Token) *Error {
+	select {
+	case <-ctx.state.goCtx.Done():
+		err := ctx.Error(fmt.Errorf("execution aborted: %w", ctx.state.goCtx.Err()), token)
+		err.Sender = "execution:cancelled"
+		err.Kind = ErrorKindCancelled
+		return err
+	default:
+		return nil
+	}
+}
+
 func (ctx *ExecutionContext) Error(err error, token *Token) *Error {
 	return ctx.OrigError(err, token)
 }
 
 func (ctx *ExecutionContext) OrigError(err error, token *Token) *Error {
+	if e, ok := err.(*Error); ok {
+		// Already a pongo2 error (e. g. returned by a nested execution),
+		// keep it as it is and only add missing position information.
+		if e.Filename == "" {
+			if token != nil {
+				e.Filename = token.Filename
+			} else {
+				e.Filename = ctx.template.name
+			}
+		}
+		e.setKindIfUnknown(ErrorKindExecution)
+		if token != nil {
+			e.updateFromTokenIfNeeded(ctx.template, token)
+		} else if e.Template == nil {
+			e.Template = ctx.template
+		}
+		return e
+	}
+
 	filename := ctx.template.name
 	var line, col int
 	if token != nil {
@@ -129,6 +210,7 @@ func (ctx *ExecutionContext) OrigError(err error, token *Token) *Error {
 		Column:    col,
 		Token:     token,
 		Sender:    "execution",
+		Kind:      ErrorKindExecution,
 		OrigError: err,
 	}
 }
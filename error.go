@@ -2,10 +2,85 @@ package pongo2
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 )
 
+// ErrorKind classifies an *Error by the phase in which it occurred.
+type ErrorKind int
+
+const (
+	// ErrorKindUnknown is used for errors created outside of pongo2
+	// (e. g. by custom tags or filters) before they reach the engine.
+	ErrorKindUnknown ErrorKind = iota
+	ErrorKindLex
+	ErrorKindParse
+	// ErrorKindLoad is used if a template could not be loaded.
+	ErrorKindLoad
+	ErrorKindExecution
+	// ErrorKindMissingVariable is used for undefined variables if
+	// Options.UndefinedPolicy is UndefinedStrict.
+	ErrorKindMissingVariable
+	// ErrorKindLimit is used if an execution budget (see Limits) was exceeded.
+	ErrorKindLimit
+	// ErrorKindSandbox is used for denied usages of tags, filters or
+	// attributes (see TemplateSet).
+	ErrorKindSandbox
+	// ErrorKindCancelled is used if the execution's context.Context is done.
+	ErrorKindCancelled
+)
+
+var errorKindNames = []string{
+	ErrorKindUnknown:         "unknown",
+	ErrorKindLex:             "lex",
+	ErrorKindParse:           "parse",
+	ErrorKindLoad:            "load",
+	ErrorKindExecution:       "execution",
+	ErrorKindMissingVariable: "missing-variable",
+	ErrorKindLimit:           "limit",
+	ErrorKindSandbox:         "sandbox",
+	ErrorKindCancelled:       "cancelled",
+}
+
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(errorKindNames) {
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+	return errorKindNames[k]
+}
+
+// MarshalText returns the kind's name.
+func (k ErrorKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ErrorFrame is one step of the chain of templates (through include,
+// extends, import or ssi) which lead to the template the error occurred in.
+type ErrorFrame struct {
+	// Kind is the tag name: "include", "extends", "import" or "ssi".
+	Kind     string `json:"kind"`
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// ErrorSnippet contains the lines surrounding an error; see Error.Snippet().
+type ErrorSnippet struct {
+	Filename string
+
+	// Lines are the source lines, FirstLine is the line number of Lines[0].
+	Lines     []string
+	FirstLine int
+
+	// Line, Column and EndColumn (exclusive) denote the erroneous range.
+	// Columns are counted in bytes, starting at 1.
+	Line      int
+	Column    int
+	EndColumn int
+}
+
 // The Error type is being used to address an error during lexing, parsing or
 // execution. If you want to return an error object (for example in your own
 // tag or filter) fill this object with as much information as you have.
@@ -20,6 +95,35 @@ type Error struct {
 	Token     *Token
 	Sender    string
 	OrigError error
+
+	// Kind is filled in by pongo2 if it's not given.
+	Kind ErrorKind
+
+	// Stack contains the include/extends chain at the time the error
+	// occurred, starting with the innermost frame.
+	Stack []ErrorFrame
+}
+
+// pushFrame adds the location of the tag which included/extended/imported
+// the erroneous template to the error's stack.
+func (e *Error) pushFrame(kind string, t *Token) *Error {
+	if t != nil {
+		e.Stack = append(e.Stack, ErrorFrame{
+			Kind:     kind,
+			Filename: t.Filename,
+			Line:     t.Line,
+			Column:   t.Col,
+		})
+	}
+	return e
+}
+
+// setKindIfUnknown sets the error's kind, if it hasn't been set yet.
+func (e *Error) setKindIfUnknown(kind ErrorKind) *Error {
+	if e.Kind == ErrorKindUnknown {
+		e.Kind = kind
+	}
+	return e
 }
 
 func (e *Error) updateFromTokenIfNeeded(template *Template, t *Token) *Error {
@@ -29,6 +133,9 @@ func (e *Error) updateFromTokenIfNeeded(template *Template, t *Token) *Error {
 
 	if e.Token == nil {
 		e.Token = t
+		if e.Filename == "" {
+			e.Filename = t.Filename
+		}
 		if e.Line <= 0 {
 			e.Line = t.Line
 			e.Column = t.Col
@@ -58,8 +165,109 @@ func (e *Error) Error() string {
 	return s
 }
 
+// MarshalJSON encodes the error's details (kind, sender, message, position
+// and stack) for machine consumption, e. g. by editors.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	details := struct {
+		Kind      ErrorKind    `json:"kind"`
+		Sender    string       `json:"sender,omitempty"`
+		Message   string       `json:"message"`
+		Filename  string       `json:"filename,omitempty"`
+		Line      int          `json:"line,omitempty"`
+		Column    int          `json:"column,omitempty"`
+		EndColumn int          `json:"end_column,omitempty"`
+		Token     string       `json:"token,omitempty"`
+		Stack     []ErrorFrame `json:"stack,omitempty"`
+	}{
+		Kind:     e.Kind,
+		Sender:   e.Sender,
+		Filename: e.Filename,
+		Line:     e.Line,
+		Column:   e.Column,
+		Stack:    e.Stack,
+	}
+	if e.OrigError != nil {
+		details.Message = e.OrigError.Error()
+	}
+	if e.Line > 0 {
+		details.EndColumn = e.endColumn()
+	}
+	if e.Token != nil {
+		details.Token = e.Token.Val
+	}
+	return json.Marshal(details)
+}
+
+func (e *Error) endColumn() int {
+	if e.Token != nil && e.Token.Line == e.Line && len(e.Token.Val) > 0 {
+		return e.Column + len(e.Token.Val)
+	}
+	return e.Column + 1
+}
+
+// source returns the in-memory source of the template the error occurred in.
+func (e *Error) source() (string, bool) {
+	if e.Template == nil {
+		return "", false
+	}
+	// Within template inheritance the error might belong to a parent or child
+	for t := e.Template; t != nil; t = t.parent {
+		if t.name == e.Filename {
+			return t.tpl, true
+		}
+	}
+	for t := e.Template.child; t != nil; t = t.child {
+		if t.name == e.Filename {
+			return t.tpl, true
+		}
+	}
+	return "", false
+}
+
+// Snippet returns the affected line of the template including up to
+// contextLines lines before and after it. The lines are taken from the
+// template's source in memory. available is false if the error has no
+// position or the source isn't known.
+func (e *Error) Snippet(contextLines int) (snippet *ErrorSnippet, available bool) {
+	if e.Line <= 0 {
+		return nil, false
+	}
+	src, ok := e.source()
+	if !ok {
+		return nil, false
+	}
+	lines := strings.Split(src, "\n")
+	if e.Line > len(lines) {
+		return nil, false
+	}
+
+	first := e.Line - contextLines
+	if first < 1 {
+		first = 1
+	}
+	last := e.Line + contextLines
+	if last > len(lines) {
+		last = len(lines)
+	}
+	snippet = &ErrorSnippet{
+		Filename:  e.Filename,
+		FirstLine: first,
+		Line:      e.Line,
+		Column:    e.Column,
+		EndColumn: e.endColumn(),
+	}
+	for _, line := range lines[first-1 : last] {
+		snippet.Lines = append(snippet.Lines, strings.TrimSuffix(line, "\r"))
+	}
+	return snippet, true
+}
+
 // RawLine returns the affected line from the original template, if available.
+// The template's source in memory is preferred over the file on disk.
 func (e *Error) RawLine() (line string, available bool, outErr error) {
+	if snippet, ok := e.Snippet(0); ok {
+		return snippet.Lines[0], true, nil
+	}
 	if e.Line <= 0 || e.Filename == "<string>" {
 		return "", false, nil
 	}
@@ -0,0 +1,861 @@
+package pongo2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Contextual auto-escaping (see Options.ContextualAutoescape): the HTML of a
+// template is scanned when it's parsed to determine where each {{ variable }}
+// is located (in text, an attribute value, a script or style element, a URL
+// or an event handler attribute), so its value can be escaped accordingly at
+// execution.
+//
+// The scanner doesn't know which branches will be executed, so the branches
+// of tags (like if/else) are scanned separately and must leave the HTML in
+// the same state (parsing fails otherwise). Blocks of child templates start
+// in the state of the parent's block.
+
+// escapeKind is the language a value is embedded in.
+type escapeKind uint8
+
+const (
+	escapeHTML       escapeKind = iota // HTML text or a normal attribute value
+	escapeJS                           // JavaScript (outside of string literals)
+	escapeJSString                     // a JavaScript string literal
+	escapeCSS                          // CSS (style elements and attributes)
+	escapeURL                          // the start of a URL attribute value
+	escapeURLPath                      // a URL attribute value (before the query)
+	escapeURLQuery                     // a URL attribute value (query or fragment)
+	escapeJSONValue                    // a JSON document, outside of string literals (see Options.JSONOutput)
+	escapeJSONString                   // a JSON string literal
+	escapeJSRegexp                     // a JavaScript regular expression literal
+)
+
+// attrQuoting reports whether a value is embedded in an attribute value.
+type attrQuoting uint8
+
+const (
+	attrNone attrQuoting = iota
+	attrQuoted
+	attrUnquoted
+)
+
+type escapeContext struct {
+	kind escapeKind
+	attr attrQuoting
+}
+
+// isJSON reports whether the context is part of a JSON document (see
+// Options.JSONOutput).
+func (c escapeContext) isJSON() bool {
+	return c.kind == escapeJSONValue || c.kind == escapeJSONString
+}
+
+// encodesJSON reports whether escape() encodes the output of expr with
+// encoding/json (as JavaScript or JSON value).
+func (c escapeContext) encodesJSON(expr IEvaluator) bool {
+	switch c.kind {
+	case escapeJS:
+		return !expr.FilterApplied("escapejs")
+	case escapeJSONValue:
+		return !expr.FilterApplied("tojson")
+	}
+	return false
+}
+
+// escape escapes s (the output of expr) for the context. Filters already
+// escaping for the context (like escapejs for JavaScript) are respected.
+func (c escapeContext) escape(expr IEvaluator, value *Value) string {
+	var s string
+	switch c.kind {
+	case escapeJS:
+		if expr.FilterApplied("escapejs") {
+			s = value.String()
+		} else {
+			s = jsValueEscape(value)
+		}
+	case escapeJSString:
+		if expr.FilterApplied("escapejs") {
+			s = value.String()
+		} else {
+			s = jsStringEscape(value.String())
+		}
+	case escapeJSONValue:
+		if expr.FilterApplied("tojson") {
+			return value.String()
+		}
+		return escapeJSON(value)
+	case escapeJSONString:
+		if expr.FilterApplied("escapejs") {
+			return value.String()
+		}
+		return jsonStringEscape(value.String())
+	case escapeJSRegexp:
+		s = jsRegexpEscape(value.String())
+	case escapeCSS:
+		s = cssEscape(value.String())
+	case escapeURL, escapeURLPath, escapeURLQuery:
+		s = value.String()
+		if c.kind == escapeURL && !urlSchemeAllowed(s) {
+			s = "#ZgotmplZ"
+		} else if !expr.FilterApplied("urlencode") && !expr.FilterApplied("iriencode") {
+			if c.kind == escapeURLQuery {
+				s = queryEscape(s)
+			} else {
+				s = urlNormalize(s)
+			}
+		}
+	default:
+		s = value.String()
+		if expr.FilterApplied("escape") {
+			return s
+		}
+	}
+
+	switch {
+	case c.attr == attrUnquoted:
+		return unquotedAttrEscaper.Replace(s)
+	case c.attr == attrQuoted, c.kind == escapeHTML:
+		return htmlEscaper.Replace(s)
+	}
+	return s
+}
+
+var (
+	// Like the escape filter
+	htmlEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		">", "&gt;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		"'", "&#39;",
+	)
+
+	// Unquoted attribute values also end at whitespace and can't contain
+	// some more characters
+	unquotedAttrEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		">", "&gt;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		"'", "&#39;",
+		"`", "&#96;",
+		"=", "&#61;",
+		" ", "&#32;",
+		"\t", "&#9;",
+		"\n", "&#10;",
+		"\f", "&#12;",
+		"\r", "&#13;",
+		"\x00", "&#xfffd;",
+	)
+)
+
+// jsValueEscape converts the value to a JavaScript value (using its JSON
+// representation), so strings are quoted.
+func jsValueEscape(value *Value) string {
+	var v any
+	switch {
+	case value.IsString():
+		v = value.String()
+	case value.val.IsValid() && value.val.CanInterface():
+		v = value.Interface()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(value.String())
+	}
+	return string(b)
+}
+
+// jsStringEscape escapes s for JavaScript string (and template) literals.
+// Only characters which are safe in all of them, in HTML attributes and in
+// script elements are kept.
+func jsStringEscape(s string) string {
+	return jsEscapeRunes(s, " _,.-:;!?()")
+}
+
+// jsRegexpEscape escapes s for JavaScript regular expression literals, so
+// it's matched literally.
+func jsRegexpEscape(s string) string {
+	return jsEscapeRunes(s, " _,:;!")
+}
+
+// jsEscapeRunes replaces all runes of s except ASCII letters, digits and the
+// allowed ones by \u escape sequences.
+func jsEscapeRunes(s string, allowed string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			strings.ContainsRune(allowed, r):
+			b.WriteRune(r)
+		case r > 0xffff:
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(&b, `\u%04X\u%04X`, r1, r2)
+		default:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		}
+	}
+	return b.String()
+}
+
+// jsonStringEscape escapes s for JSON string literals.
+func jsonStringEscape(s string) string {
+	quoted := escapeYAML(AsValue(s)) // a JSON string
+	return quoted[1 : len(quoted)-1]
+}
+
+// cssEscape escapes all characters of s which could end a CSS value or
+// start a function call (like url() or expression()).
+func cssEscape(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			strings.ContainsRune(" _,.-#%", r):
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, `\%X `, r)
+		}
+	}
+	return b.String()
+}
+
+// urlSchemeAllowed reports whether the URL has no scheme or a safe one
+// (which excludes e. g. javascript: URLs).
+func urlSchemeAllowed(s string) bool {
+	i := strings.IndexAny(s, ":/?#")
+	if i < 0 || s[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(s[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// urlNormalize percent-encodes all bytes of s which aren't allowed in URLs,
+// while keeping its structure (e. g. slashes and query separators).
+func urlNormalize(s string) string {
+	return percentEncode(s, "!#$%&'()*+,-./:;=?@[]_~")
+}
+
+// queryEscape percent-encodes all bytes of s which have a meaning in a URL
+// query (like url.QueryEscape, but spaces are encoded as %20).
+func queryEscape(s string) string {
+	return percentEncode(s, "-._~")
+}
+
+func percentEncode(s string, allowed string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(allowed, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// htmlState is the state of htmlScanner.
+type htmlState uint8
+
+const (
+	htmlText          htmlState = iota
+	htmlComment                 // <!-- ... -->
+	htmlTagName                 // <name
+	htmlTag                     // inside a tag, between attributes
+	htmlAttrName                // <name attr
+	htmlAfterAttrName           // <name attr
+	htmlBeforeValue             // <name attr=
+	htmlAttrValue               // <name attr="value
+)
+
+// attrKind classifies attribute values.
+type attrKind uint8
+
+const (
+	attrNormal attrKind = iota
+	attrURL
+	attrJS
+	attrCSS
+)
+
+// Attributes containing URLs (besides the ones containing "url" or "uri")
+var urlAttributes = map[string]bool{
+	"action": true, "background": true, "cite": true, "classid": true,
+	"codebase": true, "data": true, "formaction": true, "href": true,
+	"icon": true, "longdesc": true, "manifest": true, "poster": true,
+	"profile": true, "src": true, "usemap": true, "xmlns": true,
+}
+
+// htmlScanner tracks the state of the HTML of a template (see
+// computeEscapeContexts()). It's a value type, so it can be copied.
+type htmlScanner struct {
+	state    htmlState
+	element  string // "script" or "style" inside their content
+	tagName  string
+	endTag   bool
+	attrName string
+	attr     attrKind
+	delim    byte // of the attribute value (0 if unquoted)
+
+	valueStarted bool // for URL values
+	urlQuery     bool
+
+	jsQuote   byte   // of the current JavaScript string literal ('/' in regular expression literals)
+	jsEscape  bool   // after a backslash in a string literal (or a slash/asterisk, see scanJS())
+	jsComment byte   // '/' in line comments, '*' in block comments
+	jsClass   bool   // inside a character class of a regular expression literal
+	jsPrev    byte   // the last character outside of literals and comments
+	jsToken   string // the last token outside of literals and comments (see jsRegexpAllowed())
+	jsUnknown bool   // a slash after jsUnknownToken has been scanned
+
+	json bool // the template is a JSON document, not HTML (only jsQuote and jsEscape are used then)
+}
+
+// context returns the context a value written in the current state is
+// embedded in.
+func (s *htmlScanner) context() escapeContext {
+	if s.json {
+		if s.jsQuote != 0 {
+			return escapeContext{kind: escapeJSONString}
+		}
+		return escapeContext{kind: escapeJSONValue}
+	}
+	switch s.state {
+	case htmlText:
+		switch s.element {
+		case "script":
+			return s.jsContext(attrNone)
+		case "style":
+			return escapeContext{kind: escapeCSS}
+		}
+		return escapeContext{}
+	case htmlComment:
+		return escapeContext{}
+	case htmlBeforeValue:
+		return s.valueContext(attrUnquoted)
+	case htmlAttrValue:
+		quoting := attrQuoted
+		if s.delim == 0 {
+			quoting = attrUnquoted
+		}
+		return s.valueContext(quoting)
+	}
+	// Inside a tag, but not in an attribute value
+	return escapeContext{attr: attrUnquoted}
+}
+
+func (s *htmlScanner) valueContext(quoting attrQuoting) escapeContext {
+	switch s.attr {
+	case attrURL:
+		switch {
+		case !s.valueStarted:
+			return escapeContext{kind: escapeURL, attr: quoting}
+		case s.urlQuery:
+			return escapeContext{kind: escapeURLQuery, attr: quoting}
+		}
+		return escapeContext{kind: escapeURLPath, attr: quoting}
+	case attrJS:
+		return s.jsContext(quoting)
+	case attrCSS:
+		return escapeContext{kind: escapeCSS, attr: quoting}
+	}
+	return escapeContext{attr: quoting}
+}
+
+func (s *htmlScanner) jsContext(quoting attrQuoting) escapeContext {
+	switch {
+	case s.jsQuote == '/', s.jsComment == 0 && s.jsEscape && s.jsQuote == 0 && s.jsRegexpAllowed():
+		// Including a value directly after the slash starting the literal
+		return escapeContext{kind: escapeJSRegexp, attr: quoting}
+	case s.jsQuote != 0:
+		return escapeContext{kind: escapeJSString, attr: quoting}
+	}
+	return escapeContext{kind: escapeJS, attr: quoting}
+}
+
+// inJS reports whether the state is inside a script element or an event
+// handler attribute.
+func (s *htmlScanner) inJS() bool {
+	switch s.state {
+	case htmlText:
+		return s.element == "script"
+	case htmlBeforeValue, htmlAttrValue:
+		return s.attr == attrJS
+	}
+	return false
+}
+
+// written updates the state after a value has been written.
+func (s *htmlScanner) written() {
+	if !s.json && s.inJS() && s.jsComment == 0 && s.jsQuote == 0 {
+		if s.jsEscape {
+			// The preceding slash starts a regular expression literal or
+			// divides (see jsContext())
+			s.jsEscape = false
+			if s.jsSlashStartsRegexp() {
+				s.jsQuote = '/'
+				return
+			}
+		}
+		s.jsPrev, s.jsToken = '0', "0" // like a number
+	}
+	switch s.state {
+	case htmlBeforeValue:
+		s.state = htmlAttrValue
+		s.delim = 0
+		s.valueStarted = true
+	case htmlAttrValue:
+		s.valueStarted = true
+	}
+}
+
+// scan updates the state with the HTML text.
+func (s *htmlScanner) scan(text string) {
+	if s.json {
+		s.scanJSON(text)
+		return
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch s.state {
+		case htmlText:
+			if s.element != "" {
+				if c == '<' && hasPrefixFold(text[i:], "</"+s.element) {
+					i += len(s.element) + 1
+					s.element = ""
+					s.state, s.tagName, s.endTag = htmlTagName, "", true
+				} else if s.element == "script" {
+					s.scanJS(c)
+				}
+				continue
+			}
+			if c != '<' {
+				continue
+			}
+			switch rest := text[i+1:]; {
+			case strings.HasPrefix(rest, "!--"):
+				s.state = htmlComment
+				i += 3
+			case len(rest) > 0 && isASCIILetter(rest[0]):
+				s.state, s.tagName, s.endTag = htmlTagName, "", false
+			case len(rest) > 1 && rest[0] == '/' && isASCIILetter(rest[1]):
+				s.state, s.tagName, s.endTag = htmlTagName, "", true
+				i++
+			}
+		case htmlComment:
+			if strings.HasPrefix(text[i:], "-->") {
+				s.state = htmlText
+				i += 2
+			}
+		case htmlTagName:
+			switch {
+			case c == '>':
+				s.endOfTag()
+			case isHTMLSpace(c) || c == '/':
+				s.state = htmlTag
+			default:
+				s.tagName += string(toLowerASCII(c))
+			}
+		case htmlTag:
+			switch {
+			case c == '>':
+				s.endOfTag()
+			case isHTMLSpace(c) || c == '/':
+			default:
+				s.state, s.attrName = htmlAttrName, string(toLowerASCII(c))
+			}
+		case htmlAttrName:
+			switch {
+			case c == '>':
+				s.endOfTag()
+			case c == '=':
+				s.beforeValue()
+			case isHTMLSpace(c):
+				s.state = htmlAfterAttrName
+			default:
+				s.attrName += string(toLowerASCII(c))
+			}
+		case htmlAfterAttrName:
+			switch {
+			case c == '>':
+				s.endOfTag()
+			case c == '=':
+				s.beforeValue()
+			case isHTMLSpace(c):
+			default:
+				s.state, s.attrName = htmlAttrName, string(toLowerASCII(c))
+			}
+		case htmlBeforeValue:
+			switch {
+			case c == '>':
+				s.endOfTag()
+			case c == '"' || c == '\'':
+				s.state, s.delim = htmlAttrValue, c
+			case isHTMLSpace(c):
+			default:
+				s.state, s.delim = htmlAttrValue, 0
+				s.attrValue(c)
+			}
+		case htmlAttrValue:
+			switch {
+			case s.delim != 0 && c == s.delim, s.delim == 0 && isHTMLSpace(c):
+				s.state = htmlTag
+			case s.delim == 0 && c == '>':
+				s.endOfTag()
+			default:
+				s.attrValue(c)
+			}
+		}
+	}
+}
+
+func (s *htmlScanner) beforeValue() {
+	s.state = htmlBeforeValue
+	s.valueStarted, s.urlQuery = false, false
+	s.resetJS()
+	switch name := s.attrName; {
+	case strings.HasPrefix(name, "on"):
+		s.attr = attrJS
+	case name == "style":
+		s.attr = attrCSS
+	case urlAttributes[name] || strings.Contains(name, "url") || strings.Contains(name, "uri"):
+		s.attr = attrURL
+	default:
+		s.attr = attrNormal
+	}
+}
+
+func (s *htmlScanner) attrValue(c byte) {
+	s.valueStarted = true
+	switch s.attr {
+	case attrURL:
+		if c == '?' || c == '#' {
+			s.urlQuery = true
+		}
+	case attrJS:
+		s.scanJS(c)
+	}
+}
+
+func (s *htmlScanner) endOfTag() {
+	s.state = htmlText
+	if !s.endTag && (s.tagName == "script" || s.tagName == "style") {
+		s.element = s.tagName
+		s.resetJS()
+	}
+}
+
+func (s *htmlScanner) resetJS() {
+	s.jsQuote, s.jsEscape, s.jsComment, s.jsClass = 0, false, 0, false
+	s.jsPrev, s.jsToken, s.jsUnknown = 0, "", false
+}
+
+// scanJS tracks string, template and regular expression literals and
+// comments of JavaScript code.
+func (s *htmlScanner) scanJS(c byte) {
+	switch {
+	case s.jsComment == '/':
+		if c == '\n' {
+			s.jsComment = 0
+		}
+	case s.jsComment == '*':
+		if c == '/' && s.jsEscape {
+			s.jsComment = 0
+		}
+		// jsEscape remembers a preceding '*' in block comments
+		s.jsEscape = c == '*'
+	case s.jsQuote != 0:
+		switch {
+		case s.jsEscape:
+			s.jsEscape = false
+		case c == '\\':
+			s.jsEscape = true
+		case s.jsQuote == '/' && (c == '[' || c == ']'):
+			s.jsClass = c == '['
+		case c == s.jsQuote && !s.jsClass:
+			s.jsQuote = 0
+			s.jsPrev, s.jsToken = '0', "0" // like a number: a following slash divides
+		}
+	case s.jsEscape:
+		// After a slash outside of literals: a comment, a regular expression
+		// literal or a division
+		s.jsEscape = false
+		switch {
+		case c == '/':
+			s.jsComment = '/'
+		case c == '*':
+			s.jsComment = '*'
+		case s.jsSlashStartsRegexp():
+			s.jsQuote = '/'
+			s.scanJS(c)
+		default:
+			s.jsPrev, s.jsToken = '/', "/"
+			s.scanJS(c)
+		}
+	case c == '"' || c == '\'' || c == '`':
+		s.jsQuote = c
+	case c == '/':
+		// jsEscape remembers a preceding '/' outside of literals
+		s.jsEscape = true
+	case isJSSpace(c):
+		s.jsPrev = c
+	case isJSIdentifier(c) && isJSIdentifier(s.jsPrev):
+		s.jsPrev, s.jsToken = c, s.jsToken+string(c)
+	default:
+		s.jsPrev, s.jsToken = c, string(c)
+	}
+}
+
+// Keywords after which a slash starts a regular expression literal
+var jsRegexpKeywords = map[string]bool{
+	"break": true, "case": true, "continue": true, "delete": true, "do": true,
+	"else": true, "finally": true, "in": true, "instanceof": true, "new": true,
+	"return": true, "throw": true, "try": true, "typeof": true, "void": true,
+	"yield": true, "await": true,
+}
+
+// jsRegexpAllowed reports whether a slash after the last token starts a
+// regular expression literal (rather than a division), like html/template
+// decides: after operators, opening brackets, keywords and at the start.
+func (s *htmlScanner) jsRegexpAllowed() bool {
+	if s.jsToken == "" {
+		return true
+	}
+	switch last := s.jsToken[len(s.jsToken)-1]; {
+	case last == ')' || last == ']':
+		return false
+	case isJSIdentifier(last):
+		return jsRegexpKeywords[s.jsToken]
+	}
+	return true
+}
+
+// jsUnknownToken is the last token after branches of which only some end with
+// a token after which a slash starts a regular expression literal.
+const jsUnknownToken = "?"
+
+// jsSlashStartsRegexp is jsRegexpAllowed() for a slash being scanned. After
+// jsUnknownToken, it's assumed to start a regular expression literal and
+// jsUnknown is set.
+func (s *htmlScanner) jsSlashStartsRegexp() bool {
+	if s.jsToken == jsUnknownToken {
+		s.jsUnknown = true
+	}
+	return s.jsRegexpAllowed()
+}
+
+func isJSIdentifier(c byte) bool {
+	return isASCIILetter(c) || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+func isJSSpace(c byte) bool {
+	return isHTMLSpace(c) || c == '\v'
+}
+
+// scanJSON updates the state with the JSON text: only whether it's inside a
+// string literal matters.
+func (s *htmlScanner) scanJSON(text string) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case s.jsQuote == 0:
+			if c == '"' {
+				s.jsQuote = c
+			}
+		case s.jsEscape:
+			s.jsEscape = false
+		case c == '\\':
+			s.jsEscape = true
+		case c == '"':
+			s.jsQuote = 0
+		}
+	}
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func toLowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// escapeBranches tracks the states of a tag with branches (like if/else)
+// while they're scanned (see computeEscapeContexts()).
+type escapeBranches struct {
+	tag     string
+	start   htmlScanner // before the tag
+	end     htmlScanner // after the branches scanned so far
+	ended   bool        // a branch has been scanned
+	hasElse bool        // the last branch (else/empty) is scanned
+}
+
+// Tags with branches and the tags separating them. Branches of loops (the
+// body of for) must end in the state they start in, as they're repeated.
+var escapeBranchingTags = map[string][]string{
+	"if":         {"elif", "else"},
+	"for":        {"empty"},
+	"ifchanged":  {"else"},
+	"ifequal":    {"else"},
+	"ifnotequal": {"else"},
+}
+
+// endBranch merges the state after a branch, it reports whether it's the
+// same as the one after the other branches.
+func (b *escapeBranches) endBranch(s htmlScanner) bool {
+	if !b.ended {
+		b.end, b.ended = s, true
+		return true
+	}
+	end, same := mergeStates(b.end, s)
+	b.end = end
+	return same
+}
+
+// mergeStates merges two states the HTML can be in at the same position of
+// the template, it reports whether they're the same (ignoring values which
+// don't matter anymore, like the name of the last attribute in text). If
+// they only differ in whether a slash would start a JavaScript regular
+// expression literal, the result has jsUnknownToken.
+func mergeStates(a, b htmlScanner) (htmlScanner, bool) {
+	na, nb := a.normalized(), b.normalized()
+	if na.jsToken != nb.jsToken {
+		na.jsToken, nb.jsToken = jsUnknownToken, jsUnknownToken
+		a.jsToken = jsUnknownToken
+	}
+	return a, na == nb
+}
+
+// normalized returns the state without the values which don't matter in it.
+func (s htmlScanner) normalized() htmlScanner {
+	switch s.state {
+	case htmlText, htmlComment:
+		s.tagName, s.endTag = "", false
+		fallthrough
+	case htmlTagName, htmlTag:
+		s.attrName = ""
+		fallthrough
+	case htmlAttrName, htmlAfterAttrName:
+		s.attr, s.delim, s.valueStarted, s.urlQuery = attrNormal, 0, false, false
+	}
+	if !s.json && !s.inJS() {
+		s.resetJS()
+		return s
+	}
+	if s.jsToken != jsUnknownToken {
+		// Only whether a slash starts a regular expression literal matters
+		if s.jsRegexpAllowed() {
+			s.jsToken = ""
+		} else {
+			s.jsToken = "0"
+		}
+	}
+	s.jsPrev = 0
+	return s
+}
+
+// computeEscapeContexts determines the escape contexts of the template's
+// variables (collected while parsing) by scanning its HTML. The branches of
+// tags like if/else are scanned separately; with contextual autoescaping or
+// JSON output, they must end in the same state (so a variable after the tag
+// has a single context).
+func (tpl *Template) computeEscapeContexts() *Error {
+	if len(tpl.variables) == 0 && len(tpl.blocks) == 0 {
+		return nil
+	}
+	strict := tpl.Options.ContextualAutoescape || tpl.Options.JSONOutput
+
+	s := htmlScanner{json: tpl.Options.JSONOutput}
+	contexts := make(map[*Token]escapeContext, len(tpl.variables))
+	tpl.blockScanners = make(map[string]htmlScanner)
+	var branches []*escapeBranches
+	for i, t := range tpl.tokens {
+		switch {
+		case t.Typ == TokenHTML:
+			s.scan(t.Val)
+		case t.Typ == TokenSymbol && t.Val == "{{":
+			contexts[t] = s.context()
+			s.written()
+		case t.Typ == TokenSymbol && t.Val == "{%" && i+1 < len(tpl.tokens) &&
+			tpl.tokens[i+1].Typ == TokenIdentifier:
+			name := tpl.tokens[i+1].Val
+			if name == "block" && i+2 < len(tpl.tokens) && tpl.tokens[i+2].Typ == TokenIdentifier {
+				block := tpl.tokens[i+2].Val
+				if tpl.parent != nil {
+					if parent, has := tpl.parent.blockScanners[block]; has {
+						s = parent
+					}
+				}
+				tpl.blockScanners[block] = s
+				break
+			}
+			if _, has := escapeBranchingTags[name]; has {
+				branches = append(branches, &escapeBranches{tag: name, start: s})
+				break
+			}
+			if len(branches) == 0 {
+				break
+			}
+			b := branches[len(branches)-1]
+			separator := false
+			for _, sep := range escapeBranchingTags[b.tag] {
+				separator = separator || name == sep
+			}
+			if !separator && name != "end"+b.tag {
+				break
+			}
+
+			same := b.endBranch(s)
+			if _, same := mergeStates(b.start, s); b.tag == "for" && !b.hasElse && !same && strict {
+				return tpl.parser.Error(errors.New("contextual autoescaping: the body of the 'for'-tag must end in the context it starts in"), t)
+			}
+			if name == "end"+b.tag {
+				if !b.hasElse {
+					// The tag may output nothing at all
+					same = b.endBranch(b.start) && same
+				}
+				s = b.end
+				branches = branches[:len(branches)-1]
+			} else {
+				s = b.start
+				b.hasElse = name != "elif"
+			}
+			if !same && strict {
+				return tpl.parser.Error(fmt.Errorf("contextual autoescaping: the branches of the '%s'-tag end in different contexts", b.tag), t)
+			}
+		}
+		if s.jsUnknown && strict {
+			return tpl.parser.Error(errors.New("contextual autoescaping: a slash after a tag with branches could start a regular expression or divide"), t)
+		}
+	}
+
+	for _, v := range tpl.variables {
+		v.escapeContext = contexts[v.locationToken]
+	}
+	tpl.variables = nil
+	return nil
+}
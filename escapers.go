@@ -0,0 +1,163 @@
+package pongo2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Escaper escapes the output of variables for an output format (see
+// Options.Escaper and the autoescape-tag). Values marked as safe (see
+// AsSafeValue() and the safe-filter) aren't passed to it.
+type Escaper interface {
+	// Escape returns the escaped output of value.
+	Escape(value *Value) string
+}
+
+// EscaperFunc is an Escaper implemented by a function.
+type EscaperFunc func(value *Value) string
+
+func (f EscaperFunc) Escape(value *Value) string {
+	return f(value)
+}
+
+// Registry of all escapers, by name
+var escapers = make(map[string]Escaper)
+
+func init() {
+	MustRegisterEscaper("html", htmlValueEscaper{})
+	MustRegisterEscaper("none", EscaperFunc((*Value).String))
+	MustRegisterEscaper("json", jsonValueEscaper{})
+	MustRegisterEscaper("yaml", EscaperFunc(escapeYAML))
+	MustRegisterEscaper("csv", EscaperFunc(escapeCSV))
+	MustRegisterEscaper("shell", EscaperFunc(escapeShell))
+	MustRegisterEscaper("latex", EscaperFunc(escapeLaTeX))
+}
+
+// RegisterEscaper registers a new escaper, which can be chosen by name using
+// Options.Escaper or the autoescape-tag. Register escapers during the
+// initialization of your program only, the registry isn't synchronized.
+func RegisterEscaper(name string, escaper Escaper) error {
+	if _, existing := escapers[name]; existing {
+		return fmt.Errorf("escaper with name '%s' is already registered", name)
+	}
+	escapers[name] = escaper
+	return nil
+}
+
+func MustRegisterEscaper(name string, escaper Escaper) {
+	if err := RegisterEscaper(name, escaper); err != nil {
+		panic(err)
+	}
+}
+
+// lookupEscaper returns the escaper with the given name.
+func lookupEscaper(name string) (Escaper, error) {
+	escaper, has := escapers[name]
+	if !has {
+		return nil, fmt.Errorf("escaper '%s' does not exist", name)
+	}
+	return escaper, nil
+}
+
+// htmlValueEscaper is the default escaper, like the escape-filter. Only
+// strings are escaped by variables (as pongo2 always did).
+type htmlValueEscaper struct{}
+
+func (htmlValueEscaper) Escape(value *Value) string {
+	return htmlEscaper.Replace(value.String())
+}
+
+// jsonValueEscaper outputs values as JSON values (see escapeJSON()). In
+// templates parsed with Options.JSONOutput, values inside string literals
+// are escaped for them instead.
+type jsonValueEscaper struct{}
+
+func (jsonValueEscaper) Escape(value *Value) string {
+	return escapeJSON(value)
+}
+
+// escapeJSON outputs the value as JSON value: strings are quoted, lists and
+// maps are encoded as arrays and objects.
+func escapeJSON(value *Value) string {
+	var v any
+	switch {
+	case value.IsString():
+		v = value.String()
+	case value.val.IsValid() && value.val.CanInterface():
+		v = value.Interface()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		buf.Reset()
+		enc.Encode(value.String())
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// escapeYAML outputs the value as double-quoted YAML scalar (which has the
+// same escape sequences as JSON strings).
+func escapeYAML(value *Value) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(value.String())
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// escapeCSV outputs the value as CSV field (RFC 4180), quoted if required.
+func escapeCSV(value *Value) string {
+	s := value.String()
+	if !strings.ContainsAny(s, ",\"\r\n") && strings.TrimSpace(s) == s {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// escapeShell outputs the value as a single-quoted word of POSIX shells.
+func escapeShell(value *Value) string {
+	return "'" + strings.ReplaceAll(value.String(), "'", `'\''`) + "'"
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"$", `\$`,
+	"&", `\&`,
+	"#", `\#`,
+	"%", `\%`,
+	"_", `\_`,
+	"^", `\textasciicircum{}`,
+	"~", `\textasciitilde{}`,
+)
+
+// escapeLaTeX escapes the characters with a special meaning in LaTeX text.
+func escapeLaTeX(value *Value) string {
+	return latexEscaper.Replace(value.String())
+}
+
+// setEscaper makes ctx escape using the escaper with the given name ("" is
+// the default escaper). "none" disables autoescaping; enabling it again
+// (autoescape-tag with on) escapes HTML then.
+func (ctx *ExecutionContext) setEscaper(name string) error {
+	if name == "" {
+		name = defaultEscaper
+	}
+	escaper, err := lookupEscaper(name)
+	if err != nil {
+		return err
+	}
+	if name == "none" {
+		ctx.Autoescape = false
+		ctx.escaper = htmlValueEscaper{}
+		return nil
+	}
+	ctx.Autoescape = true
+	ctx.escaper = escaper
+	return nil
+}
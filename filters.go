@@ -97,6 +97,18 @@ func (fc *filterCall) Execute(v *Value, ctx *ExecutionContext) (*Value, *Error)
 		param = AsValue(nil)
 	}
 
+	// Filters don't know the template set, so the AttributePolicy is
+	// enforced for the ones formatting structs here
+	switch fc.name {
+	case "stringformat":
+		err = checkFormat(ctx, v, formatFmt)
+	case "tojson":
+		err = checkFormat(ctx, v, formatJSON)
+	}
+	if err != nil {
+		return nil, err.updateFromTokenIfNeeded(ctx.template, fc.token)
+	}
+
 	filteredValue, err := fc.filterFunc(v, param)
 	if err != nil {
 		return nil, err.updateFromTokenIfNeeded(ctx.template, fc.token)
@@ -119,7 +131,7 @@ func (p *Parser) parseFilter() (*filterCall, *Error) {
 	}
 
 	// Get the appropriate filter function and bind it
-	filterFn, exists := filters[identToken.Val]
+	filterFn, exists := p.template.set.lookupFilter(identToken.Val)
 	if !exists {
 		return nil, p.Error(fmt.Errorf("Filter '%s' does not exist.", identToken.Val), identToken)
 	}
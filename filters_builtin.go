@@ -27,6 +27,7 @@ package pongo2
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -94,8 +95,10 @@ func init() {
 	MustRegisterFilter("wordwrap", filterWordwrap)
 	MustRegisterFilter("yesno", filterYesno)
 
-	MustRegisterFilter("float", filterFloat)     // pongo-specific
-	MustRegisterFilter("integer", filterInteger) // pongo-specific
+	MustRegisterFilter("float", filterFloat)       // pongo-specific
+	MustRegisterFilter("integer", filterInteger)   // pongo-specific
+	MustRegisterFilter("tojson", filterTojson)     // pongo-specific
+	MustRegisterFilter("fromjson", filterFromjson) // pongo-specific
 }
 
 func filterTruncatecharsHelper(s string, newLen int) string {
@@ -610,6 +613,46 @@ func filterInteger(in, param *Value) (*Value, *Error) {
 	return AsValue(in.Integer()), nil
 }
 
+// filterTojson serializes the value as JSON (indented by the given number
+// of spaces, if any). The result is safe for HTML, since <, >, & and ' are
+// escaped in strings.
+func filterTojson(in, param *Value) (*Value, *Error) {
+	var v any
+	switch {
+	case in.IsString():
+		v = in.String()
+	case in.val.IsValid() && in.val.CanInterface():
+		v = in.Interface()
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	if !param.IsNil() && param.Integer() > 0 {
+		enc.SetIndent("", strings.Repeat(" ", param.Integer()))
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, &Error{
+			Sender:    "filter:tojson",
+			OrigError: err,
+		}
+	}
+	out := strings.ReplaceAll(strings.TrimSuffix(b.String(), "\n"), "'", `\u0027`)
+	return AsSafeValue(out), nil
+}
+
+// filterFromjson parses a JSON string into a value (objects are maps, arrays
+// are lists; integral numbers are ints, other numbers floats).
+func filterFromjson(in, param *Value) (*Value, *Error) {
+	v, err := decodeJSON(strings.NewReader(in.String()))
+	if err != nil {
+		return nil, &Error{
+			Sender:    "filter:fromjson",
+			OrigError: err,
+		}
+	}
+	return AsValue(v), nil
+}
+
 func filterLinebreaks(in, param *Value) (*Value, *Error) {
 	if in.Len() == 0 {
 		return in, nil
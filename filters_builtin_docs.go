@@ -0,0 +1,64 @@
+package pongo2
+
+// Short descriptions of the built-in filters (e. g. for editor tooling).
+var builtinFilterDocs = map[string]string{
+	"escape":             "Escapes a string's HTML (<, >, &, \" and ').",
+	"e":                  "Alias of escape: escapes a string's HTML.",
+	"safe":               "Marks a string as not requiring further HTML escaping.",
+	"escapejs":           "Escapes characters for use in JavaScript strings.",
+	"add":                "Adds the argument to the value (numbers are added, strings and lists are concatenated).",
+	"addslashes":         "Adds slashes before quotes and backslashes.",
+	"capfirst":           "Capitalizes the first character of the value.",
+	"center":             "Centers the value in a field of the given width.",
+	"cut":                "Removes all occurrences of the argument from the value.",
+	"date":               "Formats a time.Time according to the given Go time layout.",
+	"default":            "Returns the argument if the value evaluates to false, otherwise the value.",
+	"default_if_none":    "Returns the argument if the value is nil, otherwise the value.",
+	"divisibleby":        "Returns true if the value is divisible by the argument.",
+	"first":              "Returns the first item of a list or the first character of a string.",
+	"floatformat":        "Rounds a float to the given number of decimal places (default: 1, trailing zeros removed).",
+	"get_digit":          "Returns the requested digit of a number, counting from the right (1 is the rightmost digit).",
+	"iriencode":          "Converts an IRI to a string suitable for including in a URL.",
+	"join":               "Joins a list (or the characters of a string) with the argument as separator.",
+	"last":               "Returns the last item of a list or the last character of a string.",
+	"length":             "Returns the length of the value (string, list or map).",
+	"length_is":          "Returns true if the value's length equals the argument.",
+	"linebreaks":         "Converts line breaks to <p> and <br /> tags.",
+	"linebreaksbr":       "Converts line breaks to <br /> tags.",
+	"linenumbers":        "Prefixes each line with its line number.",
+	"ljust":              "Left-aligns the value in a field of the given width.",
+	"lower":              "Converts a string to lowercase.",
+	"make_list":          "Turns the value into a list of its characters.",
+	"phone2numeric":      "Converts letters of a phone number to their numeric equivalents.",
+	"pluralize":          "Returns a plural suffix (default \"s\", or \"singular,plural\" given as argument) if the value is not 1.",
+	"random":             "Returns a random item of a list or a random character of a string.",
+	"removetags":         "Removes the given comma-separated HTML tags from the value.",
+	"rjust":              "Right-aligns the value in a field of the given width.",
+	"slice":              "Returns a slice of a list or string, e.g. \"1:3\".",
+	"split":              "Splits a string by the argument into a list.",
+	"stringformat":       "Formats the value according to the given fmt.Sprintf verb.",
+	"striptags":          "Strips all HTML tags from the value.",
+	"time":               "Formats a time.Time according to the given Go time layout (alias of date).",
+	"title":              "Converts the first character of each word to uppercase.",
+	"truncatechars":      "Truncates a string after the given number of characters (appending \"...\").",
+	"truncatechars_html": "Like truncatechars, but keeps HTML tags intact.",
+	"truncatewords":      "Truncates a string after the given number of words (appending \"...\").",
+	"truncatewords_html": "Like truncatewords, but keeps HTML tags intact.",
+	"upper":              "Converts a string to uppercase.",
+	"urlencode":          "Escapes the value for use in a URL.",
+	"urlize":             "Converts URLs and email addresses in the text into clickable links.",
+	"urlizetrunc":        "Like urlize, but truncates the link texts to the given number of characters.",
+	"wordcount":          "Returns the number of words.",
+	"wordwrap":           "Wraps words after the given number of words per line.",
+	"yesno":              "Maps true, false and nil to \"yes\", \"no\", \"maybe\" (or the comma-separated argument).",
+	"float":              "Converts the value to a float.",
+	"integer":            "Converts the value to an integer.",
+	"tojson":             "Serializes the value as JSON (indented by the given number of spaces, if any).",
+	"fromjson":           "Parses a JSON string into a value (maps, lists, strings, numbers, booleans or nil).",
+}
+
+// FilterDoc returns a short description of a built-in filter.
+func FilterDoc(name string) (string, bool) {
+	doc, has := builtinFilterDocs[name]
+	return doc, has
+}
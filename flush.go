@@ -0,0 +1,101 @@
+package pongo2
+
+import "sync"
+
+// flusher is implemented by writers which buffer their output, like
+// http.ResponseWriter (http.Flusher) or *bufio.Writer.
+type flusher interface {
+	Flush()
+}
+
+type errFlusher interface {
+	Flush() error
+}
+
+// flushFunc returns a function flushing w, or nil if w can't be flushed.
+func flushFunc(w any) func() error {
+	if tw, ok := w.(*templateWriter); ok {
+		w = tw.w
+	}
+	switch f := w.(type) {
+	case errFlusher:
+		return f.Flush
+	case flusher:
+		return func() error {
+			f.Flush()
+			return nil
+		}
+	}
+	return nil
+}
+
+// flushWriter wraps writer so the output is flushed according to the
+// template's options and by the flush-tag, if writer can be flushed. It
+// must be called before limitWriter().
+func (s *executionState) flushWriter(writer TemplateWriter, options *Options) TemplateWriter {
+	flush := flushFunc(writer)
+	if flush == nil {
+		return writer
+	}
+	fw := &flushingTemplateWriter{
+		w:          writer,
+		flushFn:    flush,
+		flushBytes: options.FlushBytes,
+	}
+	s.flusher = fw
+	s.flushBlocks = options.FlushBlocks
+	return fw
+}
+
+// flush flushes the output written so far. It's a no-op if the output
+// can't be flushed (e. g. because it's buffered by ExecuteWriter()).
+func (s *executionState) flush() error {
+	if s.flusher == nil {
+		return nil
+	}
+	return s.flusher.flush()
+}
+
+// flushingTemplateWriter is safe for concurrent use, so included templates
+// rendered in parallel can flush the output written so far.
+type flushingTemplateWriter struct {
+	mu         sync.Mutex
+	w          TemplateWriter
+	flushFn    func() error
+	flushBytes int
+	pending    int // bytes written since the last flush
+}
+
+func (fw *flushingTemplateWriter) flush() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.flushLocked()
+}
+
+func (fw *flushingTemplateWriter) flushLocked() error {
+	if fw.pending == 0 {
+		return nil
+	}
+	fw.pending = 0
+	return fw.flushFn()
+}
+
+func (fw *flushingTemplateWriter) written(n int, err error) (int, error) {
+	fw.pending += n
+	if err == nil && fw.flushBytes > 0 && fw.pending >= fw.flushBytes {
+		err = fw.flushLocked()
+	}
+	return n, err
+}
+
+func (fw *flushingTemplateWriter) WriteString(s string) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.written(fw.w.WriteString(s))
+}
+
+func (fw *flushingTemplateWriter) Write(b []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.written(fw.w.Write(b))
+}
@@ -0,0 +1,397 @@
+package pongo2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// formatIndent is the indentation per nesting level of block tags.
+const formatIndent = "\t"
+
+// formatIntermediateTags are tags which separate the branches of block tags
+// (e. g. if/else/endif). They're indented like the block tag itself.
+var formatIntermediateTags = map[string]bool{
+	"else":   true,
+	"elif":   true,
+	"empty":  true,
+	"plural": true,
+}
+
+// formatBlockTags are the built-in tags with an end tag. Other tags are
+// treated as block tags if their end tag is used in the template.
+var formatBlockTags = []string{
+	"allowmissingval", "autoescape", "block", "comment", "exec", "filter", "for", "if",
+	"ifchanged", "ifequal", "ifnotequal", "macro", "spaceless", "with",
+}
+
+// formatOperators are always surrounded by spaces.
+var formatOperators = map[string]bool{
+	"==": true, "!=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true,
+	"&&": true, "||": true,
+}
+
+// Format formats a template's source (similar to gofmt):
+//
+//   - whitespace inside {{ }} and {% %} is normalized (e. g. {{user.name|default:"x"}}
+//     becomes {{ user.name|default:"x" }}), while whitespace control ({{- -}})
+//     and the quotes of strings are kept,
+//   - tags which start a line are indented by one tab per nesting level of
+//     block tags (like for/endfor) they're in; end tags and intermediate tags
+//     (else, elif, empty, plural) are aligned with their block tag and tags
+//     outside of any block tag keep their indentation,
+//   - the HTML, comments, {% comment %}-blocks and verbatim sections are
+//     preserved verbatim.
+//
+// Format only checks the structure of the template (matching end tags);
+// tags and filters don't have to be registered. Formatting a formatted
+// template doesn't change it, and the formatted template is parsed
+// exactly like the original.
+func Format(src []byte) ([]byte, error) {
+	tokens, lexErr := lexTrivia("<string>", string(src))
+	if lexErr != nil {
+		return nil, lexErr
+	}
+	elements, err := formatElements(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &formatter{
+		src:         src,
+		lineOffsets: []int{0},
+		elements:    elements,
+		blockTags:   make(map[string]bool),
+	}
+	for i, c := range src {
+		if c == '\n' {
+			f.lineOffsets = append(f.lineOffsets, i+1)
+		}
+	}
+	for _, name := range formatBlockTags {
+		f.blockTags[name] = true
+	}
+	inComment := false
+	for _, e := range elements {
+		switch {
+		case e.name == "endcomment":
+			inComment = false
+		case inComment:
+			// The content of comments is kept as it is
+		case e.name == "comment":
+			inComment = true
+		}
+		if !inComment && strings.HasPrefix(e.name, "end") {
+			f.blockTags[e.name[len("end"):]] = true
+		}
+	}
+	if err := f.format(); err != nil {
+		return nil, err
+	}
+
+	// The formatter must never change the meaning of a template
+	if err := formatCheck(tokens, f.out.String()); err != nil {
+		return nil, err
+	}
+	return f.out.Bytes(), nil
+}
+
+// formatElement is either a HTML/comment token or a complete tag/variable.
+type formatElement struct {
+	tokens []*Token
+	name   string // tag name (empty for variables, HTML and comments)
+}
+
+func (e *formatElement) isCode() bool {
+	return e.tokens[0].Typ == TokenSymbol
+}
+
+func (e *formatElement) isTag() bool {
+	return e.isCode() && e.tokens[0].Val == "{%"
+}
+
+func formatElements(tokens []*Token) ([]*formatElement, error) {
+	var elements []*formatElement
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.Typ != TokenSymbol {
+			elements = append(elements, &formatElement{tokens: []*Token{t}})
+			continue
+		}
+
+		// A tag or variable up to its closing delimiter
+		end := "%}"
+		if t.Val == "{{" {
+			end = "}}"
+		}
+		e := &formatElement{tokens: []*Token{t}}
+		for {
+			i++
+			if i >= len(tokens) {
+				return nil, formatError(t, fmt.Errorf("'%s' not closed", t.Val))
+			}
+			e.tokens = append(e.tokens, tokens[i])
+			if tokens[i].Typ == TokenSymbol && tokens[i].Val == end {
+				break
+			}
+		}
+		if e.isTag() {
+			code := e.code()
+			if len(code) == 0 || code[0].Typ != TokenIdentifier {
+				return nil, formatError(t, errors.New("tag name must be an identifier"))
+			}
+			e.name = code[0].Val
+		}
+		elements = append(elements, e)
+	}
+	return elements, nil
+}
+
+// code returns the tokens between the delimiters, without whitespace.
+func (e *formatElement) code() []*Token {
+	var code []*Token
+	for _, t := range e.tokens[1 : len(e.tokens)-1] {
+		if t.Typ != TokenWhitespace {
+			code = append(code, t)
+		}
+	}
+	return code
+}
+
+func formatError(t *Token, err error) *Error {
+	return &Error{
+		Filename:  t.Filename,
+		Line:      t.Line,
+		Column:    t.Col,
+		Token:     t,
+		Sender:    "format",
+		Kind:      ErrorKindParse,
+		OrigError: err,
+	}
+}
+
+type formatBlock struct {
+	name   string
+	indent string // of the line the block tag is on
+	token  *Token
+}
+
+type formatter struct {
+	src         []byte
+	lineOffsets []int
+	elements    []*formatElement
+	blockTags   map[string]bool // tags with an end tag
+
+	out    bytes.Buffer
+	blocks []formatBlock
+}
+
+func (f *formatter) format() error {
+	for i := 0; i < len(f.elements); i++ {
+		e := f.elements[i]
+		if !e.isCode() {
+			f.out.WriteString(e.tokens[0].Val)
+			continue
+		}
+		if !e.isTag() {
+			f.out.WriteString(formatCode(e.tokens))
+			continue
+		}
+
+		var indent string
+		isEnd := strings.HasPrefix(e.name, "end") && f.blockTags[e.name[len("end"):]]
+		switch {
+		case isEnd:
+			if len(f.blocks) == 0 || "end"+f.blocks[len(f.blocks)-1].name != e.name {
+				return formatError(e.tokens[0], fmt.Errorf("unexpected end tag '%s'", e.name))
+			}
+			indent = f.blocks[len(f.blocks)-1].indent
+			f.blocks = f.blocks[:len(f.blocks)-1]
+			f.writeTag(e, indent, true)
+		case formatIntermediateTags[e.name] && len(f.blocks) > 0:
+			f.writeTag(e, f.blocks[len(f.blocks)-1].indent, true)
+		case len(f.blocks) > 0:
+			indent = f.blocks[len(f.blocks)-1].indent + formatIndent
+			f.writeTag(e, indent, true)
+		default:
+			f.writeTag(e, "", false)
+		}
+
+		if f.blockTags[e.name] && !isEnd {
+			f.blocks = append(f.blocks, formatBlock{
+				name:   e.name,
+				indent: f.lineIndent(),
+				token:  e.tokens[0],
+			})
+			if e.name == "comment" {
+				// Keep the comment's content as it is
+				end := f.findEndTag(i, "endcomment")
+				if end < 0 {
+					break
+				}
+				f.out.Write(f.src[f.offsetAfter(e.tokens[len(e.tokens)-1]):f.offset(f.elements[end].tokens[0])])
+				i = end - 1
+			}
+		}
+	}
+
+	if len(f.blocks) > 0 {
+		b := f.blocks[len(f.blocks)-1]
+		return formatError(b.token, fmt.Errorf("tag '%s' not closed, expected 'end%s'", b.name, b.name))
+	}
+	return nil
+}
+
+// writeTag writes a tag. If reindent is true and the tag is the first on
+// its line, the line is indented with indent.
+func (f *formatter) writeTag(e *formatElement, indent string, reindent bool) {
+	if reindent {
+		buf := f.out.Bytes()
+		lineStart := bytes.LastIndexByte(buf, '\n') + 1
+		if len(bytes.Trim(buf[lineStart:], " \t")) == 0 {
+			f.out.Truncate(lineStart)
+			f.out.WriteString(indent)
+		}
+	}
+	f.out.WriteString(formatCode(e.tokens))
+}
+
+// lineIndent returns the indentation of the current output line.
+func (f *formatter) lineIndent() string {
+	buf := f.out.Bytes()
+	line := buf[bytes.LastIndexByte(buf, '\n')+1:]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+func (f *formatter) findEndTag(start int, name string) int {
+	for i := start + 1; i < len(f.elements); i++ {
+		if f.elements[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// offset returns the byte offset of a token in the source.
+func (f *formatter) offset(t *Token) int {
+	return f.lineOffsets[t.Line-1] + t.Col - 1
+}
+
+// offsetAfter returns the byte offset behind a closing delimiter.
+func (f *formatter) offsetAfter(t *Token) int {
+	n := len(t.Val)
+	if t.TrimWhitespaces {
+		n++
+	}
+	return f.offset(t) + n
+}
+
+// formatCode formats a tag or variable with normalized whitespace.
+func formatCode(tokens []*Token) string {
+	open, close := tokens[0], tokens[len(tokens)-1]
+
+	var b strings.Builder
+	b.WriteString(open.Val)
+	if open.TrimWhitespaces {
+		b.WriteString("-")
+	}
+	b.WriteString(" ")
+
+	var prev *Token
+	spaced := false
+	for _, t := range tokens[1 : len(tokens)-1] {
+		if t.Typ == TokenWhitespace {
+			spaced = true
+			continue
+		}
+		if prev != nil && formatNeedsSpace(prev, t, spaced) {
+			b.WriteString(" ")
+		}
+		b.WriteString(t.Val)
+		prev, spaced = t, false
+	}
+
+	if prev != nil {
+		b.WriteString(" ")
+	}
+	if close.TrimWhitespaces {
+		b.WriteString("-")
+	}
+	b.WriteString(close.Val)
+	return b.String()
+}
+
+// formatNeedsSpace reports whether two tokens are separated by a space.
+// Where the spacing doesn't follow a fixed rule (e. g. for unary and
+// arithmetic operators) the original spacing is kept.
+func formatNeedsSpace(a, b *Token, spaced bool) bool {
+	isSymbol := func(t *Token, symbols ...string) bool {
+		if t.Typ != TokenSymbol {
+			return false
+		}
+		for _, s := range symbols {
+			if t.Val == s {
+				return true
+			}
+		}
+		return false
+	}
+	isWord := func(t *Token) bool {
+		return t.Typ != TokenSymbol
+	}
+
+	switch {
+	case isSymbol(b, ")", "]", ","), isSymbol(a, "(", "["):
+		return false
+	case isSymbol(a, ","):
+		return true
+	case isSymbol(a, ".", "|", ":"), isSymbol(b, ".", "|", ":"):
+		return false
+	case a.Typ == TokenSymbol && formatOperators[a.Val], b.Typ == TokenSymbol && formatOperators[b.Val]:
+		return true
+	case isSymbol(b, "(", "["):
+		if a.Typ == TokenIdentifier || a.Typ == TokenString || isSymbol(a, ")", "]") {
+			return false // function call or subscript
+		}
+	case isWord(a) && isWord(b):
+		return true
+	}
+	return spaced
+}
+
+// formatCheck makes sure the formatted template consists of the same tokens
+// as the original one (apart from whitespace).
+func formatCheck(original []*Token, formatted string) error {
+	tokens, lexErr := lexTrivia("<string>", formatted)
+	if lexErr != nil {
+		return fmt.Errorf("formatter produced an invalid template: %w", lexErr)
+	}
+	significant := func(tokens []*Token) []*Token {
+		var result []*Token
+		for _, t := range tokens {
+			if t.Typ != TokenWhitespace {
+				result = append(result, t)
+			}
+		}
+		return result
+	}
+	a, b := significant(original), significant(tokens)
+	if len(a) != len(b) {
+		return errors.New("formatter changed the template's tokens")
+	}
+	for i := range a {
+		if a[i].Typ != b[i].Typ || a[i].TrimWhitespaces != b[i].TrimWhitespaces {
+			return formatError(a[i], errors.New("formatter changed the template's tokens"))
+		}
+		if a[i].Typ == TokenHTML {
+			// Only the indentation in front of tags may change
+			if strings.TrimRight(a[i].Val, " \t") != strings.TrimRight(b[i].Val, " \t") {
+				return formatError(a[i], errors.New("formatter changed the template's HTML"))
+			}
+		} else if a[i].Val != b[i].Val {
+			return formatError(a[i], errors.New("formatter changed the template's tokens"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package compiledtest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rudderlabs/pongo2/v6"
+	"github.com/rudderlabs/pongo2/v6/internal/compiledtest"
+	"github.com/rudderlabs/pongo2/v6/internal/compiledtest/model"
+)
+
+var templateNames = []string{
+	"base.html", "expressions.html", "mails/digest.html", "mails/item.html", "mails/notification.html",
+	"mails/order.html", "page.html", "parallel.html", "part.html",
+}
+
+type user struct {
+	Name  string
+	Admin bool
+}
+
+var order = &model.Order{
+	ID:     1042,
+	Status: "shipped",
+	Customer: &model.Customer{
+		Name:    "Jane <Doe>",
+		Email:   "jane@example.com",
+		Address: model.Address{Street: "1 Main St", City: "Springfield", Country: "US"},
+	},
+	Items: []model.Item{
+		{SKU: "A-1", Name: "Teapot", Quantity: 1, Price: 24.5},
+		{SKU: "B-2", Name: "Cups", Quantity: 4, Price: 3.25},
+		{SKU: "C-3", Name: "Tea", Quantity: 2, Price: 7.99},
+	},
+	Total: 53.48,
+	Meta:  map[string]string{"coupon": "WELCOME"},
+}
+
+var contexts = []pongo2.Context{
+	{},
+	{
+		"user":   &user{Name: "guest"},
+		"items":  []string{"first", "second", "third"},
+		"counts": map[string]int{"unread": 3, "read": 1},
+		"html":   "<b>",
+		"title":  "a page",
+		"order":  order,
+	},
+	{
+		"user":  user{Name: "admin", Admin: true},
+		"items": []any{1, "two", 3.5},
+		"title": "another page",
+		// Not of the static type (a pointer)
+		"order": *order,
+	},
+	{
+		// Nil pointers, slices and maps
+		"order": &model.Order{ID: 7},
+	},
+	{
+		"order": pongo2.AsValue(order),
+	},
+	{
+		"order": (*model.Order)(nil),
+	},
+}
+
+func TestCompiledMatchesInterpreter(t *testing.T) {
+	loader, err := pongo2.NewLocalFileSystemLoader("templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter := pongo2.NewSet("interpreter", loader)
+
+	for _, name := range templateNames {
+		for i, ctx := range contexts {
+			tpl, err := interpreter.FromCache(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, wantErr := tpl.Execute(ctx)
+			var got bytes.Buffer
+			err = compiledtest.Templates.ExecuteWriter(compiledtest.Set, name, ctx, &got)
+			if wantErr != nil {
+				// The filenames differ (absolute vs. relative to the loader)
+				if err == nil || err.(*pongo2.Error).OrigError.Error() != wantErr.(*pongo2.Error).OrigError.Error() {
+					t.Errorf("%s (context %d): got error %v, want %v", name, i, err, wantErr)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s (context %d): %v", name, i, err)
+			}
+			if got.String() != want {
+				t.Errorf("%s (context %d):\ngot:  %q\nwant: %q", name, i, got.String(), want)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := compiledtest.RenderMailsItemHTML(&out, pongo2.Context{"item": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "<li>X</li>\n" {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestGeneratedCodeUpToDate(t *testing.T) {
+	loader, err := pongo2.NewLocalFileSystemLoader("templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := pongo2.GenerateGoWithTypes(pongo2.NewSet("gen", loader), "compiledtest", templateNames, model.Types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := os.ReadFile("templates.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, generated) {
+		t.Error("templates.go is outdated, run go generate")
+	}
+}
+
+func TestCompiledErrors(t *testing.T) {
+	ctx := contexts[1]
+
+	set := pongo2.NewSet("limits", compiledtest.Templates)
+	set.Limits.MaxNodeEvaluations = 10
+	var out bytes.Buffer
+	err := compiledtest.Templates.ExecuteWriter(set, "mails/notification.html", ctx, &out)
+	if err == nil || !strings.Contains(err.Error(), "maximum number of node evaluations exceeded") {
+		t.Errorf("got error %v, want node evaluation limit error", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("output written on error: %q", out.String())
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = compiledtest.Templates.ExecuteWriterContext(cancelled, compiledtest.Set, "mails/notification.html", ctx, &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+
+	// Changing the structure of the templates with set-local tags is detected
+	set = pongo2.NewSet("replaced", compiledtest.Templates)
+	err = set.ReplaceTag("with", func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		wrapper, _, err := doc.WrapUntilTag("endwith")
+		if err != nil {
+			return nil, err
+		}
+		return wrapper, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = compiledtest.Templates.ExecuteWriter(set, "mails/notification.html", ctx, &out)
+	if err == nil || !strings.Contains(err.Error(), "doesn't match the compiled one") {
+		t.Errorf("got error %v, want mismatch error", err)
+	}
+
+	err = compiledtest.Templates.ExecuteWriter(compiledtest.Set, "missing.html", ctx, &out)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("got error %v, want not found error", err)
+	}
+}
+
+func TestCompiledPrecompiledDir(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		// The second set loads the serialized templates
+		set := pongo2.NewSet("precompiled", compiledtest.Templates)
+		set.PrecompiledDir = dir
+		var out bytes.Buffer
+		if err := compiledtest.Templates.ExecuteWriter(set, "mails/digest.html", contexts[1], &out); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "<h1>Hi guest</h1>") {
+			t.Errorf("got %q", out.String())
+		}
+	}
+}
+
+func TestCompiledAttributePolicy(t *testing.T) {
+	set := pongo2.NewSet("policy", compiledtest.Templates)
+	render := func() (string, error) {
+		var out bytes.Buffer
+		err := compiledtest.Templates.ExecuteWriter(set, "mails/digest.html", contexts[1], &out)
+		return out.String(), err
+	}
+	if _, err := render(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The policy is asked on every access, also after the lookup is cached
+	set.AttributePolicy = func(t reflect.Type, name string, isMethod bool) bool {
+		return name != "Name"
+	}
+	if _, err := render(); err == nil || !strings.Contains(err.Error(), "access to field 'Name'") {
+		t.Errorf("got error %v, want attribute policy error", err)
+	}
+
+	// Also by the code accessing the fields directly
+	set.AttributePolicy = func(t reflect.Type, name string, isMethod bool) bool {
+		return name != "Email"
+	}
+	var out bytes.Buffer
+	err := compiledtest.Templates.ExecuteWriter(set, "mails/order.html", contexts[1], &out)
+	if err == nil || !strings.Contains(err.Error(), "access to field 'Email'") {
+		t.Errorf("got error %v, want attribute policy error", err)
+	}
+}
+
+// flushRecorder records the output at each flush.
+type flushRecorder struct {
+	strings.Builder
+	flushes []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes = append(r.flushes, r.String())
+}
+
+func TestCompiledParallelIncludesAndFlush(t *testing.T) {
+	set := pongo2.NewSet("parallel", compiledtest.Templates)
+	set.Options.ParallelIncludes = 2
+	tpl, err := set.FromFile("parallel.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a and b wait for each other: they only finish if they're rendered at
+	// the same time (the timeout just avoids hanging)
+	var arrived int32
+	met := make(chan struct{})
+	meet := func(name string) (string, error) {
+		if atomic.AddInt32(&arrived, 1) == 2 {
+			close(met)
+		}
+		select {
+		case <-met:
+			return name, nil
+		case <-time.After(10 * time.Second):
+			return "", errors.New("the includes aren't rendered concurrently")
+		}
+	}
+
+	var rec flushRecorder
+	if err := tpl.ExecuteWriterUnbuffered(pongo2.Context{"meet": meet, "title": "t"}, &rec); err != nil {
+		t.Fatal(err)
+	}
+	want := "<ul><li>A</li>\n<li>B</li>\n</ul>"
+	if rec.String() != want+"t\n" || strings.Join(rec.flushes, "|") != want {
+		t.Errorf("got %q, flushes %q", rec.String(), rec.flushes)
+	}
+}
+
+// The benchmarks render templates without includes (which are executed by
+// the interpreter in both cases): a mail with variables of unknown types and
+// an order confirmation accessing the fields of typed variables directly.
+
+func BenchmarkCompiled(b *testing.B) {
+	b.Run("digest", func(b *testing.B) {
+		benchmarkCompiled(b, compiledtest.RenderMailsDigestHTML)
+	})
+	b.Run("order", func(b *testing.B) {
+		benchmarkCompiled(b, compiledtest.RenderMailsOrderHTML)
+	})
+}
+
+func BenchmarkInterpreted(b *testing.B) {
+	b.Run("digest", func(b *testing.B) {
+		benchmarkInterpreted(b, "mails/digest.html")
+	})
+	b.Run("order", func(b *testing.B) {
+		benchmarkInterpreted(b, "mails/order.html")
+	})
+}
+
+func benchmarkCompiled(b *testing.B, render func(io.Writer, pongo2.Context) error) {
+	var out bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := render(&out, contexts[1]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkInterpreted(b *testing.B, name string) {
+	loader, err := pongo2.NewLocalFileSystemLoader("templates")
+	if err != nil {
+		b.Fatal(err)
+	}
+	tpl, err := pongo2.NewSet("interpreter", loader).FromFile(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var out bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := tpl.ExecuteWriter(contexts[1], &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package compiledtest contains templates compiled ahead of time to Go code
+// to test the generated code against the interpreter.
+package compiledtest
+
+//go:generate go run ./gen
@@ -0,0 +1,41 @@
+// Command gen compiles the templates of the compiledtest package to Go code
+// (templates.go). It's run by go generate; the cmd/pongo2 tool does the same
+// (pongo2 gen), but is a module of its own.
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rudderlabs/pongo2/v6"
+	"github.com/rudderlabs/pongo2/v6/internal/compiledtest/model"
+)
+
+func main() {
+	var names []string
+	err := filepath.WalkDir("templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel("templates", path)
+		names = append(names, filepath.ToSlash(name))
+		return err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loader, err := pongo2.NewLocalFileSystemLoader("templates")
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := pongo2.GenerateGoWithTypes(pongo2.NewSet("gen", loader), "compiledtest", names, model.Types)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("templates.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
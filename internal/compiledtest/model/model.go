@@ -0,0 +1,39 @@
+// Package model contains the types of the context of the compiledtest
+// templates, which the generated code accesses directly.
+package model
+
+import "github.com/rudderlabs/pongo2/v6"
+
+// Types are the static types of the context variables (for
+// pongo2.GenerateGoWithTypes()).
+var Types = pongo2.Context{
+	"order": (*Order)(nil),
+}
+
+type Order struct {
+	ID       int
+	Status   string
+	Customer *Customer
+	Items    []Item
+	Total    float64
+	Meta     map[string]string
+}
+
+type Customer struct {
+	Name    string
+	Email   string
+	Address Address
+}
+
+type Address struct {
+	Street  string
+	City    string
+	Country string
+}
+
+type Item struct {
+	SKU      string
+	Name     string
+	Quantity int
+	Price    float64
+}
@@ -0,0 +1,1089 @@
+// Code generated by pongo2. DO NOT EDIT.
+
+package compiledtest
+
+import (
+	"io"
+	"reflect"
+
+	pongo2 "github.com/rudderlabs/pongo2/v6"
+	model "github.com/rudderlabs/pongo2/v6/internal/compiledtest/model"
+)
+
+// Templates are the compiled templates.
+var Templates = pongo2.NewCompiledTemplates(
+	&pongo2.CompiledTemplate{
+		Name:   "base.html",
+		Source: "<html><head><title>{% block title %}Default{% endblock %}</title></head>\n<body>{% block content %}{% endblock %}</body></html>\n",
+		Render: renderBaseHTML,
+		Layout: "hnhnh|",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "expressions.html",
+		Source: "{% if user.Admin and items|length > 2 or not title %}admin{% elif user.Name == \"guest\" %}guest{% else %}other{% endif %}\n{{ items|length * 2 + 1 }} {{ -counts.unread }} {{ 2 ^ 3 }} {{ 7 % 4 }} {{ 1.5 + 1 }} {{ \"x\" + title|default:\"none\" }} {{ title is defined }} {{ true }} {{ \"page\" in title }}\n{{ user.Name|upper }} {{ items.0 }} {{ counts.unread }} {{ html|safe }}\n{{ 10 / counts.unread }}\n",
+		Render: renderExpressionsHTML,
+		Layout: "ihhhhvhvhvhvhvhvhvhvhvhvhvhvhvhvh|efverfvfisfvrfvfqstfvfifisfvpfifitfifisfdfisfqfrfbrfqfvfvfvfvfvtfifv",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "mails/digest.html",
+		Source: "<h1>Hi {{ user.Name }}</h1>\n{% for item in items %}\n\t{% if forloop.First %}<ul>{% endif %}\n\t<li class=\"{% if forloop.Counter|divisibleby:2 %}even{% else %}odd{% endif %}\">{{ forloop.Counter }}. {{ item }}</li>\n\t{% if forloop.Last %}</ul>{% endif %}\n{% empty %}\n\t<p>Nothing new.</p>\n{% endfor %}\n{% with unread=counts.unread %}{% if unread %}<p>{{ unread }} unread</p>{% endif %}{% endwith %}\n",
+		Render: renderMailsDigestHTML,
+		Layout: "hvhfhihhihhhvhvhihhhhwihvhh|fvfvfvfvfvfvfvfv",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "mails/item.html",
+		Source: "<li>{{ item|upper }}</li>\n",
+		Render: renderMailsItemHTML,
+		Layout: "hvh|fv",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "mails/notification.html",
+		Source: "{# A notification mail #}\n{% macro greet(name) %}Hello {{ name|default:\"there\" }}{% endmacro %}\n<p>{{ greet(user.Name) }},</p>\n{% if user.Admin %}\n\t<p>You're an admin.</p>\n{% elif user.Name == \"guest\" %}\n\t<p>Please sign up.</p>\n{% else %}\n\t<p>Welcome back.</p>\n{% endif %}\n<ul>\n{% for item in items %}\n\t{%- if forloop.First %}<!-- first -->{% endif -%}\n\t{% include \"mails/item.html\" %}\n\t{%- comment %}ignored {{ item }}{% endcomment %}\n{% empty %}\n\t<li>No items.</li>\n{% endfor %}\n</ul>\n{% with total=items|length count=counts.unread %}\n<p>{{ total }} item{{ total|pluralize }}, {{ count|default:0 }} unread</p>\n{% endwith %}\n{% for key, value in counts sorted %}{{ key }}={{ value }}{% if not forloop.Last %}, {% endif %}{% endfor %}\n{{ html }}{% autoescape off %}{{ html }}{% endautoescape %}\n",
+		Render: renderMailsNotificationHTML,
+		Layout: "hnhvhihhhhfhihhxhchhhwhvhvhvhhfvhvihhvnh|fvfvrfvfqfvfvfvffvfvsfvfv",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "mails/order.html",
+		Source: "{# An order confirmation #}\n<h1>Thanks for your order, {{ order.Customer.Name }}!</h1>\n<p>Order #{{ order.ID }} ({{ order.Status|title }}) ships to {{ order.Customer.Address.Street }}, {{ order.Customer.Address.City }} ({{ order.Customer.Address.Country }}).</p>\n<table>\n{% for item in order.Items %}\n\t<tr class=\"{% if forloop.Counter|divisibleby:2 %}even{% else %}odd{% endif %}\"><td>{{ item.Name }}</td><td>{{ item.SKU }}</td><td>{{ item.Quantity }} x {{ item.Price|floatformat:2 }}</td></tr>\n{% empty %}\n\t<tr><td>No items.</td></tr>\n{% endfor %}\n</table>\n{% with first=order.Items.0 %}{% if first %}<p>You ordered {{ first.Name }}{% if order.Items|length > 1 %} and more{% endif %}.</p>{% endif %}{% endwith %}\n<p>Total: {{ order.Total|floatformat:2 }}{% if order.Meta.coupon %} (coupon {{ order.Meta.coupon }}){% endif %}</p>\n<p>Questions? Reply to this mail, we'll answer to {{ order.Customer.Email }}.</p>\n",
+		Render: renderMailsOrderHTML,
+		Layout: "hvhvhvhvhvhvhfhihhhvhvhvhvhhhwihvihhhvihvhhvh|fvfvfvfvfvfvfvfvfvfvfvfvfvrfvfifvfvfvfv",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "page.html",
+		Source: "{% extends \"base.html\" %}\n{% block title %}{{ title|title }}{% endblock %}\n{% block content %}{% include \"mails/item.html\" with item=title %}{% endblock %}\n",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "parallel.html",
+		Source: "<ul>{% include \"part.html\" with name=\"a\" %}{% include \"part.html\" with name=\"b\" %}</ul>{% flush %}{{ title }}\n",
+		Render: renderParallelHTML,
+		Layout: "hxxhnvh|fv",
+	},
+	&pongo2.CompiledTemplate{
+		Name:   "part.html",
+		Source: "<li>{{ meet(name)|upper }}</li>\n",
+		Render: renderPartHTML,
+		Layout: "hvh|fv",
+	},
+)
+
+// Set is the template set the compiled templates are executed with.
+var Set = pongo2.NewSet("compiledtest", Templates)
+
+// RenderBaseHTML renders the template "base.html".
+func RenderBaseHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "base.html", ctx, w)
+}
+
+func renderBaseHTML(rt *pongo2.Runtime) error {
+	if err := rt.HTML("<html><head><title>"); err != nil {
+		return err
+	}
+	if err := rt.Node(1); err != nil {
+		return err
+	}
+	if err := rt.HTML("</title></head>\n<body>"); err != nil {
+		return err
+	}
+	if err := rt.Node(3); err != nil {
+		return err
+	}
+	if err := rt.HTML("</body></html>\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderExpressionsHTML renders the template "expressions.html".
+func RenderExpressionsHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "expressions.html", ctx, w)
+}
+
+func renderExpressionsHTML(rt *pongo2.Runtime) error {
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if ok, err := rt.Cond(rt.Bool(rt.True(rt.Path(2)) && rt.True(rt.Bool(rt.True(rt.Rel(4, rt.Filter(5, 0, rt.Path(6)), pongo2.AsValue(2))) || rt.True(rt.Simple(9, rt.Path(11), nil)))))); err != nil {
+		return err
+	} else if ok {
+		if err := rt.HTML("admin"); err != nil {
+			return err
+		}
+	} else if ok, err := rt.Cond(rt.Rel(12, rt.Path(14), pongo2.AsValue("guest"))); err != nil {
+		return err
+	} else if ok {
+		if err := rt.HTML("guest"); err != nil {
+			return err
+		}
+	} else {
+		if err := rt.HTML("other"); err != nil {
+			return err
+		}
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(5, rt.Simple(17, rt.Term(18, rt.Filter(19, 0, rt.Path(20)), pongo2.AsValue(2)), pongo2.AsValue(1))); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(7, rt.Simple(25, rt.Path(27), nil)); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(9, rt.Power(pongo2.AsValue(2), pongo2.AsValue(3))); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(11, rt.Term(33, pongo2.AsValue(7), pongo2.AsValue(4))); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(13, rt.Simple(38, pongo2.AsValue(float64(1.5)), pongo2.AsValue(1))); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(15, rt.Simple(43, pongo2.AsValue("x"), rt.Eval(46))); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(17, rt.Eval(47)); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(19, pongo2.AsValue(true)); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(21, rt.Rel(50, pongo2.AsValue("page"), rt.Path(54))); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(23, rt.Filter(55, 0, rt.Path(56))); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(25, rt.Path(58)); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(27, rt.Path(60)); err != nil {
+		return err
+	}
+	if err := rt.HTML(" "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(29, rt.Filter(61, 0, rt.Path(62))); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(31, rt.Term(63, pongo2.AsValue(10), rt.Path(67))); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderMailsDigestHTML renders the template "mails/digest.html".
+func RenderMailsDigestHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "mails/digest.html", ctx, w)
+}
+
+func renderMailsDigestHTML(rt *pongo2.Runtime) error {
+	if err := rt.HTML("<h1>Hi "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(1, rt.Path(1)); err != nil {
+		return err
+	}
+	if err := rt.HTML("</h1>\n"); err != nil {
+		return err
+	}
+	if err := rt.For(3, func(rt *pongo2.Runtime) error {
+		if err := rt.HTML("\n\t"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Path(3)); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML("<ul>"); err != nil {
+				return err
+			}
+		}
+		if err := rt.HTML("\n\t<li class=\""); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Filter(4, 0, rt.Path(5))); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML("even"); err != nil {
+				return err
+			}
+		} else {
+			if err := rt.HTML("odd"); err != nil {
+				return err
+			}
+		}
+		if err := rt.HTML("\">"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(12, rt.Path(7)); err != nil {
+			return err
+		}
+		if err := rt.HTML(". "); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(14, rt.Path(9)); err != nil {
+			return err
+		}
+		if err := rt.HTML("</li>\n\t"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Path(11)); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML("</ul>"); err != nil {
+				return err
+			}
+		}
+		if err := rt.HTML("\n"); err != nil {
+			return err
+		}
+		return nil
+	}, func(rt *pongo2.Runtime) error {
+		if err := rt.HTML("\n\t<p>Nothing new.</p>\n"); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	if err := rt.With(21, func(rt *pongo2.Runtime) error {
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Path(13)); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML("<p>"); err != nil {
+				return err
+			}
+			if err := rt.Enter(); err != nil {
+				return err
+			}
+			if err := rt.Output(24, rt.Path(15)); err != nil {
+				return err
+			}
+			if err := rt.HTML(" unread</p>"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderMailsItemHTML renders the template "mails/item.html".
+func RenderMailsItemHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "mails/item.html", ctx, w)
+}
+
+func renderMailsItemHTML(rt *pongo2.Runtime) error {
+	if err := rt.HTML("<li>"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(1, rt.Filter(0, 0, rt.Path(1))); err != nil {
+		return err
+	}
+	if err := rt.HTML("</li>\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderMailsNotificationHTML renders the template "mails/notification.html".
+func RenderMailsNotificationHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "mails/notification.html", ctx, w)
+}
+
+func renderMailsNotificationHTML(rt *pongo2.Runtime) error {
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	if err := rt.Node(1); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n<p>"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(3, rt.Eval(1)); err != nil {
+		return err
+	}
+	if err := rt.HTML(",</p>\n"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if ok, err := rt.Cond(rt.Path(3)); err != nil {
+		return err
+	} else if ok {
+		if err := rt.HTML("\n\t<p>You're an admin.</p>\n"); err != nil {
+			return err
+		}
+	} else if ok, err := rt.Cond(rt.Rel(4, rt.Path(6), pongo2.AsValue("guest"))); err != nil {
+		return err
+	} else if ok {
+		if err := rt.HTML("\n\t<p>Please sign up.</p>\n"); err != nil {
+			return err
+		}
+	} else {
+		if err := rt.HTML("\n\t<p>Welcome back.</p>\n"); err != nil {
+			return err
+		}
+	}
+	if err := rt.HTML("\n<ul>\n"); err != nil {
+		return err
+	}
+	if err := rt.For(10, func(rt *pongo2.Runtime) error {
+		if err := rt.Skip(); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Path(10)); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML("<!-- first -->"); err != nil {
+				return err
+			}
+		}
+		if err := rt.Skip(); err != nil {
+			return err
+		}
+		if err := rt.Node(15); err != nil {
+			return err
+		}
+		if err := rt.Skip(); err != nil {
+			return err
+		}
+		if err := rt.Skip(); err != nil {
+			return err
+		}
+		if err := rt.HTML("\n"); err != nil {
+			return err
+		}
+		return nil
+	}, func(rt *pongo2.Runtime) error {
+		if err := rt.HTML("\n\t<li>No items.</li>\n"); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n</ul>\n"); err != nil {
+		return err
+	}
+	if err := rt.With(21, func(rt *pongo2.Runtime) error {
+		if err := rt.HTML("\n<p>"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(23, rt.Path(12)); err != nil {
+			return err
+		}
+		if err := rt.HTML(" item"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(25, rt.Filter(13, 0, rt.Path(14))); err != nil {
+			return err
+		}
+		if err := rt.HTML(", "); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(27, rt.Eval(15)); err != nil {
+			return err
+		}
+		if err := rt.HTML(" unread</p>\n"); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	if err := rt.For(30, func(rt *pongo2.Runtime) error {
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(31, rt.Path(17)); err != nil {
+			return err
+		}
+		if err := rt.HTML("="); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(33, rt.Path(19)); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Simple(20, rt.Path(22), nil)); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML(", "); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(37, rt.Path(24)); err != nil {
+		return err
+	}
+	if err := rt.Node(38); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderMailsOrderHTML renders the template "mails/order.html".
+func RenderMailsOrderHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "mails/order.html", ctx, w)
+}
+
+func renderMailsOrderHTML(rt *pongo2.Runtime) error {
+	if err := rt.HTML("\n<h1>Thanks for your order, "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(1, pathMailsOrderHTML1(rt)); err != nil {
+		return err
+	}
+	if err := rt.HTML("!</h1>\n<p>Order #"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(3, pathMailsOrderHTML3(rt)); err != nil {
+		return err
+	}
+	if err := rt.HTML(" ("); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(5, rt.Filter(4, 0, pathMailsOrderHTML5(rt))); err != nil {
+		return err
+	}
+	if err := rt.HTML(") ships to "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(7, pathMailsOrderHTML7(rt)); err != nil {
+		return err
+	}
+	if err := rt.HTML(", "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(9, pathMailsOrderHTML9(rt)); err != nil {
+		return err
+	}
+	if err := rt.HTML(" ("); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(11, pathMailsOrderHTML11(rt)); err != nil {
+		return err
+	}
+	if err := rt.HTML(").</p>\n<table>\n"); err != nil {
+		return err
+	}
+	if err := rt.For(13, func(rt *pongo2.Runtime) error {
+		if err := rt.HTML("\n\t<tr class=\""); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Filter(12, 0, rt.Path(13))); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML("even"); err != nil {
+				return err
+			}
+		} else {
+			if err := rt.HTML("odd"); err != nil {
+				return err
+			}
+		}
+		if err := rt.HTML("\"><td>"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(19, pathMailsOrderHTML15(rt)); err != nil {
+			return err
+		}
+		if err := rt.HTML("</td><td>"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(21, pathMailsOrderHTML17(rt)); err != nil {
+			return err
+		}
+		if err := rt.HTML("</td><td>"); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(23, pathMailsOrderHTML19(rt)); err != nil {
+			return err
+		}
+		if err := rt.HTML(" x "); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(25, rt.Filter(20, 0, pathMailsOrderHTML21(rt))); err != nil {
+			return err
+		}
+		if err := rt.HTML("</td></tr>\n"); err != nil {
+			return err
+		}
+		return nil
+	}, func(rt *pongo2.Runtime) error {
+		if err := rt.HTML("\n\t<tr><td>No items.</td></tr>\n"); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n</table>\n"); err != nil {
+		return err
+	}
+	if err := rt.With(29, func(rt *pongo2.Runtime) error {
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if ok, err := rt.Cond(rt.Path(23)); err != nil {
+			return err
+		} else if ok {
+			if err := rt.HTML("<p>You ordered "); err != nil {
+				return err
+			}
+			if err := rt.Enter(); err != nil {
+				return err
+			}
+			if err := rt.Output(32, pathMailsOrderHTML25(rt)); err != nil {
+				return err
+			}
+			if err := rt.Enter(); err != nil {
+				return err
+			}
+			if ok, err := rt.Cond(rt.Rel(26, rt.Filter(27, 0, pathMailsOrderHTML28(rt)), pongo2.AsValue(1))); err != nil {
+				return err
+			} else if ok {
+				if err := rt.HTML(" and more"); err != nil {
+					return err
+				}
+			}
+			if err := rt.HTML(".</p>"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := rt.HTML("\n<p>Total: "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(37, rt.Filter(31, 0, pathMailsOrderHTML32(rt))); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if ok, err := rt.Cond(pathMailsOrderHTML34(rt)); err != nil {
+		return err
+	} else if ok {
+		if err := rt.HTML(" (coupon "); err != nil {
+			return err
+		}
+		if err := rt.Enter(); err != nil {
+			return err
+		}
+		if err := rt.Output(40, pathMailsOrderHTML36(rt)); err != nil {
+			return err
+		}
+		if err := rt.HTML(")"); err != nil {
+			return err
+		}
+	}
+	if err := rt.HTML("</p>\n<p>Questions? Reply to this mail, we'll answer to "); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(43, pathMailsOrderHTML38(rt)); err != nil {
+		return err
+	}
+	if err := rt.HTML(".</p>\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+var typesMailsOrderHTML1 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem(), reflect.TypeOf((**model.Customer)(nil)).Elem()}
+
+func pathMailsOrderHTML1(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(1, typesMailsOrderHTML1) {
+		return rt.Path(1)
+	}
+	if v0 == nil {
+		return rt.Path(1)
+	}
+	v1 := v0.Customer
+	if v1 == nil {
+		return rt.Path(1)
+	}
+	v2 := v1.Name
+	return pongo2.AsValue(v2)
+}
+
+var typesMailsOrderHTML3 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem()}
+
+func pathMailsOrderHTML3(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(3, typesMailsOrderHTML3) {
+		return rt.Path(3)
+	}
+	if v0 == nil {
+		return rt.Path(3)
+	}
+	v1 := v0.ID
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML5 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem()}
+
+func pathMailsOrderHTML5(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(5, typesMailsOrderHTML5) {
+		return rt.Path(5)
+	}
+	if v0 == nil {
+		return rt.Path(5)
+	}
+	v1 := v0.Status
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML7 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem(), reflect.TypeOf((**model.Customer)(nil)).Elem(), reflect.TypeOf((*model.Address)(nil)).Elem()}
+
+func pathMailsOrderHTML7(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(7, typesMailsOrderHTML7) {
+		return rt.Path(7)
+	}
+	if v0 == nil {
+		return rt.Path(7)
+	}
+	v1 := v0.Customer
+	if v1 == nil {
+		return rt.Path(7)
+	}
+	v2 := v1.Address
+	v3 := v2.Street
+	return pongo2.AsValue(v3)
+}
+
+var typesMailsOrderHTML9 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem(), reflect.TypeOf((**model.Customer)(nil)).Elem(), reflect.TypeOf((*model.Address)(nil)).Elem()}
+
+func pathMailsOrderHTML9(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(9, typesMailsOrderHTML9) {
+		return rt.Path(9)
+	}
+	if v0 == nil {
+		return rt.Path(9)
+	}
+	v1 := v0.Customer
+	if v1 == nil {
+		return rt.Path(9)
+	}
+	v2 := v1.Address
+	v3 := v2.City
+	return pongo2.AsValue(v3)
+}
+
+var typesMailsOrderHTML11 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem(), reflect.TypeOf((**model.Customer)(nil)).Elem(), reflect.TypeOf((*model.Address)(nil)).Elem()}
+
+func pathMailsOrderHTML11(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(11, typesMailsOrderHTML11) {
+		return rt.Path(11)
+	}
+	if v0 == nil {
+		return rt.Path(11)
+	}
+	v1 := v0.Customer
+	if v1 == nil {
+		return rt.Path(11)
+	}
+	v2 := v1.Address
+	v3 := v2.Country
+	return pongo2.AsValue(v3)
+}
+
+var typesMailsOrderHTML15 = []reflect.Type{reflect.TypeOf((*model.Item)(nil)).Elem()}
+
+func pathMailsOrderHTML15(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("item").(model.Item)
+	if !ok || !rt.Typed(15, typesMailsOrderHTML15) {
+		return rt.Path(15)
+	}
+	v1 := v0.Name
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML17 = []reflect.Type{reflect.TypeOf((*model.Item)(nil)).Elem()}
+
+func pathMailsOrderHTML17(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("item").(model.Item)
+	if !ok || !rt.Typed(17, typesMailsOrderHTML17) {
+		return rt.Path(17)
+	}
+	v1 := v0.SKU
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML19 = []reflect.Type{reflect.TypeOf((*model.Item)(nil)).Elem()}
+
+func pathMailsOrderHTML19(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("item").(model.Item)
+	if !ok || !rt.Typed(19, typesMailsOrderHTML19) {
+		return rt.Path(19)
+	}
+	v1 := v0.Quantity
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML21 = []reflect.Type{reflect.TypeOf((*model.Item)(nil)).Elem()}
+
+func pathMailsOrderHTML21(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("item").(model.Item)
+	if !ok || !rt.Typed(21, typesMailsOrderHTML21) {
+		return rt.Path(21)
+	}
+	v1 := v0.Price
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML25 = []reflect.Type{reflect.TypeOf((*model.Item)(nil)).Elem()}
+
+func pathMailsOrderHTML25(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("first").(model.Item)
+	if !ok || !rt.Typed(25, typesMailsOrderHTML25) {
+		return rt.Path(25)
+	}
+	v1 := v0.Name
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML28 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem()}
+
+func pathMailsOrderHTML28(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(28, typesMailsOrderHTML28) {
+		return rt.Path(28)
+	}
+	if v0 == nil {
+		return rt.Path(28)
+	}
+	v1 := v0.Items
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML32 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem()}
+
+func pathMailsOrderHTML32(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(32, typesMailsOrderHTML32) {
+		return rt.Path(32)
+	}
+	if v0 == nil {
+		return rt.Path(32)
+	}
+	v1 := v0.Total
+	return pongo2.AsValue(v1)
+}
+
+var typesMailsOrderHTML34 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem(), reflect.TypeOf((*map[string]string)(nil)).Elem()}
+
+func pathMailsOrderHTML34(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(34, typesMailsOrderHTML34) {
+		return rt.Path(34)
+	}
+	if v0 == nil {
+		return rt.Path(34)
+	}
+	v1 := v0.Meta
+	v2, ok := v1["coupon"]
+	if !ok {
+		return rt.Path(34)
+	}
+	return pongo2.AsValue(v2)
+}
+
+var typesMailsOrderHTML36 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem(), reflect.TypeOf((*map[string]string)(nil)).Elem()}
+
+func pathMailsOrderHTML36(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(36, typesMailsOrderHTML36) {
+		return rt.Path(36)
+	}
+	if v0 == nil {
+		return rt.Path(36)
+	}
+	v1 := v0.Meta
+	v2, ok := v1["coupon"]
+	if !ok {
+		return rt.Path(36)
+	}
+	return pongo2.AsValue(v2)
+}
+
+var typesMailsOrderHTML38 = []reflect.Type{reflect.TypeOf((**model.Order)(nil)).Elem(), reflect.TypeOf((**model.Customer)(nil)).Elem()}
+
+func pathMailsOrderHTML38(rt *pongo2.Runtime) *pongo2.Value {
+	v0, ok := rt.Var("order").(*model.Order)
+	if !ok || !rt.Typed(38, typesMailsOrderHTML38) {
+		return rt.Path(38)
+	}
+	if v0 == nil {
+		return rt.Path(38)
+	}
+	v1 := v0.Customer
+	if v1 == nil {
+		return rt.Path(38)
+	}
+	v2 := v1.Email
+	return pongo2.AsValue(v2)
+}
+
+// RenderPageHTML renders the template "page.html".
+func RenderPageHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "page.html", ctx, w)
+}
+
+// RenderParallelHTML renders the template "parallel.html".
+func RenderParallelHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "parallel.html", ctx, w)
+}
+
+func renderParallelHTML(rt *pongo2.Runtime) error {
+	includes0 := rt.Includes(0)
+	defer includes0.Wait()
+	includes0.Start(1)
+	if err := rt.HTML("<ul>"); err != nil {
+		return err
+	}
+	includes0.Start(2)
+	if err := rt.Include(1, includes0, 1); err != nil {
+		return err
+	}
+	includes0.Start(3)
+	if err := rt.Include(2, includes0, 2); err != nil {
+		return err
+	}
+	includes0.Start(4)
+	if err := rt.HTML("</ul>"); err != nil {
+		return err
+	}
+	includes0.Start(5)
+	if err := rt.Node(4); err != nil {
+		return err
+	}
+	includes0.Start(6)
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(5, rt.Path(1)); err != nil {
+		return err
+	}
+	includes0.Start(7)
+	if err := rt.HTML("\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderPartHTML renders the template "part.html".
+func RenderPartHTML(w io.Writer, ctx pongo2.Context) error {
+	return Templates.ExecuteWriter(Set, "part.html", ctx, w)
+}
+
+func renderPartHTML(rt *pongo2.Runtime) error {
+	if err := rt.HTML("<li>"); err != nil {
+		return err
+	}
+	if err := rt.Enter(); err != nil {
+		return err
+	}
+	if err := rt.Output(1, rt.Filter(0, 0, rt.Eval(1))); err != nil {
+		return err
+	}
+	if err := rt.HTML("</li>\n"); err != nil {
+		return err
+	}
+	return nil
+}
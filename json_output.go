@@ -0,0 +1,96 @@
+package pongo2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// JSONOutputError is the error (Error.OrigError) for output which isn't
+// valid JSON (see Options.JSONOutput).
+type JSONOutputError struct {
+	// Offset, Line and Column denote the position in the output at which
+	// the output became invalid. Line and Column start at 1, columns are
+	// counted in bytes.
+	Offset int
+	Line   int
+	Column int
+
+	// Excerpt is the output around the position.
+	Excerpt string
+
+	Err error
+}
+
+func (e *JSONOutputError) Error() string {
+	return fmt.Sprintf("output is not valid JSON at line %d, column %d (near %q): %v",
+		e.Line, e.Column, e.Excerpt, e.Err)
+}
+
+func (e *JSONOutputError) Unwrap() error {
+	return e.Err
+}
+
+// Number of bytes before and after the position included in the excerpt
+const jsonExcerptSize = 20
+
+// validateJSONOutput returns an error if out isn't a valid JSON document.
+func (tpl *Template) validateJSONOutput(out []byte) *Error {
+	if json.Valid(out) {
+		return nil
+	}
+
+	var v any
+	err := json.Unmarshal(out, &v)
+	offset := len(out)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// The offset is the one after the invalid byte
+		offset = int(syntaxErr.Offset) - 1
+		if offset < 0 {
+			offset = 0
+		}
+	}
+
+	line := 1 + bytes.Count(out[:offset], []byte("\n"))
+	column := offset + 1 - (bytes.LastIndexByte(out[:offset], '\n') + 1)
+	from, to := offset-jsonExcerptSize, offset+jsonExcerptSize
+	if from < 0 {
+		from = 0
+	}
+	if to > len(out) {
+		to = len(out)
+	}
+
+	return &Error{
+		Template: tpl,
+		Filename: tpl.name,
+		Sender:   "json",
+		Kind:     ErrorKindExecution,
+		OrigError: &JSONOutputError{
+			Offset:  offset,
+			Line:    line,
+			Column:  column,
+			Excerpt: string(out[from:to]),
+			Err:     err,
+		},
+	}
+}
+
+// jsonRecordingWriter records the output written to an unbuffered writer,
+// so it can be validated after the execution.
+type jsonRecordingWriter struct {
+	w   TemplateWriter
+	buf *bytes.Buffer
+}
+
+func (w *jsonRecordingWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.w.WriteString(s)
+}
+
+func (w *jsonRecordingWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.w.Write(b)
+}
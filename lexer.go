@@ -19,6 +19,10 @@ const (
 	TokenNumber
 	TokenSymbol
 	TokenNil
+
+	// Trivia, only emitted for the formatter (see Format())
+	TokenComment
+	TokenWhitespace
 )
 
 var (
@@ -58,13 +62,24 @@ type (
 type (
 	lexerStateFn func() lexerStateFn
 	lexer        struct {
-		name      string
-		input     string
-		start     int // start pos of the item
-		pos       int // current pos
-		width     int // width of last rune
-		tokens    []*Token
-		errored   bool
+		name    string
+		input   string
+		start   int // start pos of the item
+		pos     int // current pos
+		width   int // width of last rune
+		tokens  []*Token
+		errored bool
+
+		// If collect is true, errors are stored in errorTokens and
+		// lexing continues behind the broken tag/variable
+		collect     bool
+		errorTokens []*Token
+
+		// If trivia is true, comments and whitespace within tags/variables
+		// are emitted as tokens, strings keep their quotes and escape
+		// sequences and verbatim sections are kept as part of the HTML
+		trivia bool
+
 		startline int
 		startcol  int
 		line      int
@@ -99,6 +114,10 @@ func (t *Token) String() string {
 		typ = "Symbol"
 	case TokenNil:
 		typ = "Nil"
+	case TokenComment:
+		typ = "Comment"
+	case TokenWhitespace:
+		typ = "Whitespace"
 	default:
 		typ = "Unknown"
 	}
@@ -119,18 +138,63 @@ func lex(name, input string) ([]*Token, *Error) {
 	}
 	l.run()
 	if l.errored {
-		errtoken := l.tokens[len(l.tokens)-1]
-		return nil, &Error{
-			Filename:  name,
-			Line:      errtoken.Line,
-			Column:    errtoken.Col,
-			Sender:    "lexer",
-			OrigError: errors.New(errtoken.Val),
-		}
+		return nil, newLexerError(l.tokens[len(l.tokens)-1])
+	}
+	return l.tokens, nil
+}
+
+// lexAll is like lex, but doesn't stop at the first error. Broken
+// tags/variables are left out of the returned tokens.
+func lexAll(name, input string) ([]*Token, []*Error) {
+	l := &lexer{
+		name:      name,
+		input:     input,
+		tokens:    make([]*Token, 0, 100),
+		line:      1,
+		col:       1,
+		startline: 1,
+		startcol:  1,
+		collect:   true,
+	}
+	l.run()
+	var errs []*Error
+	for _, t := range l.errorTokens {
+		errs = append(errs, newLexerError(t))
+	}
+	return l.tokens, errs
+}
+
+// lexTrivia is like lex, but keeps the trivia required to reproduce the
+// source (see lexer.trivia).
+func lexTrivia(name, input string) ([]*Token, *Error) {
+	l := &lexer{
+		name:      name,
+		input:     input,
+		tokens:    make([]*Token, 0, 100),
+		line:      1,
+		col:       1,
+		startline: 1,
+		startcol:  1,
+		trivia:    true,
+	}
+	l.run()
+	if l.errored {
+		return nil, newLexerError(l.tokens[len(l.tokens)-1])
 	}
 	return l.tokens, nil
 }
 
+func newLexerError(errtoken *Token) *Error {
+	return &Error{
+		Filename:  errtoken.Filename,
+		Line:      errtoken.Line,
+		Column:    errtoken.Col,
+		Sender:    "lexer",
+		Kind:      ErrorKindLex,
+		OrigError: errors.New(errtoken.Val),
+	}
+}
+
 func (l *lexer) value() string {
 	return l.input[l.start:l.pos]
 }
@@ -148,7 +212,7 @@ func (l *lexer) emit(t TokenType) {
 		Col:      l.startcol,
 	}
 
-	if t == TokenString {
+	if t == TokenString && !l.trivia {
 		// Escape sequence \" in strings
 		tok.Val = strings.Replace(tok.Val, `\"`, `"`, -1)
 		tok.Val = strings.Replace(tok.Val, `\\`, `\`, -1)
@@ -216,8 +280,12 @@ func (l *lexer) errorf(format string, args ...any) lexerStateFn {
 		Line:     l.startline,
 		Col:      l.startcol,
 	}
-	l.tokens = append(l.tokens, t)
-	l.errored = true
+	if l.collect {
+		l.errorTokens = append(l.errorTokens, t)
+	} else {
+		l.tokens = append(l.tokens, t)
+		l.errored = true
+	}
 	l.startline = l.line
 	l.startcol = l.col
 	return nil
@@ -233,24 +301,28 @@ func (l *lexer) run() {
 				name += " "
 			}
 			if strings.HasPrefix(l.input[l.pos:], fmt.Sprintf("{%% endverbatim %s%%}", name)) { // end verbatim
-				if l.pos > l.start {
+				if l.pos > l.start && !l.trivia {
 					l.emit(TokenHTML)
 				}
 				w := len("{% endverbatim %}")
 				l.pos += w
 				l.col += w
-				l.ignore()
+				if !l.trivia {
+					l.ignore()
+				}
 				l.inVerbatim = false
 			}
 		} else if strings.HasPrefix(l.input[l.pos:], "{% verbatim %}") { // tag
-			if l.pos > l.start {
+			if l.pos > l.start && !l.trivia {
 				l.emit(TokenHTML)
 			}
 			l.inVerbatim = true
 			w := len("{% verbatim %}")
 			l.pos += w
 			l.col += w
-			l.ignore()
+			if !l.trivia {
+				l.ignore()
+			}
 		}
 
 		if !l.inVerbatim {
@@ -263,6 +335,7 @@ func (l *lexer) run() {
 				l.pos += 2 // pass '{#'
 				l.col += 2
 
+			comment:
 				for {
 					switch l.peek() {
 					case EOF:
@@ -270,7 +343,11 @@ func (l *lexer) run() {
 						return
 					case '\n':
 						l.errorf("Newline not permitted in a single-line comment.")
-						return
+						if !l.collect {
+							return
+						}
+						// Ignore the broken comment up to the newline
+						break comment
 					}
 
 					if strings.HasPrefix(l.input[l.pos:], "#}") {
@@ -281,7 +358,11 @@ func (l *lexer) run() {
 
 					l.next()
 				}
-				l.ignore() // ignore whole comment
+				if l.trivia {
+					l.emit(TokenComment)
+				} else {
+					l.ignore() // ignore whole comment
+				}
 
 				// Comment skipped
 				continue // next token
@@ -292,10 +373,16 @@ func (l *lexer) run() {
 				if l.pos > l.start {
 					l.emit(TokenHTML)
 				}
+				tagStart, errCount := len(l.tokens), len(l.errorTokens)
 				l.tokenize()
 				if l.errored {
 					return
 				}
+				if len(l.errorTokens) > errCount {
+					// Drop the broken tag/variable and continue behind it
+					l.tokens = l.tokens[:tagStart]
+					l.skipBrokenCode()
+				}
 				continue
 			}
 		}
@@ -319,6 +406,24 @@ func (l *lexer) run() {
 	}
 }
 
+// skipBrokenCode skips the rest of a tag/variable after an error (in collect
+// mode): up to its end if it's on the same line, otherwise up to the newline.
+func (l *lexer) skipBrokenCode() {
+	rest := l.input[l.pos:]
+	if nl := strings.IndexByte(rest, '\n'); nl >= 0 {
+		rest = rest[:nl]
+	}
+	skip := len(rest)
+	for _, end := range []string{"%}", "}}"} {
+		if i := strings.Index(rest, end); i >= 0 && i+len(end) < skip {
+			skip = i + len(end)
+		}
+	}
+	l.pos += skip
+	l.col += skip
+	l.ignore()
+}
+
 func (l *lexer) tokenize() {
 	for state := l.stateCode; state != nil; {
 		state = state()
@@ -331,9 +436,15 @@ outer_loop:
 		switch {
 		case l.accept(tokenSpaceChars):
 			if l.value() == "\n" {
+				l.backup() // keep line counting intact in collect mode
 				return l.errorf("Newline not allowed within tag/variable.")
 			}
-			l.ignore()
+			if l.trivia {
+				l.acceptRun(" \r\t")
+				l.emit(TokenWhitespace)
+			} else {
+				l.ignore()
+			}
 			continue
 		case l.accept(tokenIdentifierChars):
 			return l.stateIdentifier
@@ -410,8 +521,10 @@ func (l *lexer) stateNumber() lexerStateFn {
 
 func (l *lexer) stateString() lexerStateFn {
 	quotationMark := l.value()
-	l.ignore()
-	l.startcol-- // we're starting the position at the first "
+	if !l.trivia {
+		l.ignore()
+		l.startcol-- // we're starting the position at the first "
+	}
 	for !l.accept(quotationMark) {
 		switch l.next() {
 		case '\\':
@@ -425,9 +538,15 @@ func (l *lexer) stateString() lexerStateFn {
 		case EOF:
 			return l.errorf("Unexpected EOF, string not closed.")
 		case '\n':
+			l.backup() // keep line counting intact in collect mode
 			return l.errorf("Newline in string is not allowed.")
 		}
 	}
+	if l.trivia {
+		// Keep the quotation marks
+		l.emit(TokenString)
+		return l.stateCode
+	}
 	l.backup()
 	l.emit(TokenString)
 
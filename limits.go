@@ -0,0 +1,213 @@
+package pongo2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Limits define execution budgets for templates of a TemplateSet. They are
+// meant to be used in addition to BanTag()/BanFilter() when executing
+// untrusted templates. A zero value means "unlimited".
+//
+// Exceeding a budget aborts the execution with an *Error whose Sender is
+// one of "limit:output", "limit:loop", "limit:nodes" or "limit:exec".
+type Limits struct {
+	// MaxOutputBytes is the maximum number of bytes a single execution may
+	// write to its TemplateWriter (including included templates). Output
+	// held in intermediate buffers (e. g. by the filter-, spaceless- and
+	// macro-tags or included templates) counts as well while it's buffered.
+	MaxOutputBytes int
+
+	// MaxLoopIterations is the maximum number of for-loop iterations summed
+	// up over all loops of a single execution.
+	MaxLoopIterations int
+
+	// MaxNodeEvaluations is the maximum number of nodes (HTML, variables
+	// and tags) a single execution may execute.
+	MaxNodeEvaluations int
+
+	// MaxExecDepth is the maximum nesting depth of {% exec %}-tags.
+	MaxExecDepth int
+}
+
+// executionState is shared between all ExecutionContexts (including the ones
+// of included templates) belonging to one top-level execution.
+type executionState struct {
+	goCtx  context.Context
+	limits Limits
+
+	outputBytes     int64
+	loopIterations  int64
+	nodeEvaluations int64
+
+	// Streaming output (see flushWriter())
+	flusher     *flushingTemplateWriter
+	flushBlocks bool
+	blockDepth  int32 // accessed atomically
+
+	// Slots for includes rendered in parallel (see Options.ParallelIncludes),
+	// nil if disabled
+	includeSlots chan struct{}
+
+	// Decoded json.RawMessage documents (see jsonDocument()), nil if they
+	// failed to decode
+	jsonMu   sync.Mutex
+	jsonDocs map[jsonDocumentKey]any
+}
+
+func newExecutionState(goCtx context.Context, limits Limits) *executionState {
+	if goCtx == nil {
+		// Like the standard library does for nil contexts (e. g. passed to
+		// ExecuteContext), treat it as context.Background()
+		goCtx = context.Background()
+	}
+	s := executionStatePool.Get().(*executionState)
+	s.goCtx, s.limits = goCtx, limits
+	return s
+}
+
+// limitWriter wraps writer so the output budget is enforced, if configured.
+func (s *executionState) limitWriter(writer TemplateWriter) TemplateWriter {
+	if s.limits.MaxOutputBytes <= 0 {
+		return writer
+	}
+	return &limitedTemplateWriter{
+		w:     writer,
+		state: s,
+	}
+}
+
+type limitedTemplateWriter struct {
+	w     TemplateWriter
+	state *executionState
+}
+
+// reserveOutput takes n bytes from the output budget.
+func (s *executionState) reserveOutput(n int) error {
+	max := s.limits.MaxOutputBytes
+	if atomic.AddInt64(&s.outputBytes, int64(n)) > int64(max) {
+		return &Error{
+			Sender:    "limit:output",
+			Kind:      ErrorKindLimit,
+			OrigError: fmt.Errorf("maximum output size exceeded (max is %d bytes)", max),
+		}
+	}
+	return nil
+}
+
+func (lw *limitedTemplateWriter) WriteString(s string) (int, error) {
+	if err := lw.state.reserveOutput(len(s)); err != nil {
+		return 0, err
+	}
+	return lw.w.WriteString(s)
+}
+
+func (lw *limitedTemplateWriter) Write(b []byte) (int, error) {
+	if err := lw.state.reserveOutput(len(b)); err != nil {
+		return 0, err
+	}
+	return lw.w.Write(b)
+}
+
+// limitedBuffer is an intermediate buffer (e. g. the body of a filter-tag
+// or a rendered include) whose content counts against the output budget
+// until it's released, so MaxOutputBytes limits the memory held by the
+// buffers of an execution as well. Release it before its content (or what
+// it's turned into) is written to the output, which counts it again.
+type limitedBuffer struct {
+	*bytes.Buffer
+	state    *executionState
+	reserved int64
+}
+
+// getBuffer returns a limitedBuffer from the pool with room for at least
+// size bytes. Return it with put().
+func (s *executionState) getBuffer(size int) *limitedBuffer {
+	b := limitedBufferPool.Get().(*limitedBuffer)
+	b.state = s
+	b.Grow(size)
+	return b
+}
+
+func (b *limitedBuffer) reserve(n int) error {
+	if b.state.limits.MaxOutputBytes <= 0 {
+		return nil
+	}
+	if err := b.state.reserveOutput(n); err != nil {
+		return err
+	}
+	b.reserved += int64(n)
+	return nil
+}
+
+func (b *limitedBuffer) WriteString(s string) (int, error) {
+	if err := b.reserve(len(s)); err != nil {
+		return 0, err
+	}
+	return b.Buffer.WriteString(s)
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if err := b.reserve(len(p)); err != nil {
+		return 0, err
+	}
+	return b.Buffer.Write(p)
+}
+
+// release gives the budget taken by the content back. The content stays.
+func (b *limitedBuffer) release() {
+	if b.reserved > 0 {
+		atomic.AddInt64(&b.state.outputBytes, -b.reserved)
+		b.reserved = 0
+	}
+}
+
+// put releases the buffer and returns it to the pool.
+func (b *limitedBuffer) put() {
+	b.release()
+	if b.Cap() > maxPooledBufferSize {
+		return
+	}
+	b.Reset()
+	b.state = nil
+	limitedBufferPool.Put(b)
+}
+
+func (ctx *ExecutionContext) limitError(sender string, err error, token *Token) *Error {
+	e := ctx.Error(err, token)
+	e.Sender = sender
+	e.Kind = ErrorKindLimit
+	return e
+}
+
+// enterNode must be called before executing a node. It aborts the execution
+// on cancellation or if the node evaluation budget is exhausted.
+func (ctx *ExecutionContext) enterNode() *Error {
+	if err := ctx.checkCancelled(nil); err != nil {
+		return err
+	}
+	if max := ctx.state.limits.MaxNodeEvaluations; max > 0 {
+		if atomic.AddInt64(&ctx.state.nodeEvaluations, 1) > int64(max) {
+			return ctx.limitError("limit:nodes",
+				fmt.Errorf("maximum number of node evaluations exceeded (max is %d)", max), nil)
+		}
+	}
+	return nil
+}
+
+// enterLoopIteration must be called before each iteration of a loop.
+func (ctx *ExecutionContext) enterLoopIteration(token *Token) *Error {
+	if err := ctx.checkCancelled(token); err != nil {
+		return err
+	}
+	if max := ctx.state.limits.MaxLoopIterations; max > 0 {
+		if atomic.AddInt64(&ctx.state.loopIterations, 1) > int64(max) {
+			return ctx.limitError("limit:loop",
+				fmt.Errorf("maximum number of loop iterations exceeded (max is %d)", max), token)
+		}
+	}
+	return nil
+}
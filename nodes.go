@@ -6,11 +6,5 @@ type nodeDocument struct {
 }
 
 func (doc *nodeDocument) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	for _, n := range doc.Nodes {
-		err := n.Execute(ctx, writer)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return executeNodes(ctx, doc.Nodes, writer)
 }
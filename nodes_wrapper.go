@@ -6,11 +6,30 @@ type NodeWrapper struct {
 }
 
 func (wrapper *NodeWrapper) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	for _, n := range wrapper.nodes {
-		err := n.Execute(ctx, writer)
-		if err != nil {
-			return err
-		}
+	return executeNodes(ctx, wrapper.nodes, writer)
+}
+
+// tagBodies are the bodies of a tag executed with a child context (like the
+// for-tag's body and its empty body): node wrappers or the code of a
+// template compiled to Go code (see Runtime).
+type tagBodies interface {
+	executeBody(ctx *ExecutionContext) *Error
+	executeEmpty(ctx *ExecutionContext) *Error
+}
+
+// wrapperBodies executes node wrappers (empty may be nil).
+type wrapperBodies struct {
+	body, empty *NodeWrapper
+	writer      TemplateWriter
+}
+
+func (b *wrapperBodies) executeBody(ctx *ExecutionContext) *Error {
+	return b.body.Execute(ctx, b.writer)
+}
+
+func (b *wrapperBodies) executeEmpty(ctx *ExecutionContext) *Error {
+	if b.empty == nil {
+		return nil
 	}
-	return nil
+	return b.empty.Execute(ctx, b.writer)
 }
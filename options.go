@@ -1,5 +1,33 @@
 package pongo2
 
+// UndefinedPolicy defines how variables (or parts of a variable path)
+// which can't be resolved are treated during execution. It doesn't apply to
+// variables directly filtered by default or default_if_none (which resolve
+// to nil then) and to the "is defined" test ({% if user is defined %} or
+// {{ user is not defined }}), which handle undefined variables themselves.
+type UndefinedPolicy int
+
+const (
+	// UndefinedDefault is pongo2's historic behavior: a missing top-level
+	// variable or struct field/map key (accessed with a dot) is an error,
+	// while nil pointers, out-of-range indexes and missing subscript
+	// keys silently resolve to nil.
+	UndefinedDefault UndefinedPolicy = iota
+
+	// UndefinedStrict makes every unresolvable part of a variable path an
+	// execution error naming the full path.
+	UndefinedStrict
+
+	// UndefinedLenient resolves every unresolvable variable to nil (which
+	// renders as an empty string).
+	UndefinedLenient
+
+	// UndefinedChainable behaves like UndefinedLenient, but resolves to a
+	// dedicated undefined value (see Value.IsUndefined) which stays
+	// undefined on any further lookup, like Jinja's ChainableUndefined.
+	UndefinedChainable
+)
+
 // Options allow you to change the behavior of template-engine.
 // You can change the options before calling the Execute method.
 type Options struct {
@@ -8,12 +36,66 @@ type Options struct {
 
 	// If this is set to true leading spaces and tabs are stripped from the start of a line to a block. Defaults to false
 	LStripBlocks bool
+
+	// UndefinedPolicy defines how unresolvable variables are treated. Defaults to UndefinedDefault.
+	// The allowmissingval-tag makes pongo2 behave like UndefinedLenient within its body.
+	UndefinedPolicy UndefinedPolicy
+
+	// FlushBytes, if greater than 0, flushes the output after at least this
+	// many bytes have been written since the last flush. FlushBlocks flushes
+	// the output after each top-level block (a block which isn't nested in
+	// another one). Both only apply to ExecuteWriterUnbuffered() with a
+	// writer which can be flushed, like an http.ResponseWriter (http.Flusher)
+	// or a *bufio.Writer, so large pages are sent progressively. See also
+	// the flush-tag.
+	FlushBytes  int
+	FlushBlocks bool
+
+	// ParallelIncludes, if greater than 1, is the number of included
+	// templates rendered concurrently (in addition to the executing
+	// goroutine). An include is rendered ahead of time if no node before it
+	// (in the same tag body) may change the context, like set, import, macro
+	// or block do, and if the included template doesn't use the cycle or
+	// ifchanged tag (which keep state between executions) or lazy includes.
+	// The output stays the same, but functions called by templates and custom
+	// tags must be safe for concurrent use then. Defaults to 0 (disabled).
+	ParallelIncludes int
+
+	// ContextualAutoescape makes autoescaping escape variables according to
+	// where they're located in the HTML: in text and attribute values
+	// (HTML escaping), in script elements and event handler attributes
+	// (JavaScript values or string literals), in style elements and
+	// attributes (CSS) and in URL attributes like href (URL encoding; unsafe
+	// schemes like javascript: are replaced by "#ZgotmplZ"). The escapejs,
+	// urlencode/iriencode and escape filters are recognized as escaping for
+	// their context already. Defaults to false (HTML escaping everywhere).
+	ContextualAutoescape bool
+
+	// Escaper is the name of the escaper used for autoescaping variables:
+	// "html" (default), "json", "yaml", "csv", "shell", "latex", "none"
+	// (no autoescaping) or one registered using RegisterEscaper(). The
+	// autoescape-tag switches escapers within a template, for example
+	// {% autoescape "json" %}. Contextual autoescaping only applies to the
+	// html escaper.
+	Escaper string
+
+	// JSONOutput makes templates render JSON documents: variables are
+	// output as JSON values (strings are quoted, nil is null, lists and maps
+	// are serialized) or, inside string literals of the template, escaped
+	// for them (the escapejs filter is recognized as doing so already). The
+	// escaper defaults to "json" then. The output of Execute(),
+	// ExecuteBytes() and ExecuteWriter() is validated; malformed output
+	// results in an error wrapping a *JSONOutputError, which contains the
+	// position in the output. ExecuteWriterUnbuffered() returns this error as
+	// well, but after the output has been written. Defaults to false.
+	JSONOutput bool
 }
 
 func newOptions() *Options {
 	return &Options{
-		TrimBlocks:   false,
-		LStripBlocks: false,
+		TrimBlocks:      false,
+		LStripBlocks:    false,
+		UndefinedPolicy: UndefinedDefault,
 	}
 }
 
@@ -21,6 +103,13 @@ func newOptions() *Options {
 func (opt *Options) Update(other *Options) *Options {
 	opt.TrimBlocks = other.TrimBlocks
 	opt.LStripBlocks = other.LStripBlocks
+	opt.UndefinedPolicy = other.UndefinedPolicy
+	opt.FlushBytes = other.FlushBytes
+	opt.FlushBlocks = other.FlushBlocks
+	opt.ParallelIncludes = other.ParallelIncludes
+	opt.ContextualAutoescape = other.ContextualAutoescape
+	opt.Escaper = other.Escaper
+	opt.JSONOutput = other.JSONOutput
 
 	return opt
 }
@@ -198,6 +198,7 @@ func (p *Parser) Error(err error, token *Token) *Error {
 		Template:  p.template,
 		Filename:  p.name,
 		Sender:    "parser",
+		Kind:      ErrorKindParse,
 		Line:      line,
 		Column:    col,
 		Token:     token,
@@ -205,6 +206,75 @@ func (p *Parser) Error(err error, token *Token) *Error {
 	}
 }
 
+// sandboxError is like Error, but classifies the error as sandbox restriction.
+func (p *Parser) sandboxError(err error, token *Token) *Error {
+	e := p.Error(err, token)
+	e.Kind = ErrorKindSandbox
+	return e
+}
+
+// recoverFrom records err and skips the broken element starting at token
+// index start, if the template collects all errors (see
+// TemplateSet.FromStringAll()). Otherwise it returns false and the
+// error must be returned as usual.
+func (p *Parser) recoverFrom(err *Error, start int) bool {
+	tpl := p.template
+	if tpl == nil || !tpl.collectErrors {
+		return false
+	}
+	if !p.isFollowUpError(start) {
+		tpl.parseErrors = append(tpl.parseErrors, err.setKindIfUnknown(ErrorKindParse))
+	}
+
+	// Skip the rest of the broken tag/variable
+	if p.idx <= start {
+		p.idx = start + 1
+	}
+	for p.idx < len(p.tokens) {
+		prev := p.tokens[p.idx-1]
+		if prev.Typ == TokenSymbol && (prev.Val == "%}" || prev.Val == "}}") {
+			break
+		}
+		t := p.tokens[p.idx]
+		if t.Typ == TokenHTML || (t.Typ == TokenSymbol && (t.Val == "{%" || t.Val == "{{")) {
+			break
+		}
+		p.idx++
+	}
+	return true
+}
+
+// isFollowUpError reports whether the broken element at token index start
+// is the end tag (or an intermediate tag like else) of a block tag which
+// failed to parse before, so the error is just a consequence of the
+// former one. Other failed tags are remembered for this purpose.
+func (p *Parser) isFollowUpError(start int) bool {
+	if start+1 >= len(p.tokens) || p.tokens[start].Val != "{%" {
+		return false
+	}
+	name := p.tokens[start+1].Val
+	tpl := p.template
+	if _, exists := tpl.set.lookupTag(name); exists {
+		if tpl.pendingEndTags == nil {
+			tpl.pendingEndTags = make(map[string]int)
+		}
+		tpl.pendingEndTags["end"+name]++
+		return false
+	}
+	if tpl.pendingEndTags[name] > 0 {
+		tpl.pendingEndTags[name]--
+		if tpl.pendingEndTags[name] == 0 {
+			delete(tpl.pendingEndTags, name)
+		}
+		return true
+	}
+	switch name {
+	case "else", "elif", "empty", "plural":
+		return len(tpl.pendingEndTags) > 0
+	}
+	return false
+}
+
 // Wraps all nodes between starting tag and "{% endtag %}" and provides
 // one simple interface to execute the wrapped nodes.
 // It returns a parser to process provided arguments to the tag.
@@ -253,8 +323,12 @@ func (p *Parser) WrapUntilTag(names ...string) (*NodeWrapper, *Parser, *Error) {
 		}
 
 		// Otherwise process next element to be wrapped
+		start := p.idx
 		node, err := p.parseDocElement()
 		if err != nil {
+			if p.recoverFrom(err, start) {
+				continue
+			}
 			return nil, nil, err
 		}
 		wrapper.nodes = append(wrapper.nodes, node)
@@ -43,15 +43,19 @@ func (tpl *Template) parse() *Error {
 		return err
 	}
 	tpl.root = doc
-	return nil
+	return tpl.computeEscapeContexts()
 }
 
 func (p *Parser) parseDocument() (*nodeDocument, *Error) {
 	doc := &nodeDocument{}
 
 	for p.Remaining() > 0 {
+		start := p.idx
 		node, err := p.parseDocElement()
 		if err != nil {
+			if p.recoverFrom(err, start) {
+				continue
+			}
 			return nil, err
 		}
 		doc.Nodes = append(doc.Nodes, node)
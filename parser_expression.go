@@ -173,23 +173,23 @@ func (expr *Expression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 		switch expr.opToken.Val {
 		case "and", "&&":
 			if !v1.IsTrue() {
-				return AsValue(false), nil
+				return sharedValue(false), nil
 			} else {
 				v2, err := expr.expr2.Evaluate(ctx)
 				if err != nil {
 					return nil, err
 				}
-				return AsValue(v2.IsTrue()), nil
+				return sharedValue(v2.IsTrue()), nil
 			}
 		case "or", "||":
 			if v1.IsTrue() {
-				return AsValue(true), nil
+				return sharedValue(true), nil
 			} else {
 				v2, err := expr.expr2.Evaluate(ctx)
 				if err != nil {
 					return nil, err
 				}
-				return AsValue(v2.IsTrue()), nil
+				return sharedValue(v2.IsTrue()), nil
 			}
 		default:
 			return nil, ctx.Error(fmt.Errorf("unimplemented: %s", expr.opToken.Val), expr.opToken)
@@ -200,6 +200,15 @@ func (expr *Expression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 }
 
 func (expr *relationalExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
+	if expr.expr2 == nil && expr.opToken != nil {
+		// expr1 is defined
+		_, defined, err := evaluateDefined(ctx, expr.expr1)
+		if err != nil {
+			return nil, err
+		}
+		return sharedValue(defined), nil
+	}
+
 	v1, err := expr.expr1.Evaluate(ctx)
 	if err != nil {
 		return nil, err
@@ -209,52 +218,59 @@ func (expr *relationalExpression) Evaluate(ctx *ExecutionContext) (*Value, *Erro
 		if err != nil {
 			return nil, err
 		}
-		switch expr.opToken.Val {
-		case "<=":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() <= v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				tm1, tm2 := v1.Time(), v2.Time()
-				return AsValue(tm1.Before(tm2) || tm1.Equal(tm2)), nil
-			}
-			return AsValue(v1.Integer() <= v2.Integer()), nil
-		case ">=":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() >= v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				tm1, tm2 := v1.Time(), v2.Time()
-				return AsValue(tm1.After(tm2) || tm1.Equal(tm2)), nil
-			}
-			return AsValue(v1.Integer() >= v2.Integer()), nil
-		case "==":
-			return AsValue(v1.EqualValueTo(v2)), nil
-		case ">":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() > v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				return AsValue(v1.Time().After(v2.Time())), nil
-			}
-			return AsValue(v1.Integer() > v2.Integer()), nil
-		case "<":
-			if v1.IsFloat() || v2.IsFloat() {
-				return AsValue(v1.Float() < v2.Float()), nil
-			}
-			if v1.IsTime() && v2.IsTime() {
-				return AsValue(v1.Time().Before(v2.Time())), nil
-			}
-			return AsValue(v1.Integer() < v2.Integer()), nil
-		case "!=", "<>":
-			return AsValue(!v1.EqualValueTo(v2)), nil
-		case "in":
-			return AsValue(v2.Contains(v1)), nil
-		default:
-			return nil, ctx.Error(fmt.Errorf("unimplemented: %s", expr.opToken.Val), expr.opToken)
+		return expr.compare(ctx, v1, v2)
+	}
+	return v1, nil
+}
+
+// compare applies the operator to the evaluated operands.
+func (expr *relationalExpression) compare(ctx *ExecutionContext, v1, v2 *Value) (*Value, *Error) {
+	switch expr.opToken.Val {
+	case "<=":
+		if v1.IsFloat() || v2.IsFloat() {
+			return sharedValue(v1.Float() <= v2.Float()), nil
 		}
-	} else {
-		return v1, nil
+		if v1.IsTime() && v2.IsTime() {
+			tm1, tm2 := v1.Time(), v2.Time()
+			return sharedValue(tm1.Before(tm2) || tm1.Equal(tm2)), nil
+		}
+		return sharedValue(v1.Integer() <= v2.Integer()), nil
+	case ">=":
+		if v1.IsFloat() || v2.IsFloat() {
+			return sharedValue(v1.Float() >= v2.Float()), nil
+		}
+		if v1.IsTime() && v2.IsTime() {
+			tm1, tm2 := v1.Time(), v2.Time()
+			return sharedValue(tm1.After(tm2) || tm1.Equal(tm2)), nil
+		}
+		return sharedValue(v1.Integer() >= v2.Integer()), nil
+	case "==":
+		return sharedValue(v1.EqualValueTo(v2)), nil
+	case ">":
+		if v1.IsFloat() || v2.IsFloat() {
+			return sharedValue(v1.Float() > v2.Float()), nil
+		}
+		if v1.IsTime() && v2.IsTime() {
+			return sharedValue(v1.Time().After(v2.Time())), nil
+		}
+		return sharedValue(v1.Integer() > v2.Integer()), nil
+	case "<":
+		if v1.IsFloat() || v2.IsFloat() {
+			return sharedValue(v1.Float() < v2.Float()), nil
+		}
+		if v1.IsTime() && v2.IsTime() {
+			return sharedValue(v1.Time().Before(v2.Time())), nil
+		}
+		return sharedValue(v1.Integer() < v2.Integer()), nil
+	case "!=", "<>":
+		return sharedValue(!v1.EqualValueTo(v2)), nil
+	case "in":
+		if err := checkContains(ctx, v2, v1); err != nil {
+			return nil, ctx.Error(err, expr.opToken)
+		}
+		return sharedValue(v2.Contains(v1)), nil
+	default:
+		return nil, ctx.Error(fmt.Errorf("unimplemented: %s", expr.opToken.Val), expr.opToken)
 	}
 }
 
@@ -263,6 +279,19 @@ func (expr *simpleExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 	if err != nil {
 		return nil, err
 	}
+	var t2 *Value
+	if expr.term2 != nil {
+		t2, err = expr.term2.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expr.apply(ctx, t1, t2)
+}
+
+// apply applies the signs and the operator to the evaluated terms (t2 is
+// nil without a second term).
+func (expr *simpleExpression) apply(ctx *ExecutionContext, t1, t2 *Value) (*Value, *Error) {
 	result := t1
 
 	if expr.negate {
@@ -273,9 +302,9 @@ func (expr *simpleExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 		if result.IsNumber() {
 			switch {
 			case result.IsFloat():
-				result = AsValue(-1 * result.Float())
+				result = sharedValue(-1 * result.Float())
 			case result.IsInteger():
-				result = AsValue(-1 * result.Integer())
+				result = sharedValue(-1 * result.Integer())
 			default:
 				return nil, ctx.Error(fmt.Errorf("Operation between a number and a non-(float/integer) is not possible"), nil)
 			}
@@ -284,30 +313,26 @@ func (expr *simpleExpression) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 		}
 	}
 
-	if expr.term2 != nil {
-		t2, err := expr.term2.Evaluate(ctx)
-		if err != nil {
-			return nil, err
-		}
+	if t2 != nil {
 		switch expr.opToken.Val {
 		case "+":
 			if result.IsString() || t2.IsString() {
 				// Result will be a string
-				return AsValue(result.String() + t2.String()), nil
+				return sharedValue(result.String() + t2.String()), nil
 			}
 			if result.IsFloat() || t2.IsFloat() {
 				// Result will be a float
-				return AsValue(result.Float() + t2.Float()), nil
+				return sharedValue(result.Float() + t2.Float()), nil
 			}
 			// Result will be an integer
-			return AsValue(result.Integer() + t2.Integer()), nil
+			return sharedValue(result.Integer() + t2.Integer()), nil
 		case "-":
 			if result.IsFloat() || t2.IsFloat() {
 				// Result will be a float
-				return AsValue(result.Float() - t2.Float()), nil
+				return sharedValue(result.Float() - t2.Float()), nil
 			}
 			// Result will be an integer
-			return AsValue(result.Integer() - t2.Integer()), nil
+			return sharedValue(result.Integer() - t2.Integer()), nil
 		default:
 			return nil, ctx.Error(fmt.Errorf("Unimplemented"), expr.GetPositionToken())
 		}
@@ -335,41 +360,45 @@ func (expr *term) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 		if err != nil {
 			return nil, err
 		}
-		switch expr.opToken.Val {
-		case "*":
-			if f1.IsFloat() || f2.IsFloat() {
-				// Result will be float
-				return AsValue(f1.Float() * f2.Float()), nil
-			}
-			// Result will be int
-			return AsValue(f1.Integer() * f2.Integer()), nil
-		case "/":
-			if f1.IsFloat() || f2.IsFloat() {
-				// Result will be float
-				divisor := f2.Float()
-				if divisor == 0 {
-					return nil, ctx.Error(fmt.Errorf("float divide by zero"), expr.factor2.GetPositionToken())
-				}
-				return AsValue(f1.Float() / divisor), nil
-			}
-			// Result will be int
-			divisor := f2.Integer()
-			if divisor == 0 {
-				return nil, ctx.Error(fmt.Errorf("integer divide by zero"), expr.factor2.GetPositionToken())
-			}
-			return AsValue(f1.Integer() / divisor), nil
-		case "%":
-			// Result will be int
-			divisor := f2.Integer()
+		return expr.apply(ctx, f1, f2)
+	}
+	return f1, nil
+}
+
+// apply applies the operator to the evaluated factors.
+func (expr *term) apply(ctx *ExecutionContext, f1, f2 *Value) (*Value, *Error) {
+	switch expr.opToken.Val {
+	case "*":
+		if f1.IsFloat() || f2.IsFloat() {
+			// Result will be float
+			return sharedValue(f1.Float() * f2.Float()), nil
+		}
+		// Result will be int
+		return sharedValue(f1.Integer() * f2.Integer()), nil
+	case "/":
+		if f1.IsFloat() || f2.IsFloat() {
+			// Result will be float
+			divisor := f2.Float()
 			if divisor == 0 {
-				return nil, ctx.Error(fmt.Errorf("integer divide by zero"), expr.factor2.GetPositionToken())
+				return nil, ctx.Error(fmt.Errorf("float divide by zero"), expr.factor2.GetPositionToken())
 			}
-			return AsValue(f1.Integer() % divisor), nil
-		default:
-			return nil, ctx.Error(fmt.Errorf("unimplemented"), expr.opToken)
+			return sharedValue(f1.Float() / divisor), nil
 		}
-	} else {
-		return f1, nil
+		// Result will be int
+		divisor := f2.Integer()
+		if divisor == 0 {
+			return nil, ctx.Error(fmt.Errorf("integer divide by zero"), expr.factor2.GetPositionToken())
+		}
+		return sharedValue(f1.Integer() / divisor), nil
+	case "%":
+		// Result will be int
+		divisor := f2.Integer()
+		if divisor == 0 {
+			return nil, ctx.Error(fmt.Errorf("integer divide by zero"), expr.factor2.GetPositionToken())
+		}
+		return sharedValue(f1.Integer() % divisor), nil
+	default:
+		return nil, ctx.Error(fmt.Errorf("unimplemented"), expr.opToken)
 	}
 }
 
@@ -383,7 +412,7 @@ func (expr *power) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
 		if err != nil {
 			return nil, err
 		}
-		return AsValue(math.Pow(p1.Float(), p2.Float())), nil
+		return sharedValue(math.Pow(p1.Float(), p2.Float())), nil
 	}
 	return p1, nil
 }
@@ -567,6 +596,23 @@ func (p *Parser) parseRelationalExpression() (IEvaluator, *Error) {
 		}
 		expr.opToken = t
 		expr.expr2 = expr2
+	} else if t := p.Match(TokenIdentifier, "is"); t != nil {
+		// expr1 is [not] defined: the opToken without expr2
+		negate := p.Match(TokenKeyword, "not") != nil
+		if p.Match(TokenIdentifier, "defined") == nil {
+			return nil, p.Error(fmt.Errorf("Expected 'defined' after 'is'."), nil)
+		}
+		expr.opToken = t
+
+		// "not x is defined" negates the test, not x
+		if simple, ok := expr1.(*simpleExpression); ok && simple.negate && !simple.negativeSign && simple.term2 == nil {
+			expr.expr1 = simple.term1
+			negate = !negate
+		}
+		if negate {
+			return &simpleExpression{negate: true, term1: expr}, nil
+		}
+		return expr, nil
 	}
 
 	if expr.expr2 == nil {
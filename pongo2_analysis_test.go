@@ -0,0 +1,60 @@
+package pongo2_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func TestAnalyze(t *testing.T) {
+	tpl, err := pongo2.FromString(`{% set greeting = "Hello" %}{{ greeting }} {{ user.profile.name|lower|default:fallback }}
+{% for item in order.items %}{{ item.price }}{{ forloop.Counter }}{{ order["id"] }}{{ lookup[item.key] }}{% endfor %}
+{% macro card(title, body=default_body) %}{{ title }}{{ body }}{{ site.name }}{% endmacro %}{{ card(headline) }}
+{% with total=order.total %}{{ total|floatformat:precision }}{% endwith %}
+{% include tpl_name with x=extra %}{% filter upper %}{{ footer }}{% endfilter %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := tpl.Analyze()
+
+	wantVars := []string{
+		"default_body", "extra", "fallback", "footer", "headline", "lookup", "order.id",
+		"order.items", "order.total", "precision", "site.name", "tpl_name", "user.profile.name",
+	}
+	if got := a.VariableNames(); !reflect.DeepEqual(got, wantVars) {
+		t.Errorf("VariableNames() = %v, want %v", got, wantVars)
+	}
+
+	wantFilters := []string{"default", "floatformat", "lower", "upper"}
+	if got := a.FilterNames(); !reflect.DeepEqual(got, wantFilters) {
+		t.Errorf("FilterNames() = %v, want %v", got, wantFilters)
+	}
+
+	wantTags := []string{"filter", "for", "include", "macro", "set", "with"}
+	if got := a.TagNames(); !reflect.DeepEqual(got, wantTags) {
+		t.Errorf("TagNames() = %v, want %v", got, wantTags)
+	}
+
+	if len(a.Dependencies) != 1 || a.Dependencies[0].Kind != "include" || !a.Dependencies[0].Lazy {
+		t.Errorf("unexpected dependencies: %+v", a.Dependencies)
+	}
+
+	for _, v := range a.Variables {
+		if v.Name == "user.profile.name" && (v.Line != 1 || v.Column != 47) {
+			t.Errorf("unexpected position for %s: line %d col %d", v.Name, v.Line, v.Column)
+		}
+	}
+}
+
+func TestAnalyzeDependencies(t *testing.T) {
+	a, err := testSuite2.Analyze("template_tests/extends.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Dependencies) != 1 || a.Dependencies[0].Kind != "extends" {
+		t.Fatalf("unexpected dependencies: %+v", a.Dependencies)
+	}
+	mustEqual(t, a.Dependencies[0].Name, `template_tests[/\\]inheritance[/\\]base\.tpl$`)
+}
@@ -0,0 +1,285 @@
+package pongo2_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func TestBinaryTemplates(t *testing.T) {
+	pongo2.Globals["this_is_a_global_variable"] = "this is a global text"
+
+	matches, err := filepath.Glob("./template_tests/*.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, match := range matches {
+		t.Run(fmt.Sprintf("%03d-%s", idx+1, match), func(t *testing.T) {
+			tpl, err := pongo2.FromFile(match)
+			if err != nil {
+				t.Fatalf("Error on FromFile('%s'): %s", match, err.Error())
+			}
+			data, err := tpl.MarshalBinary()
+			if strings.HasSuffix(match, "sandbox.tpl") {
+				// Uses a tag implemented by the tests
+				if err == nil || !strings.Contains(err.Error(), "unsupported node type") {
+					t.Errorf("got error %v, want unsupported node type", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error on MarshalBinary('%s'): %s", match, err.Error())
+			}
+			tpl, err = pongo2.DefaultSet.FromBinary(data)
+			if err != nil {
+				t.Fatalf("Error on FromBinary('%s'): %s", match, err.Error())
+			}
+
+			optsStr, _ := os.ReadFile(fmt.Sprintf("%s.options", match))
+			tpl.Options.TrimBlocks = strings.Contains(string(optsStr), "TrimBlocks=true")
+			tpl.Options.LStripBlocks = strings.Contains(string(optsStr), "LStripBlocks=true")
+
+			testOut, err := os.ReadFile(fmt.Sprintf("%s.out", match))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tplOut, err := tpl.ExecuteBytes(tplContext)
+			if err != nil {
+				t.Fatalf("Error on Execute('%s'): %s", match, err.Error())
+			}
+			tplOut = testTemplateFixes.fixIfNeeded(match, tplOut)
+			if !bytes.Equal(testOut, tplOut) {
+				t.Errorf("Failed: test_out != tpl_out for %s:\n%s", match, tplOut)
+			}
+		})
+	}
+}
+
+func TestBinaryStale(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("base.html", "<h1>{% block title %}{% endblock %}</h1>")
+	writeFile("page.html", `{% extends "base.html" %}{% block title %}{{ name|upper }}{% endblock %}`)
+	loader, err := pongo2.NewLocalFileSystemLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := pongo2.NewSet("compile", loader).FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tpl.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err = pongo2.NewSet("load", loader).FromBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Execute(pongo2.Context{"name": "alice"}); err != nil || out != "<h1>ALICE</h1>" {
+		t.Errorf("got %q, %v", out, err)
+	}
+
+	banned := pongo2.NewSet("banned", loader)
+	if err := banned.BanFilter("upper"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := banned.FromBinary(data); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("got error %v, want sandbox error", err)
+	}
+
+	for i := 0; i < len(data); i++ {
+		// Must not panic
+		pongo2.NewSet("truncated", loader).FromBinary(data[:i])
+	}
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	pongo2.NewSet("corrupt", loader).FromBinary(corrupt)
+
+	outdated := bytes.Replace(data, []byte(pongo2.Version), []byte("0.0.0"), 1)
+	if _, err := pongo2.NewSet("outdated", loader).FromBinary(outdated); !errors.Is(err, pongo2.ErrStaleTemplate) {
+		t.Errorf("got error %v, want ErrStaleTemplate", err)
+	}
+
+	jsonSet := pongo2.NewSet("json", loader)
+	jsonSet.Options.JSONOutput = true
+	if _, err := jsonSet.FromBinary(data); !errors.Is(err, pongo2.ErrStaleTemplate) {
+		t.Errorf("got error %v, want ErrStaleTemplate (parsed without JSONOutput)", err)
+	}
+
+	writeFile("base.html", "<h2>{% block title %}{% endblock %}</h2>")
+	if _, err := pongo2.NewSet("changed", loader).FromBinary(data); !errors.Is(err, pongo2.ErrStaleTemplate) {
+		t.Errorf("got error %v, want ErrStaleTemplate", err)
+	}
+
+	local := pongo2.NewSet("local", loader)
+	if err := local.RegisterTag("local", func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tpl, err = local.FromString("{% local %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.MarshalBinary(); err == nil {
+		t.Error("template with set-local tag serialized")
+	}
+}
+
+func TestPrecompiledDir(t *testing.T) {
+	dir := t.TempDir()
+	precompiled := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "macros.html"), []byte(`{% macro hello(name) export %}Hello {{ name }}!{% endmacro %}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(`{% import "macros.html" hello %}{{ hello(name) }}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loader, err := pongo2.NewLocalFileSystemLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSet := func() *pongo2.TemplateSet {
+		set := pongo2.NewSet("precompiled", loader)
+		set.PrecompiledDir = precompiled
+		return set
+	}
+	render := func(set *pongo2.TemplateSet) {
+		t.Helper()
+		tpl, err := set.FromCache("page.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := tpl.Execute(pongo2.Context{"name": "bob"}); err != nil || out != "Hello bob!" {
+			t.Errorf("got %q, %v", out, err)
+		}
+	}
+
+	render(newSet())
+	files, err := filepath.Glob(filepath.Join(precompiled, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected one precompiled template, got %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	render(newSet())
+
+	// Invalid files are replaced
+	if err := os.WriteFile(files[0], []byte("invalid"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	render(newSet())
+	rewritten, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, rewritten) {
+		t.Error("invalid precompiled template hasn't been replaced")
+	}
+}
+
+// versionedLoader serves templates from memory with explicit versions and
+// counts the reads.
+type versionedLoader struct {
+	content  map[string]string
+	versions map[string]string
+	reads    int
+}
+
+func (l *versionedLoader) Abs(base, name string) string {
+	return name
+}
+
+func (l *versionedLoader) Get(path string) (io.Reader, error) {
+	l.reads++
+	content, has := l.content[path]
+	if !has {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return strings.NewReader(content), nil
+}
+
+func (l *versionedLoader) Version(path string) (string, error) {
+	return l.versions[path], nil
+}
+
+func TestBinaryVersionedSources(t *testing.T) {
+	loader := &versionedLoader{
+		content:  map[string]string{"page.html": `{% include "part.html" %}!`, "part.html": "part"},
+		versions: map[string]string{"page.html": "1", "part.html": "1"},
+	}
+	tpl, err := pongo2.NewSet("compile", loader).FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tpl.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unchanged versions: the sources aren't read again
+	loader.reads = 0
+	tpl, err = pongo2.NewSet("load", loader).FromBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loader.reads != 0 {
+		t.Errorf("sources with unchanged versions have been read %d times", loader.reads)
+	}
+	if out, err := tpl.Execute(nil); err != nil || out != "part!" {
+		t.Errorf("got %q, %v", out, err)
+	}
+
+	// A new version with the same content is verified by its hash
+	loader.versions["part.html"] = "2"
+	if _, err := pongo2.NewSet("touched", loader).FromBinary(data); err != nil {
+		t.Errorf("unchanged content: %v", err)
+	}
+	loader.content["part.html"] = "changed"
+	if _, err := pongo2.NewSet("changed", loader).FromBinary(data); !errors.Is(err, pongo2.ErrStaleTemplate) {
+		t.Errorf("got error %v, want ErrStaleTemplate", err)
+	}
+
+	// Sources changed after loading the template can't be serialized
+	if _, err := tpl.MarshalBinary(); err == nil {
+		t.Error("template with a changed source serialized")
+	}
+}
+
+func TestPrecompiledDirWriteError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte("page"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set := pongo2.NewSet("unwritable", pongo2.MustNewLocalFileSystemLoader(dir))
+	set.PrecompiledDir = filepath.Join(dir, "missing")
+
+	// The error is logged, the template is usable anyway
+	tpl, err := set.FromCache("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Execute(nil); err != nil || out != "page" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
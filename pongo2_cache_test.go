@@ -0,0 +1,249 @@
+package pongo2_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func TestLRUTemplateCache(t *testing.T) {
+	tpls := make([]*pongo2.Template, 3)
+	for i := range tpls {
+		tpls[i] = pongo2.Must(pongo2.FromString("tpl"))
+	}
+
+	cache := pongo2.NewLRUTemplateCache(2, 0)
+	cache.Set("a", tpls[0])
+	cache.Set("b", tpls[1])
+	if tpl, ok := cache.Get("a"); !ok || tpl != tpls[0] {
+		t.Fatalf("Get(a) = %v, %v", tpl, ok)
+	}
+
+	// "b" is the least recently used entry now
+	cache.Set("c", tpls[2])
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if _, ok := cache.Get("c"); !ok {
+		t.Errorf("expected c to be cached")
+	}
+
+	stats := cache.Stats()
+	want := pongo2.TemplateCacheStats{Entries: 2, Hits: 2, Misses: 1, Evictions: 1}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+
+	entries := cache.EntryStats()
+	if len(entries) != 2 || entries[0].Name != "a" || entries[0].Hits != 1 || entries[1].Name != "c" {
+		t.Errorf("EntryStats() = %+v", entries)
+	}
+
+	cache.Delete("a")
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("expected a to be deleted")
+	}
+	cache.Clear()
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("expected an empty cache, got %d entries", stats.Entries)
+	}
+}
+
+func TestLRUTemplateCacheTTL(t *testing.T) {
+	cache := pongo2.NewLRUTemplateCache(0, 10*time.Millisecond)
+	cache.Set("a", pongo2.Must(pongo2.FromString("tpl")))
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("expected a to be expired")
+	}
+	if stats := cache.Stats(); stats.Expirations != 1 || stats.Entries != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestFromCacheChangeDetection(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("base.html", `[{% block content %}{% endblock %}]`)
+	write("child.html", `{% extends "base.html" %}{% block content %}child{% endblock %}`)
+
+	render := func(set *pongo2.TemplateSet) string {
+		tpl, err := set.FromCache("child.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	set := pongo2.NewSet("change detection", pongo2.MustNewLocalFileSystemLoader(dir))
+	set.CacheCheckInterval = time.Nanosecond
+	unchecked := pongo2.NewSet("no change detection", pongo2.MustNewLocalFileSystemLoader(dir))
+
+	if out := render(set); out != "[child]" {
+		t.Fatalf("got %q", out)
+	}
+	if out := render(unchecked); out != "[child]" {
+		t.Fatalf("got %q", out)
+	}
+
+	// Changing the parent template must invalidate the child
+	write("base.html", `<<{% block content %}{% endblock %}>>`)
+	time.Sleep(time.Millisecond)
+
+	if out := render(set); out != "<<child>>" {
+		t.Errorf("expected the changed template to be recompiled, got %q", out)
+	}
+	if out := render(unchecked); out != "[child]" {
+		t.Errorf("expected the cached template to be used, got %q", out)
+	}
+
+	// A broken change must not leave the outdated template in the cache (to
+	// be served until the next check)
+	set.CacheCheckInterval = 20 * time.Millisecond
+	write("child.html", `{% extends "base.html" %}{% block content %}{{ broken{% endblock %}`)
+	time.Sleep(25 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := set.FromCache("child.html"); err == nil {
+			t.Errorf("attempt %d: expected the compilation error, got the outdated template", i+1)
+		}
+	}
+	write("child.html", `{% extends "base.html" %}{% block content %}fixed{% endblock %}`)
+	if out := render(set); out != "<<fixed>>" {
+		t.Errorf("expected the fixed template to be compiled, got %q", out)
+	}
+}
+
+// blockingLoader counts the loads per template and blocks loading templates
+// until their channel in wait (if any) is closed.
+type blockingLoader struct {
+	loads sync.Map // name -> *int64
+	wait  map[string]chan struct{}
+}
+
+func (l *blockingLoader) Abs(base, name string) string {
+	return name
+}
+
+func (l *blockingLoader) Get(path string) (io.Reader, error) {
+	counter, _ := l.loads.LoadOrStore(path, new(int64))
+	atomic.AddInt64(counter.(*int64), 1)
+	if ch, has := l.wait[path]; has {
+		<-ch
+	}
+	return strings.NewReader(path), nil
+}
+
+func (l *blockingLoader) loadCount(path string) int64 {
+	counter, has := l.loads.Load(path)
+	if !has {
+		return 0
+	}
+	return atomic.LoadInt64(counter.(*int64))
+}
+
+func TestFromCacheConcurrent(t *testing.T) {
+	loader := &blockingLoader{
+		wait: map[string]chan struct{}{
+			"slow.html": make(chan struct{}),
+		},
+	}
+	set := pongo2.NewSet("concurrent", loader)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tpl, err := set.FromCache("slow.html")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if out, _ := tpl.Execute(nil); out != "slow.html" {
+				errs <- fmt.Errorf("got %q", out)
+			}
+		}()
+	}
+
+	// Other templates must not be blocked by the slow compilation
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := set.FromCache("fast.html"); err != nil {
+			errs <- err
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FromCache(fast.html) is blocked by the compilation of slow.html")
+	}
+
+	close(loader.wait["slow.html"])
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if n := loader.loadCount("slow.html"); n != 1 {
+		t.Errorf("slow.html has been loaded %d times, expected once", n)
+	}
+}
+
+func TestFromCacheStats(t *testing.T) {
+	cache := pongo2.NewLRUTemplateCache(0, 0)
+	set := pongo2.NewSet("stats", &blockingLoader{})
+	set.Cache = cache
+
+	// A cold load is a single miss, the next lookup a hit
+	for i := 0; i < 2; i++ {
+		if _, err := set.FromCache("a.html"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := pongo2.TemplateCacheStats{Entries: 1, Hits: 1, Misses: 1}
+	if stats := cache.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+	entries := cache.EntryStats()
+	if len(entries) != 1 || entries[0].Hits != 1 || entries[0].LastAccess.Before(entries[0].Created) {
+		t.Errorf("EntryStats() = %+v", entries)
+	}
+}
+
+func BenchmarkFromCacheParallel(b *testing.B) {
+	set := pongo2.NewSet("benchmark", &blockingLoader{})
+	if _, err := set.FromCache("a.html"); err != nil {
+		b.Fatal(err)
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := set.FromCache("a.html"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package pongo2_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+// mapLoader loads templates from memory.
+type mapLoader map[string]string
+
+func (l mapLoader) Abs(base, name string) string {
+	return name
+}
+
+func (l mapLoader) Get(path string) (io.Reader, error) {
+	tpl, has := l[path]
+	if !has {
+		return nil, fmt.Errorf("template %s not found", path)
+	}
+	return strings.NewReader(tpl), nil
+}
+
+func TestErrorKinds(t *testing.T) {
+	set := pongo2.NewSet("error kinds", mapLoader{})
+	set.MustBanFilter("lower")
+	strict := pongo2.NewSet("strict", mapLoader{})
+	strict.Options.UndefinedPolicy = pongo2.UndefinedStrict
+	strict.Limits.MaxLoopIterations = 1
+
+	tests := []struct {
+		set  *pongo2.TemplateSet
+		tpl  string
+		kind pongo2.ErrorKind
+	}{
+		{set, `{{ "unterminated }}`, pongo2.ErrorKindLex},
+		{set, `{% if %}`, pongo2.ErrorKindParse},
+		{set, `{% include "missing.html" %}`, pongo2.ErrorKindLoad},
+		{set, `{{ "a"|lower }}`, pongo2.ErrorKindSandbox},
+		{set, `{{ 1|date:"2006" }}`, pongo2.ErrorKindExecution},
+		{strict, `{{ missing }}`, pongo2.ErrorKindMissingVariable},
+		{strict, `{% for i in "ab" %}{% endfor %}`, pongo2.ErrorKindLimit},
+	}
+	for _, test := range tests {
+		tpl, err := test.set.FromString(test.tpl)
+		if err == nil {
+			_, err = tpl.Execute(nil)
+		}
+		var perr *pongo2.Error
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: expected a *pongo2.Error, got %v", test.tpl, err)
+			continue
+		}
+		if perr.Kind != test.kind {
+			t.Errorf("%s: got kind %s, want %s (%v)", test.tpl, perr.Kind, test.kind, err)
+		}
+	}
+}
+
+func TestErrorStackAndSnippet(t *testing.T) {
+	set := pongo2.NewSet("error stack", mapLoader{
+		"base.html":    "<html>\n{% block content %}{% endblock %}\n</html>",
+		"page.html":    "{% extends \"base.html\" %}\n{% block content %}\n{% include \"partial.html\" %}\n{% endblock %}",
+		"partial.html": "line 1\nline 2 {{ 1|date:\"2006\" }}\nline 3\nline 4",
+	})
+
+	tpl, err := set.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(nil)
+	var perr *pongo2.Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *pongo2.Error, got %v", err)
+	}
+
+	if perr.Filename != "partial.html" || perr.Line != 2 {
+		t.Errorf("unexpected error position: %v", perr)
+	}
+	wantStack := []pongo2.ErrorFrame{
+		{Kind: "include", Filename: "page.html", Line: 3, Column: 4},
+		{Kind: "extends", Filename: "page.html", Line: 1, Column: 4},
+	}
+	if !reflect.DeepEqual(perr.Stack, wantStack) {
+		t.Errorf("Stack = %+v, want %+v", perr.Stack, wantStack)
+	}
+
+	snippet, ok := perr.Snippet(1)
+	if !ok {
+		t.Fatal("expected a snippet")
+	}
+	if want := []string{"line 1", `line 2 {{ 1|date:"2006" }}`, "line 3"}; !reflect.DeepEqual(snippet.Lines, want) {
+		t.Errorf("Lines = %q, want %q", snippet.Lines, want)
+	}
+	if snippet.FirstLine != 1 || snippet.Line != 2 || snippet.EndColumn <= snippet.Column {
+		t.Errorf("unexpected snippet position: %+v", snippet)
+	}
+
+	line, ok, err := perr.RawLine()
+	if err != nil || !ok || line != `line 2 {{ 1|date:"2006" }}` {
+		t.Errorf("RawLine() = %q, %v, %v", line, ok, err)
+	}
+
+	buf, err := json.Marshal(perr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var details map[string]any
+	if err := json.Unmarshal(buf, &details); err != nil {
+		t.Fatal(err)
+	}
+	if details["kind"] != "execution" || details["filename"] != "partial.html" || details["line"] != float64(2) {
+		t.Errorf("unexpected JSON: %s", buf)
+	}
+	if stack, _ := details["stack"].([]any); len(stack) != 2 {
+		t.Errorf("unexpected JSON stack: %s", buf)
+	}
+}
+
+func TestErrorSnippetFromString(t *testing.T) {
+	_, err := pongo2.FromString("first\n{{ 'broken }}\nthird")
+	var perr *pongo2.Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *pongo2.Error, got %v", err)
+	}
+	snippet, ok := perr.Snippet(5)
+	if !ok {
+		t.Fatal("expected a snippet")
+	}
+	if len(snippet.Lines) != 3 || snippet.Line != 2 {
+		t.Errorf("unexpected snippet: %+v", snippet)
+	}
+}
+
+func TestValidateCollectsAllErrors(t *testing.T) {
+	src := `Hello {{ user.name|unknown_filter }}
+{% if %}yes{% endif %}
+{{ "unterminated }}
+{% for item in items %}{{ item|unknown_filter2 }}{% endfor %}
+{# broken comment
+{% unknown_tag %}
+{{ user.name }}`
+
+	errs := pongo2.Validate(src)
+	want := []struct {
+		line int
+		kind pongo2.ErrorKind
+	}{
+		{1, pongo2.ErrorKindParse},
+		{2, pongo2.ErrorKindParse},
+		{3, pongo2.ErrorKindLex},
+		{4, pongo2.ErrorKindParse},
+		{5, pongo2.ErrorKindLex},
+		{6, pongo2.ErrorKindParse},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		if errs[i].Line != w.line || errs[i].Kind != w.kind {
+			t.Errorf("error %d: got line %d/kind %s, want line %d/kind %s (%v)",
+				i, errs[i].Line, errs[i].Kind, w.line, w.kind, errs[i])
+		}
+	}
+
+	// FromString stops at the first (lexer) error
+	_, err := pongo2.FromString(src)
+	if err == nil || err.Error() != errs[2].Error() {
+		t.Errorf("FromString() = %v, want %v", err, errs[2])
+	}
+
+	tpl, errs := pongo2.FromStringAll(`{{ "valid" }}`)
+	if tpl == nil || len(errs) != 0 {
+		t.Errorf("FromStringAll() = %v, %v", tpl, errs)
+	}
+}
@@ -0,0 +1,90 @@
+package pongo2_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			"whitespace",
+			`{{user.name|default:"x"|upper}} {%if a==1 and not b%}{{ f( 1,2 )[0] }}{%endif%}`,
+			`{{ user.name|default:"x"|upper }} {% if a == 1 and not b %}{{ f(1, 2)[0] }}{% endif %}`,
+		},
+		{
+			"whitespace control, strings and operators",
+			`{{-   'it'   -}}{%- set x = -1 + "a\"b" -%}{{ a -1 }}`,
+			`{{- 'it' -}}{%- set x = -1 + "a\"b" -%}{{ a -1 }}`,
+		},
+		{
+			"indentation",
+			"<ul>\n  {%for item in items%}\n<li>\n{% if item %}\n    {{ item }}\n    {% else %}\n{% include \"x.html\" %}\n{%endif%}\n</li>\n      {% endfor %}\n</ul>",
+			"<ul>\n  {% for item in items %}\n<li>\n  \t{% if item %}\n    {{ item }}\n  \t{% else %}\n  \t\t{% include \"x.html\" %}\n  \t{% endif %}\n</li>\n  {% endfor %}\n</ul>",
+		},
+		{
+			"comments and verbatim",
+			"{#  a   comment #}\n{%comment%}\n  {%  x %}{%endcomment%}{% verbatim %}{{  raw }}{% endverbatim %}",
+			"{#  a   comment #}\n{% comment %}\n  {%  x %}{% endcomment %}{% verbatim %}{{  raw }}{% endverbatim %}",
+		},
+	}
+	for _, test := range tests {
+		out, err := pongo2.Format([]byte(test.src))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(out) != test.want {
+			t.Errorf("%s:\ngot:  %q\nwant: %q", test.name, out, test.want)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{{ "unterminated }}`, "string not closed"},
+		{`{% if a %}{% endfor %}`, "unexpected end tag 'endfor'"},
+		{`{% for a in b %}{% if a %}{% endfor %}{% endif %}`, "unexpected end tag 'endfor'"},
+		{`{% if a %}{% for a in b %}{% endfor %}`, "tag 'if' not closed"},
+		{`{% "if" %}`, "tag name must be an identifier"},
+	}
+	for _, test := range tests {
+		_, err := pongo2.Format([]byte(test.src))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestFormatTemplateTests(t *testing.T) {
+	matches, err := filepath.Glob("./template_tests/*.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, match := range matches {
+		src, err := os.ReadFile(match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := pongo2.Format(src)
+		if err != nil {
+			t.Errorf("%s: %v", match, err)
+			continue
+		}
+		again, err := pongo2.Format(out)
+		if err != nil || string(again) != string(out) {
+			t.Errorf("%s: formatting isn't idempotent (%v)", match, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package pongo2_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rudderlabs/pongo2/v6"
+)
+
+func TestSandboxedFilesystemLoader(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.html"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"shared/header.html":     "header",
+		"tenants/a/page.html":    `{% include "shared/header.html" %}|a`,
+		"tenants/a/escape.html":  `{% include "../secret.html" %}`,
+		"tenants/a/abs.html":     `{% include "` + filepath.ToSlash(filepath.Join(outside, "secret.html")) + `" %}`,
+		"tenants/a/link.html":    `{% include "tenants/a/secret.html" %}`,
+		"tenants/a/missing.html": `{% include "tenants/a/nope.html" if_exists %}ok`,
+		"private/config.html":    "config",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.html"), filepath.Join(dir, "tenants", "a", "secret.html")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if _, err := pongo2.NewSandboxedFilesystemLoader(""); err == nil {
+		t.Error("sandboxed loader without base directory created")
+	}
+	loader, err := pongo2.NewSandboxedFilesystemLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := pongo2.NewSet("sandboxed", loader)
+
+	tpl, err := set.FromFile("tenants/a/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Execute(nil); err != nil || out != "header|a" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	tpl, err = set.FromFile("tenants/a/missing.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Execute(nil); err != nil || out != "ok" {
+		t.Errorf("include if_exists: got %q, %v", out, err)
+	}
+
+	for _, name := range []string{
+		"../" + filepath.Base(outside) + "/secret.html",
+		filepath.Join(outside, "secret.html"),
+		"tenants/a/escape.html",
+		"tenants/a/abs.html",
+		"tenants/a/link.html",
+		"tenants/a/secret.html",
+	} {
+		_, err := set.FromFile(name)
+		var perr *pongo2.Error
+		if !errors.Is(err, pongo2.ErrOutsideSandbox) || !errors.As(err, &perr) || perr.Kind != pongo2.ErrorKindSandbox {
+			t.Errorf("%s: got error %v, want ErrOutsideSandbox", name, err)
+		}
+	}
+
+	loader.AllowedDirectories = []string{"shared", "tenants/*"}
+	if _, err := set.FromFile("tenants/a/page.html"); err != nil {
+		t.Errorf("allowed directory: %v", err)
+	}
+	if _, err := set.FromFile("private/config.html"); !errors.Is(err, pongo2.ErrOutsideSandbox) {
+		t.Errorf("directory not allowed: got error %v", err)
+	}
+}
+
+func TestFSLoaderSandbox(t *testing.T) {
+	set := pongo2.NewSet("fs", pongo2.NewFSLoader(fstest.MapFS{
+		"a/page.html":   {Data: []byte(`{% include "../b/part.html" %}`)},
+		"a/escape.html": {Data: []byte(`{% include "../../secret.html" %}`)},
+		"b/part.html":   {Data: []byte("part")},
+	}))
+
+	tpl, err := set.FromFile("a/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Execute(nil); err != nil || out != "part" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := set.FromFile("a/escape.html"); !errors.Is(err, pongo2.ErrOutsideSandbox) || !strings.Contains(err.Error(), "../secret.html") {
+		t.Errorf("got error %v, want ErrOutsideSandbox", err)
+	}
+}
+
+func TestSSIThroughLoaders(t *testing.T) {
+	files := fstest.MapFS{
+		"pages/page.html":   {Data: []byte(`{% ssi "../raw/note.txt" %}|{% ssi "part.html" parsed %}|{% ssi name %}|{% ssi tpl parsed %}`)},
+		"pages/part.html":   {Data: []byte("{{ who|upper }}")},
+		"pages/escape.html": {Data: []byte(`{% ssi "../../secret.txt" %}`)},
+		"pages/lazy.html":   {Data: []byte(`{% ssi name %}`)},
+		"raw/note.txt":      {Data: []byte("{{ not parsed }}")},
+	}
+	set := pongo2.NewSet("ssi", pongo2.NewFSLoader(files))
+
+	tpl, err := set.FromFile("pages/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{"who": "bob", "name": "../raw/note.txt", "tpl": "part.html"})
+	if want := "{{ not parsed }}|BOB|{{ not parsed }}|BOB"; err != nil || out != want {
+		t.Errorf("got %q, %v; want %q", out, err, want)
+	}
+
+	if _, err := set.FromFile("pages/escape.html"); !errors.Is(err, pongo2.ErrOutsideSandbox) {
+		t.Errorf("got error %v, want ErrOutsideSandbox", err)
+	}
+	tpl, err = set.FromFile("pages/lazy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(pongo2.Context{"name": "missing.txt"}); err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("missing file: got error %v", err)
+	}
+
+	noRaw := pongo2.NewSet("no raw ssi", pongo2.NewFSLoader(files))
+	noRaw.DisableRawSSI = true
+	if _, err := noRaw.FromFile("pages/page.html"); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("raw ssi: got error %v", err)
+	}
+	tpl, err = noRaw.FromFile("pages/lazy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Execute(pongo2.Context{"name": "../raw/note.txt"}); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("lazy raw ssi: got error %v", err)
+	}
+}
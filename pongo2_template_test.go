@@ -976,3 +976,32 @@ func BenchmarkExecuteBlocksWithoutSandbox(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkTemplates executes the template fixtures (see TestTemplates), run
+// with -benchmem to compare the allocations per execution.
+func BenchmarkTemplates(b *testing.B) {
+	pongo2.Globals["this_is_a_global_variable"] = "this is a global text"
+
+	matches, err := filepath.Glob("./template_tests/*.tpl")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, match := range matches {
+		tpl, err := pongo2.FromFile(match)
+		if err != nil {
+			b.Fatalf("Error on FromFile('%s'): %s", match, err.Error())
+		}
+		optsStr, _ := os.ReadFile(fmt.Sprintf("%s.options", match))
+		tpl.Options.TrimBlocks = strings.Contains(string(optsStr), "TrimBlocks=true")
+		tpl.Options.LStripBlocks = strings.Contains(string(optsStr), "LStripBlocks=true")
+
+		b.Run(strings.TrimSuffix(filepath.Base(match), ".tpl"), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := tpl.ExecuteWriter(tplContext, io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
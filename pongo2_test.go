@@ -1,13 +1,21 @@
 package pongo2_test
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/rudderlabs/pongo2/v6"
 )
@@ -160,3 +168,1094 @@ func FuzzSimpleExecution(f *testing.F) {
 		}
 	})
 }
+
+func TestExecuteContext(t *testing.T) {
+	tpl, err := pongo2.FromString("{% for i in items %}{{ i }}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]int, 100)
+
+	out, err := tpl.ExecuteContext(context.Background(), pongo2.Context{"items": items[:3]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, "^000$")
+
+	// A nil context is treated like context.Background()
+	var nilCtx context.Context
+	out, err = tpl.ExecuteContext(nilCtx, pongo2.Context{"items": items[:2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, "^00$")
+	if err := tpl.ExecuteWriterUnbufferedContext(nilCtx, pongo2.Context{"items": items[:2]}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	goCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	cancelTpl, err := pongo2.FromString("{% for i in items %}{{ stop() }}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cancelTpl.ExecuteContext(goCtx, pongo2.Context{
+		"items": items,
+		"stop": func() string {
+			calls++
+			if calls == 10 {
+				cancel()
+			}
+			return ""
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	var perr *pongo2.Error
+	if !errors.As(err, &perr) || perr.Sender != "execution:cancelled" {
+		t.Fatalf("expected a cancellation *pongo2.Error, got: %#v", err)
+	}
+	if calls != 10 {
+		t.Fatalf("expected the loop to stop after 10 iterations, got %d", calls)
+	}
+
+	deadlineCtx, cancelDeadline := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelDeadline()
+	err = tpl.ExecuteWriterContext(deadlineCtx, pongo2.Context{"items": items}, io.Discard)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits pongo2.Limits
+		tpl    string
+		sender string
+	}{
+		{
+			name:   "Output",
+			limits: pongo2.Limits{MaxOutputBytes: 10},
+			tpl:    "{% for i in items %}{{ i }}{% endfor %}",
+			sender: "limit:output",
+		},
+		{
+			// The intermediate buffers count as well, not just the output
+			name:   "FilterBuffer",
+			limits: pongo2.Limits{MaxOutputBytes: 10},
+			tpl:    "{% filter truncatechars:1 %}{% for i in items %}{{ i }}{% endfor %}{% endfilter %}",
+			sender: "limit:output",
+		},
+		{
+			name:   "SpacelessBuffer",
+			limits: pongo2.Limits{MaxOutputBytes: 10},
+			tpl:    "{% spaceless %}<p>{% for i in items %} {% endfor %}</p>{% endspaceless %}",
+			sender: "limit:output",
+		},
+		{
+			name:   "MacroBuffer",
+			limits: pongo2.Limits{MaxOutputBytes: 10},
+			tpl:    "{% macro m() %}{% for i in items %}{{ i }}{% endfor %}{% endmacro %}{{ m()|length }}",
+			sender: "limit:output",
+		},
+		{
+			name:   "ExecBuffer",
+			limits: pongo2.Limits{MaxOutputBytes: 10},
+			tpl:    "{% exec %}{% templatetag opencomment %}{% for i in items %}{{ i }}{% endfor %}{% templatetag closecomment %}{% endexec %}",
+			sender: "limit:output",
+		},
+		{
+			name:   "LoopIterations",
+			limits: pongo2.Limits{MaxLoopIterations: 15},
+			tpl:    "{% for i in items %}{% for j in items %}{% endfor %}{% endfor %}",
+			sender: "limit:loop",
+		},
+		{
+			name:   "NodeEvaluations",
+			limits: pongo2.Limits{MaxNodeEvaluations: 20},
+			tpl:    "{% for i in items %}a{{ i }}b{% endfor %}",
+			sender: "limit:nodes",
+		},
+		{
+			name:   "ExecDepth",
+			limits: pongo2.Limits{MaxExecDepth: 1},
+			tpl:    `{% exec %}{% templatetag openblock %} exec {% templatetag closeblock %}x{% templatetag openblock %} endexec {% templatetag closeblock %}{% endexec %}`,
+			sender: "limit:exec",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := pongo2.NewSet("limits", &DummyLoader{})
+			tpl, err := set.FromString(tt.tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := pongo2.Context{"items": []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}
+
+			// Without limits the template renders just fine
+			if _, err := tpl.Execute(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			set.Limits = tt.limits
+			_, err = tpl.Execute(ctx)
+			var perr *pongo2.Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a *pongo2.Error, got: %v", err)
+			}
+			if perr.Sender != tt.sender {
+				t.Fatalf("expected sender %q, got %q (%v)", tt.sender, perr.Sender, err)
+			}
+		})
+	}
+}
+
+func TestLimitsBuffersCountOnce(t *testing.T) {
+	set := pongo2.NewSet("limits", pongo2.NewFSLoader(fstest.MapFS{
+		"part.html": {Data: []byte("{% for i in items %}{{ i }}{% endfor %}")},
+	}))
+	set.Limits.MaxOutputBytes = 11
+	set.Options.ParallelIncludes = 2
+	ctx := pongo2.Context{"items": []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}
+
+	// Released buffers don't count against the output they're written to
+	for _, source := range []string{
+		`{% filter upper %}{% spaceless %}{% include "part.html" %}{% endspaceless %}{% endfilter %}`,
+		`{% include "part.html" with items=items|slice:":5" %}{% include "part.html" with items=items|slice:"5:" %}`,
+	} {
+		tpl, err := set.FromString(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := tpl.Execute(ctx); err != nil || out != "12345678910" {
+			t.Errorf("%s: got %q, %v", source, out, err)
+		}
+	}
+}
+
+func TestExecutionContextsNotReused(t *testing.T) {
+	// Functions and custom tags may keep the contexts they're called with
+	var kept []*pongo2.ExecutionContext
+	keep := func(ctx *pongo2.ExecutionContext) string {
+		kept = append(kept, ctx)
+		return ""
+	}
+	tpl, err := pongo2.FromString(`{{ keep() }}{% for i in items %}{% with x=i %}{{ keep() }}{% endwith %}{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := tpl.Execute(pongo2.Context{"keep": keep, "name": name, "items": []int{1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, ctx := range kept {
+		want := []string{"a", "b", "c"}[i/2]
+		if ctx.Public["name"] != want || (i%2 == 1 && fmt.Sprint(ctx.Private["x"]) != "1") {
+			t.Errorf("context %d: got name %v, x %v; want %s", i, ctx.Public["name"], ctx.Private["x"], want)
+		}
+	}
+
+	if pongo2.AsValue(true) == pongo2.AsValue(true) || pongo2.AsSafeValue("") == pongo2.AsSafeValue("") {
+		t.Error("values are shared")
+	}
+}
+
+func TestUndefinedPolicy(t *testing.T) {
+	type profile struct {
+		Name string
+	}
+	type account struct {
+		Profile *profile
+	}
+	ctx := pongo2.Context{
+		"account": &account{},
+		"items":   []string{"a"},
+		"dict":    map[string]any{"key": "value", "nil": nil},
+	}
+
+	tests := []struct {
+		tpl       string
+		legacy    string
+		strictErr string
+		lenient   string
+	}{
+		{"{{ missing }}", "!No value found for missing", "'missing' can't be resolved", ""},
+		{"{{ account.Profile.Name }}", "", "'account.Profile.Name' can't be resolved", ""},
+		{"{{ items.5 }}", "", "'items.5' can't be resolved", ""},
+		{"{{ items[5] }}", "", `'items.\[subscript\]' can't be resolved`, ""},
+		{`{{ dict["other"] }}`, "", `'dict.\[subscript\]' can't be resolved`, ""},
+		{"{{ dict.other }}", "!No value found for dict.other", "'dict.other' can't be resolved", ""},
+		{"{{ dict.nil.name }}", "", "'dict.nil.name' can't be resolved", ""},
+		{"{{ dict.nil }}{{ dict.key }}", "value", "", "value"},
+
+		// Undefined variables handled by the template
+		{`{{ missing|default:"x" }}`, "x", "", "x"},
+		{`{{ missing.name|default:"x"|upper }}`, "X", "", "X"},
+		{`{{ account.Profile.Name|default_if_none:"anon" }}`, "anon", "", "anon"},
+		{`{{ missing|upper|default:"x" }}`, "!No value found for missing", "'missing' can't be resolved", "x"},
+		{"{{ missing is defined }} {{ dict.key is defined }} {{ dict.nil is defined }} {{ items.5 is not defined }} {{ not missing is defined }}",
+			"False True True True True", "", "False True True True True"},
+		{"{% if dict.other is defined %}yes{% else %}no{% endif %}", "no", "", "no"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tpl, func(t *testing.T) {
+			set := pongo2.NewSet("undefined", &DummyLoader{})
+			for _, policy := range []pongo2.UndefinedPolicy{
+				pongo2.UndefinedDefault, pongo2.UndefinedStrict,
+				pongo2.UndefinedLenient, pongo2.UndefinedChainable,
+			} {
+				set.Options.UndefinedPolicy = policy
+				tpl, err := set.FromString(tt.tpl)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out, err := tpl.Execute(ctx)
+
+				want := tt.lenient
+				wantErr := ""
+				switch policy {
+				case pongo2.UndefinedDefault:
+					if strings.HasPrefix(tt.legacy, "!") {
+						wantErr = tt.legacy[1:]
+					} else {
+						want = tt.legacy
+					}
+				case pongo2.UndefinedStrict:
+					wantErr = tt.strictErr
+					if wantErr == "" {
+						want = tt.legacy
+					}
+				}
+
+				if wantErr != "" {
+					if err == nil {
+						t.Fatalf("policy %d: expected error matching %q, got output %q", policy, wantErr, out)
+					}
+					mustEqual(t, err.Error(), `^\[Error \(where: execution\) in <string> \| Line 1 Col 4 near '.+'\] .*`+wantErr)
+					continue
+				}
+				if err != nil {
+					t.Fatalf("policy %d: unexpected error: %v", policy, err)
+				}
+				if out != want {
+					t.Fatalf("policy %d: expected %q, got %q", policy, want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestUndefinedChainable(t *testing.T) {
+	set := pongo2.NewSet("chainable", &DummyLoader{})
+	set.Options.UndefinedPolicy = pongo2.UndefinedChainable
+
+	tpl, err := set.FromString(`{% set x = missing.a %}[{{ x.b.c }}]{{ is_undefined(x.d) }}{{ x|default:"fallback" }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Execute(pongo2.Context{
+		"is_undefined": func(v *pongo2.Value) bool {
+			return v.IsUndefined()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, `^\[\]Truefallback$`)
+}
+
+func TestSetRegistry(t *testing.T) {
+	shout := func(in, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(strings.ToUpper(in.String()) + "!"), nil
+	}
+	whisper := func(in, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(strings.ToLower(in.String()) + "..."), nil
+	}
+
+	tenant1 := pongo2.NewSet("tenant 1", &DummyLoader{})
+	tenant1.MustRegisterFilter("say", shout)
+	if err := tenant1.ReplaceFilter("lower", shout); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant1.RegisterFilter("upper", shout); err == nil {
+		t.Errorf("expected an error when registering an existing filter")
+	}
+
+	tenant2 := pongo2.NewSet("tenant 2", &DummyLoader{})
+	tenant2.MustRegisterFilter("say", whisper)
+
+	tpl := `{{ "Hi"|say }} {{ "Hi"|lower }} {% filter say %}Bye{% endfilter %}`
+	out, err := pongo2.Must(tenant1.FromString(tpl)).Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, `^HI! HI! BYE!$`)
+
+	out, err = pongo2.Must(tenant2.FromString(tpl)).Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, `^hi\.\.\. hi bye\.\.\.$`)
+
+	// Set filters are not available globally
+	if _, err := pongo2.FromString(`{{ "Hi"|say }}`); err == nil {
+		t.Errorf("expected the set filter to be unavailable globally")
+	}
+
+	// Registration is not possible after the first template was created
+	if err := tenant1.RegisterFilter("another", shout); err == nil {
+		t.Errorf("expected an error when registering a filter after the first template")
+	}
+}
+
+func TestSandboxAllowList(t *testing.T) {
+	set := pongo2.NewSet("allow list", &DummyLoader{})
+	set.MustAllowTags("if", "for")
+	set.MustAllowFilters("upper")
+	if err := set.AllowTags("not_existing_tag"); err == nil {
+		t.Errorf("expected an error when allowing an unknown tag")
+	}
+
+	out, err := pongo2.Must(set.FromString(`{% for x in "ab" %}{% if x %}{{ x|upper }}{% endif %}{% endfor %}`)).Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, `^AB$`)
+
+	for _, tpl := range []string{
+		`{% set x = 1 %}`,
+		`{{ "a"|lower }}`,
+		`{% filter lower %}A{% endfilter %}`,
+	} {
+		_, err := set.FromString(tpl)
+		if err == nil || !strings.Contains(err.Error(), "sandbox restriction active") {
+			t.Errorf("%s: expected a sandbox error, got %v", tpl, err)
+		}
+	}
+
+	if err := set.AllowFilters("lower"); err == nil {
+		t.Errorf("expected an error when allowing a filter after the first template")
+	}
+}
+
+type attributePolicyUser struct {
+	Name     string
+	Password string
+}
+
+func (u *attributePolicyUser) Greeting() string {
+	return "Hello " + u.Name
+}
+
+func TestAttributePolicy(t *testing.T) {
+	ctx := pongo2.Context{"user": &attributePolicyUser{Name: "florian", Password: "secret"}}
+
+	set := pongo2.NewSet("no method calls", &DummyLoader{})
+	set.AttributePolicy = pongo2.NoMethodCalls
+
+	out, err := pongo2.Must(set.FromString(`{{ user.Name }}`)).Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, `^florian$`)
+
+	_, err = pongo2.Must(set.FromString(`{{ user.Greeting() }}`)).Execute(ctx)
+	var perr *pongo2.Error
+	if !errors.As(err, &perr) || perr.Sender != "sandbox:attribute" {
+		t.Fatalf("expected a sandbox:attribute error, got %v", err)
+	}
+	mustEqual(t, err.Error(), `method 'Greeting' of type \*pongo2_test.attributePolicyUser is not allowed`)
+
+	set = pongo2.NewSet("custom policy", &DummyLoader{})
+	set.AttributePolicy = func(t reflect.Type, name string, isMethod bool) bool {
+		return name != "Password"
+	}
+	out, err = pongo2.Must(set.FromString(`{{ user.Greeting() }}`)).Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustEqual(t, out, `^Hello florian$`)
+	for _, tpl := range []string{`{{ user.Password }}`, `{{ user["Password"] }}`} {
+		if _, err := pongo2.Must(set.FromString(tpl)).Execute(ctx); err == nil {
+			t.Errorf("%s: expected an error", tpl)
+		}
+	}
+}
+
+type attributePolicyStringer struct {
+	secret string
+}
+
+func (s attributePolicyStringer) String() string {
+	return s.secret
+}
+
+func TestAttributePolicyFormatting(t *testing.T) {
+	user := &attributePolicyUser{Name: "florian", Password: "secret"}
+	ctx := pongo2.Context{
+		"user":     user,
+		"users":    []any{map[string]any{"user": user}},
+		"stringer": attributePolicyStringer{secret: "secret"},
+		"err":      errors.New("secret"),
+	}
+
+	noPassword := pongo2.NewSet("custom policy", &DummyLoader{})
+	noPassword.AttributePolicy = func(t reflect.Type, name string, isMethod bool) bool {
+		return name != "Password"
+	}
+	noMethods := pongo2.NewSet("no method calls", &DummyLoader{})
+	noMethods.AttributePolicy = pongo2.NoMethodCalls
+	jsonSet := pongo2.NewSet("json output", &DummyLoader{})
+	jsonSet.AttributePolicy = noPassword.AttributePolicy
+	jsonSet.Options.JSONOutput = true
+	contextualSet := pongo2.NewSet("contextual", &DummyLoader{})
+	contextualSet.AttributePolicy = noPassword.AttributePolicy
+	contextualSet.Options.ContextualAutoescape = true
+
+	denied := []struct {
+		set *pongo2.TemplateSet
+		tpl string
+		err string
+	}{
+		{noPassword, `{{ user|stringformat:"%+v" }}`, `field 'Password' of type pongo2_test.attributePolicyUser is not allowed \(formatting the value\)`},
+		{noPassword, `{{ users|stringformat:"%v" }}`, `field 'Password' of type pongo2_test.attributePolicyUser`},
+		{noPassword, `{{ user|tojson }}`, `field 'Password' of type pongo2_test.attributePolicyUser`},
+		{noPassword, `{{ "Password" in user }}`, `field 'Password' of type pongo2_test.attributePolicyUser is not allowed \(checking for the field\)`},
+		{noPassword, `{% if not ("Password" in user) %}no{% endif %}`, `field 'Password'`},
+		{jsonSet, `{"users": {{ users }}}`, `field 'Password' of type pongo2_test.attributePolicyUser`},
+		{contextualSet, `<script>var user = {{ user }};</script>`, `field 'Password' of type pongo2_test.attributePolicyUser`},
+		{noMethods, `{{ stringer }}`, `method 'String' of type pongo2_test.attributePolicyStringer is not allowed \(printing the value\)`},
+		{noMethods, `{{ stringer|stringformat:"%s" }}`, `method 'String' of type pongo2_test.attributePolicyStringer`},
+		{noMethods, `{{ err|stringformat:"%v" }}`, `method 'Error' of type \*errors.errorString`},
+	}
+	for _, test := range denied {
+		out, err := pongo2.Must(test.set.FromString(test.tpl)).Execute(ctx)
+		var perr *pongo2.Error
+		if !errors.As(err, &perr) || perr.Sender != "sandbox:attribute" {
+			t.Errorf("%s: expected a sandbox:attribute error, got %v (output %q)", test.tpl, err, out)
+			continue
+		}
+		mustEqual(t, err.Error(), test.err)
+	}
+
+	allowed := []struct {
+		set *pongo2.TemplateSet
+		tpl string
+		out string
+	}{
+		{noPassword, `{{ "Name" in user }}`, `True`},
+		{noPassword, `{{ user.Name|stringformat:"%q" }}`, `&quot;florian&quot;`},
+		{noPassword, `{{ stringer }}|{{ err|stringformat:"%v" }}`, `secret|secret`},
+		{contextualSet, `<p>{{ user.Name }}</p><script>var name = {{ user.Name }};</script>`, `<p>florian</p><script>var name = "florian";</script>`},
+		{noMethods, `{{ "Password" in user }}`, `True`},
+		{noMethods, `{{ user|stringformat:"%v" }}`, `&amp;{florian secret}`},
+	}
+	for _, test := range allowed {
+		out, err := pongo2.Must(test.set.FromString(test.tpl)).Execute(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", test.tpl, err)
+			continue
+		}
+		if out != test.out {
+			t.Errorf("%s: got %q, want %q", test.tpl, out, test.out)
+		}
+	}
+}
+
+type resolverEventUser struct {
+	ID   int
+	Name string
+}
+
+type resolverEventMeta struct {
+	Source string
+	ID     string // ambiguous with resolverEventTrace.ID
+}
+
+type resolverEventTrace struct {
+	ID string
+}
+
+type resolverEvent struct {
+	resolverEventMeta
+	resolverEventTrace
+	Type string
+	User *resolverEventUser
+}
+
+func (e resolverEvent) Title() string {
+	return e.Type + " by " + e.User.Name
+}
+
+// resolverEventMap resolves its attributes without reflection
+type resolverEventMap map[string]any
+
+func (m resolverEventMap) Resolve(name string) (any, bool) {
+	v, ok := m[strings.ToLower(name)]
+	return v, ok
+}
+
+type resolverNode struct {
+	name string
+}
+
+func (n *resolverNode) Resolve(name string) (any, bool) {
+	switch name {
+	case "name":
+		return n.name, true
+	case "child":
+		return &resolverNode{name: n.name + "/child"}, true
+	case "upper":
+		return func(s string) string { return strings.ToUpper(s) }, true
+	}
+	return nil, false
+}
+
+func TestReflectionCacheAndResolver(t *testing.T) {
+	event := &resolverEvent{
+		resolverEventMeta: resolverEventMeta{Source: "api"},
+		Type:              "signup",
+		User:              &resolverEventUser{ID: 7, Name: "alice"},
+	}
+	ctx := pongo2.Context{
+		"event": event,
+		"node":  &resolverNode{name: "root"},
+		"map":   resolverEventMap{"user": "bob"},
+	}
+
+	tests := []struct{ tpl, out string }{
+		// Repeated to use the cached lookups
+		{`{{ event.Type }} {{ event.Type }}`, `signup signup`},
+		{`{{ event.Source }}`, `api`},
+		{`{{ event.User.Name }} {{ event.User.ID }}`, `alice 7`},
+		{`{{ event.Title() }} {{ event.Title() }}`, `signup by alice signup by alice`},
+		{`{{ event["Type"] }}`, `signup`},
+		{`{{ node.name }} {{ node.child.child.name }}`, `root root/child/child`},
+		{`{{ node.upper("x") }} {{ node.child.upper(node.name) }}`, `X ROOT`},
+		{`{% for n in nodes %}{{ n.child.name }}{% endfor %}`, `a/child`},
+		{`{{ map.User }} {{ map.user }}`, `bob bob`},
+	}
+	ctx["nodes"] = []any{&resolverNode{name: "a"}}
+	for _, test := range tests {
+		out, err := pongo2.Must(testSuite2.FromString(test.tpl)).Execute(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", test.tpl, err)
+			continue
+		}
+		if out != test.out {
+			t.Errorf("%s: got %q, want %q", test.tpl, out, test.out)
+		}
+	}
+
+	set := pongo2.NewSet("resolver strict", &DummyLoader{})
+	set.Options.UndefinedPolicy = pongo2.UndefinedStrict
+	for _, tpl := range []string{`{{ event.ID }}`, `{{ event.User.Missing }}`, `{{ node.missing }}`, `{{ node.child.missing.name }}`} {
+		_, err := pongo2.Must(set.FromString(tpl)).Execute(ctx)
+		var perr *pongo2.Error
+		if !errors.As(err, &perr) || perr.Kind != pongo2.ErrorKindMissingVariable {
+			t.Errorf("%s: expected an undefined variable error, got %v", tpl, err)
+		}
+	}
+}
+
+func BenchmarkResolveStruct(b *testing.B) {
+	tpl := pongo2.Must(testSuite2.FromString(`{{ event.Type }}{{ event.Source }}{{ event.User.Name }}{{ event.Title() }}`))
+	ctx := pongo2.Context{"event": &resolverEvent{Type: "signup", User: &resolverEventUser{Name: "alice"}}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := tpl.ExecuteWriterUnbuffered(ctx, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResolveResolver(b *testing.B) {
+	tpl := pongo2.Must(testSuite2.FromString(`{{ node.name }}{{ node.child.name }}{{ node.child.child.name }}`))
+	ctx := pongo2.Context{"node": &resolverNode{name: "root"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := tpl.ExecuteWriterUnbuffered(ctx, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// resolverDocument is a foreign document type (it can't implement Resolver)
+type resolverDocument struct {
+	values map[string]string
+}
+
+func TestTypeResolvers(t *testing.T) {
+	ctx := pongo2.Context{
+		"event": json.RawMessage(`{"type": "signup", "user": {"name": "alice", "tags": ["a", "b"]}, "items": [{"id": 1}, {"id": 2}]}`),
+		"yaml":  map[any]any{"a": map[any]any{"b": []any{map[any]any{"c": "yes", 1: "one"}}}},
+		"doc":   &resolverDocument{values: map[string]string{"key": "value"}},
+		"field": "type",
+	}
+
+	set := pongo2.NewSet("type resolvers", &DummyLoader{})
+	set.Options.UndefinedPolicy = pongo2.UndefinedLenient
+	if err := set.RegisterTypeResolver(reflect.TypeOf(&resolverDocument{}), func(value any, key any) (any, bool) {
+		name, ok := key.(string)
+		if !ok {
+			return nil, false
+		}
+		v, ok := value.(*resolverDocument).values[name]
+		return v, ok
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.RegisterTypeResolver(reflect.TypeOf(&resolverDocument{}), nil); err == nil {
+		t.Error("expected an error registering a type resolver twice")
+	}
+
+	tests := []struct{ tpl, out string }{
+		{`{{ event.type }} {{ event[field] }} {{ event["user"].name|upper }}`, `signup signup ALICE`},
+		{`{{ event.user.tags.1 }} {{ event.user.tags[0] }} {{ event.items[1].id }}`, `b a 2`},
+		{`{% for item in event.items %}{{ item.id }}{% endfor %} {{ event.user.tags|join:"," }}`, `12 a,b`},
+		{`{{ event.missing }}|{{ event.items.5 }}|{{ event.items[1].id == 2 }}`, `||True`},
+		{`{{ yaml.a.b[0].c }} {{ yaml.a.b.0.c }} {{ yaml["a"]["b"][0][1] }}`, `yes yes one`},
+		{`{{ doc.key }}|{{ doc.missing }}`, `value|`},
+	}
+	for _, test := range tests {
+		out, err := pongo2.Must(set.FromString(test.tpl)).Execute(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", test.tpl, err)
+			continue
+		}
+		if out != test.out {
+			t.Errorf("%s: got %q, want %q", test.tpl, out, test.out)
+		}
+	}
+
+	// The set's resolver isn't used by other sets
+	if _, err := pongo2.Must(testSuite2.FromString(`{{ doc.key }}`)).Execute(ctx); err == nil {
+		t.Error("expected an error resolving doc.key without the type resolver")
+	}
+
+	// TypeResolvers take precedence over the Resolver interface, for all
+	// kinds of lookups
+	nodeSet := pongo2.NewSet("resolver precedence", &DummyLoader{})
+	if err := nodeSet.RegisterTypeResolver(reflect.TypeOf(&resolverNode{}), func(value any, key any) (any, bool) {
+		return fmt.Sprintf("typed %v", key), true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx["node"] = &resolverNode{name: "root"}
+	out, err := pongo2.Must(nodeSet.FromString(`{{ node.name }}|{{ node["name"] }}|{{ node.0 }}`)).Execute(ctx)
+	if want := "typed name|typed name|typed 0"; err != nil || out != want {
+		t.Errorf("got %q, %v, want %q", out, err, want)
+	}
+}
+
+func BenchmarkResolveJSON(b *testing.B) {
+	tpl := pongo2.Must(testSuite2.FromString(`{{ event.type }}{{ event.user.name }}{{ event.user.tags.1 }}{{ event.items[1].id }}`))
+	ctx := pongo2.Context{"event": json.RawMessage(`{"type": "signup", "user": {"name": "alice", "tags": ["a", "b"]}, "items": [{"id": 1}, {"id": 2}]}`)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := tpl.ExecuteWriterUnbuffered(ctx, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// flushRecorder records the output at each flush
+type flushRecorder struct {
+	strings.Builder
+	flushes []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes = append(r.flushes, r.String())
+}
+
+func TestFlush(t *testing.T) {
+	set := pongo2.NewSet("flush", &DummyLoader{})
+	tpl := pongo2.Must(set.FromString(`a{% flush %}b{% flush %}{% flush %}{% for i in "xyz" %}{{ i }}{% endfor %}{% filter upper %}c{% flush %}d{% endfilter %}`))
+	var rec flushRecorder
+	if err := tpl.ExecuteWriterUnbuffered(nil, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.String() != "abxyzCD" || strings.Join(rec.flushes, "|") != "a|ab|abxyz" {
+		t.Errorf("flush tag: got %q, flushes %q", rec.String(), rec.flushes)
+	}
+
+	tpl.Options.FlushBytes = 2
+	rec = flushRecorder{}
+	if err := tpl.ExecuteWriterUnbuffered(nil, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rec.flushes, "|") != "a|ab|abxy|abxyz|abxyzCD" {
+		t.Errorf("FlushBytes: flushes %q", rec.flushes)
+	}
+
+	// Buffered executions are never flushed
+	rec = flushRecorder{}
+	if err := tpl.ExecuteWriter(nil, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.String() != "abxyzCD" || len(rec.flushes) > 0 {
+		t.Errorf("ExecuteWriter: got %q, flushes %q", rec.String(), rec.flushes)
+	}
+
+	tpl = pongo2.Must(set.FromString(`<p>{% block a %}A{% block b %}B{% endblock %}{% endblock %}{% block c %}C{% endblock %}</p>`))
+	tpl.Options.FlushBlocks = true
+	rec = flushRecorder{}
+	if err := tpl.ExecuteWriterUnbuffered(nil, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rec.flushes, "|") != "<p>AB|<p>ABC" {
+		t.Errorf("FlushBlocks: flushes %q", rec.flushes)
+	}
+
+	// bufio.Writer
+	var out strings.Builder
+	w := bufio.NewWriterSize(&out, 1024)
+	tpl = pongo2.Must(set.FromString(`head{% flush %}body`))
+	if err := tpl.ExecuteWriterUnbuffered(nil, w); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "head" {
+		t.Errorf("bufio.Writer: got %q", out.String())
+	}
+
+	// Flushes within included templates reach the writer
+	fsSet := pongo2.NewSet("flush includes", pongo2.NewFSLoader(fstest.MapFS{
+		"part.html": {Data: []byte(`[{{ name }}{% flush %}]`)},
+		"page.html": {Data: []byte(`<p>{% include "part.html" with name="a" %}{% include "part.html" with name="b" %}</p>`)},
+	}))
+	tpl, err := fsSet.FromFile("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = flushRecorder{}
+	if err := tpl.ExecuteWriterUnbuffered(nil, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.String() != "<p>[a][b]</p>" || strings.Join(rec.flushes, "|") != "<p>[a|<p>[a][b" {
+		t.Errorf("include: got %q, flushes %q", rec.String(), rec.flushes)
+	}
+}
+
+func TestParallelIncludes(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"part.html":   "[{{ name }}:{{ slow(name) }}]",
+		"nested.html": `({% include "part.html" with name="x" %}{% include "part.html" with name="y" %})`,
+		"cycle.html":  `{% for i in "ab" %}{% cycle "1" "2" %}{% endfor %}`,
+		"page.html": `{% include "part.html" with name="a" %}{% include "part.html" with name="b" %}` +
+			`{% if true %}{% include "nested.html" %}{% include "cycle.html" %}{% endif %}` +
+			`{% set name = "c" %}{% include "part.html" %}{% include "part.html" with name=name|upper %}`,
+		"broken.html": `{% include "part.html" with name="a" %}{% include "part.html" with name="fail" %}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loader, err := pongo2.NewLocalFileSystemLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With parallel includes, a and b wait for each other: they only finish
+	// if they're rendered at the same time (the timeout just avoids hanging)
+	var running, maxRunning, arrived int32
+	var meet chan struct{}
+	slow := func(name string) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		if meet != nil && (name == "a" || name == "b") {
+			if atomic.AddInt32(&arrived, 1) == 2 {
+				close(meet)
+			}
+			select {
+			case <-meet:
+			case <-time.After(10 * time.Second):
+				return "", errors.New("a and b aren't rendered concurrently")
+			}
+		}
+		if name == "fail" {
+			return "", errors.New("failed")
+		}
+		return strings.ToLower(name), nil
+	}
+	render := func(parallel int, name string, concurrent bool) (string, error) {
+		set := pongo2.NewSet("parallel", loader)
+		set.Options.ParallelIncludes = parallel
+		tpl, err := set.FromFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		atomic.StoreInt32(&maxRunning, 0)
+		atomic.StoreInt32(&arrived, 0)
+		meet = nil
+		if concurrent {
+			meet = make(chan struct{})
+		}
+		return tpl.Execute(pongo2.Context{"slow": slow})
+	}
+
+	want := "[a:a][b:b]([x:x][y:y])12[c:c][C:c]"
+	for _, parallel := range []int{0, 2, 4} {
+		out, err := render(parallel, "page.html", parallel > 1)
+		if err != nil || out != want {
+			t.Errorf("ParallelIncludes=%d: got %q, %v; want %q", parallel, out, err, want)
+		}
+		if max := atomic.LoadInt32(&maxRunning); parallel <= 1 && max > 1 {
+			t.Errorf("ParallelIncludes=%d: %d includes rendered concurrently", parallel, max)
+		}
+	}
+
+	out, err := render(4, "broken.html", false)
+	if err == nil || !strings.Contains(err.Error(), "failed") || out != "" {
+		t.Errorf("broken include: got %q, %v", out, err)
+	}
+}
+
+func TestContextualAutoescape(t *testing.T) {
+	set := pongo2.NewSet("contextual", &DummyLoader{})
+	set.Options.ContextualAutoescape = true
+	ctx := pongo2.Context{
+		"xss":   `</script><script>alert('x')</script>`,
+		"quote": `" onmouseover="alert(1)`,
+		"js":    "javascript:alert(1)",
+		"q":     "a b&c=d",
+		"n":     42,
+		"list":  []string{"a", "<b>"},
+	}
+	tests := []struct {
+		tpl, want string
+	}{
+		{`<p>{{ xss }}</p>`, `<p>&lt;/script&gt;&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt;</p>`},
+		{`<p title="{{ quote }}">`, `<p title="&quot; onmouseover=&quot;alert(1)">`},
+		{`<p title={{ quote }}>`, `<p title=&quot;&#32;onmouseover&#61;&quot;alert(1)>`},
+		{`<script>var s = {{ xss }}, n = {{ n }}, l = {{ list }};</script>`,
+			`<script>var s = "\u003c/script\u003e\u003cscript\u003ealert('x')\u003c/script\u003e", n = 42, l = ["a","\u003cb\u003e"];</script>`},
+		{`<script>var s = "{{ quote }}"; // it's
+var t = '{{ q }}';</script>`, `<script>var s = "\u0022 onmouseover\u003D\u0022alert(1)"; // it's
+var t = 'a b\u0026c\u003Dd';</script>`},
+		{`<script>/* "a */ var s = {{ q }};</script>{{ q }}`, `<script>/* "a */ var s = "a b\u0026c=d";</script>a b&amp;c=d`},
+		{`<button onclick="f({{ q }}, '{{ q }}')">`, `<button onclick="f(&quot;a b\u0026c=d&quot;, 'a b\u0026c\u003Dd')">`},
+		{`<button onclick="f('{{ q|escapejs }}')">`, `<button onclick="f('a b\u0026c\u003Dd')">`},
+		{`<a href="{{ js }}">`, `<a href="#ZgotmplZ">`},
+		{`<a href="/search?q={{ q }}&n={{ n }}">`, `<a href="/search?q=a%20b%26c%3Dd&n=42">`},
+		{`<a href="/{{ q }}">`, `<a href="/a%20b&amp;c=d">`},
+		{`<a href="/?q={{ q|urlencode }}">`, `<a href="/?q=a+b%26c%3Dd">`},
+		{`<style>p { color: {{ q }}; }</style><p style="width: {{ n }}px">`, `<style>p { color: a b\26 c\3D d; }</style><p style="width: 42px">`},
+		{`<!-- {{ xss }} --><p>{{ xss|safe }}</p>`, `<!-- &lt;/script&gt;&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; --><p></script><script>alert('x')</script></p>`},
+		{`<p>{{ xss|escape }}</p>`, `<p>&lt;/script&gt;&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt;</p>`},
+		{`{% autoescape off %}<script>{{ q }}</script>{% endautoescape %}`, `<script>a b&c=d</script>`},
+		// Quotes in regular expression literals don't start strings
+		{`<script>var re = /"/; var s = "{{ quote }}";</script>`, `<script>var re = /"/; var s = "\u0022 onmouseover\u003D\u0022alert(1)";</script>`},
+		{`<script>if (/[/"]+/.test(s)) return '{{ q }}';</script>`, `<script>if (/[/"]+/.test(s)) return 'a b\u0026c\u003Dd';</script>`},
+		{`<script>var x = n / 2, y = "{{ q }}" / {{ n }} / "{{ q }}";</script>`, `<script>var x = n / 2, y = "a b\u0026c\u003Dd" / 42 / "a b\u0026c\u003Dd";</script>`},
+		{`<script>return /{{ q }}.*{{ "(a.b)" }}/.test(s) ? {{ n }} : 0</script>`, `<script>return /a b\u0026c\u003Dd.*\u0028a\u002Eb\u0029/.test(s) ? 42 : 0</script>`},
+		{`<script>var l = [{% for x in list %}{{ x }}{% if not forloop.Last %}, {% endif %}{% endfor %}];</script>`, `<script>var l = ["a", "\u003cb\u003e"];</script>`},
+		// Branches are scanned separately
+		{`{% if n %}<a href="{{ js }}">{% else %}<a title="{{ js }}">{% endif %}{{ js }}`, `<a href="#ZgotmplZ">javascript:alert(1)`},
+		{`{% for x in list %}<a href="/{{ x }}">{% empty %}<p>{% endfor %}{{ js }}`, `<a href="/a"><a href="/%3Cb%3E">javascript:alert(1)`},
+	}
+	for _, test := range tests {
+		tpl, err := set.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := tpl.Execute(ctx); err != nil || out != test.want {
+			t.Errorf("%s:\ngot  %q, %v\nwant %q", test.tpl, out, err, test.want)
+		}
+	}
+
+	// Branches ending in different contexts can't be escaped
+	for _, src := range []string{
+		`{% if n %}<a href="{% else %}<a title="{% endif %}{{ js }}">`,
+		`{% if n %}<a href="{% elif q %}<a title="{% else %}<p title="{% endif %}{{ js }}">`,
+		`<a title="{% if n %}"><a href="{% endif %}{{ js }}">`,
+		`<script>{% ifequal n 1 %}var s = "{% endifequal %}{{ q }}";</script>`,
+		`{% for x in list %}<a href="{% endfor %}{{ js }}">`,
+		`<script>var a = b{% if n %} +{% endif %} /{{ q }}/g;</script>`,
+	} {
+		if _, err := set.FromString(src); err == nil {
+			t.Errorf("%s: expected a parse error", src)
+		}
+	}
+
+	// Blocks of child templates start in the context of the parent's block
+	fsSet := pongo2.NewSet("contextual blocks", pongo2.NewFSLoader(fstest.MapFS{
+		"base.html":  {Data: []byte(`<script>var data = {% block data %}{% endblock %};</script><p>{% block text %}{% endblock %}</p>`)},
+		"child.html": {Data: []byte(`{% extends "base.html" %}{% block data %}{{ q }}{% endblock %}{% block text %}{{ q }}{% endblock %}`)},
+	}))
+	fsSet.Options.ContextualAutoescape = true
+	tpl, err := fsSet.FromFile("child.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Execute(ctx); err != nil || out != `<script>var data = "a b\u0026c=d";</script><p>a b&amp;c=d</p>` {
+		t.Errorf("blocks: got %q, %v", out, err)
+	}
+}
+
+func TestEscapers(t *testing.T) {
+	ctx := pongo2.Context{
+		"s":    "say \"hi\",\nit's <b>",
+		"n":    42,
+		"list": []any{"a", 1, true},
+		"tex":  `50% of $x_1 & {y}`,
+	}
+	tests := []struct {
+		escaper, tpl, want string
+	}{
+		{"", `{{ s }}`, "say &quot;hi&quot;,\nit&#39;s &lt;b&gt;"},
+		{"html", `{{ s|safe }}`, "say \"hi\",\nit's <b>"},
+		{"none", `{{ s }}`, "say \"hi\",\nit's <b>"},
+		{"json", `{"s": {{ s }}, "n": {{ n }}, "list": {{ list }}, "raw": "{{ s|safe }}"}`,
+			`{"s": "say \"hi\",\nit's <b>", "n": 42, "list": ["a",1,true], "raw": "say "hi",` + "\nit's <b>\"}"},
+		{"yaml", `s: {{ s }}`, `s: "say \"hi\",\nit's <b>"`},
+		{"csv", `{{ n }},{{ s }},{{ list.0 }}`, "42,\"say \"\"hi\"\",\nit's <b>\",a"},
+		{"shell", `echo {{ s }}`, `echo 'say "hi",` + "\nit'\\''s <b>'"},
+		{"latex", `{{ tex }}`, `50\% of \$x\_1 \& \{y\}`},
+		{"", `{% autoescape "json" %}{{ s }}{% endautoescape %} {{ s }}`, `"say \"hi\",\nit's <b>" say &quot;hi&quot;,` + "\nit&#39;s &lt;b&gt;"},
+		{"json", `{% autoescape off %}{{ s }}{% endautoescape %}|{% autoescape "none" %}{% autoescape on %}{{ s }}{% endautoescape %}{% endautoescape %}`,
+			"say \"hi\",\nit's <b>|say &quot;hi&quot;,\nit&#39;s &lt;b&gt;"},
+		{"csv", `{% firstof "" s %}`, "\"say \"\"hi\"\",\nit's <b>\""},
+	}
+	for _, test := range tests {
+		set := pongo2.NewSet("escapers", &DummyLoader{})
+		set.Options.Escaper = test.escaper
+		tpl, err := set.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := tpl.Execute(ctx); err != nil || out != test.want {
+			t.Errorf("%s %s:\ngot  %q, %v\nwant %q", test.escaper, test.tpl, out, err, test.want)
+		}
+	}
+
+	// Custom escapers
+	if err := pongo2.RegisterEscaper("upper", pongo2.EscaperFunc(func(v *pongo2.Value) string {
+		return strings.ToUpper(v.String())
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := pongo2.RegisterEscaper("json", pongo2.EscaperFunc((*pongo2.Value).String)); err == nil {
+		t.Error("registering an escaper twice must fail")
+	}
+	set := pongo2.NewSet("custom escaper", &DummyLoader{})
+	tpl := pongo2.Must(set.FromString(`{% autoescape "upper" %}{{ s }}{% endautoescape %}`))
+	if out, err := tpl.Execute(pongo2.Context{"s": "abc"}); err != nil || out != "ABC" {
+		t.Errorf("custom escaper: got %q, %v", out, err)
+	}
+
+	// Unknown escapers
+	if _, err := set.FromString(`{% autoescape "xml" %}{% endautoescape %}`); err == nil {
+		t.Error("unknown escaper in autoescape-tag must fail to parse")
+	}
+	set.Options.Escaper = "xml"
+	if _, err := pongo2.Must(set.FromString(`{{ s }}`)).Execute(nil); err == nil {
+		t.Error("unknown Options.Escaper must fail to execute")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	set := pongo2.NewSet("json", &DummyLoader{})
+	set.Options.JSONOutput = true
+	ctx := pongo2.Context{
+		"name":    "a \"quoted\"\nname's <b>",
+		"n":       42,
+		"ok":      true,
+		"nothing": nil,
+		"tags":    []string{"x", "y"},
+		"meta":    map[string]any{"b": 1.5, "a": nil},
+	}
+	tests := []struct {
+		tpl, want string
+	}{
+		{`{"name": {{ name }}, "n": {{ n }}, "ok": {{ ok }}, "nothing": {{ nothing }}}`,
+			`{"name": "a \"quoted\"\nname's <b>", "n": 42, "ok": true, "nothing": null}`},
+		{`{"tags": {{ tags }}, "meta": {{ meta }}}`, `{"tags": ["x","y"], "meta": {"a":null,"b":1.5}}`},
+		{`{"greeting": "Hello {{ name }}!", "esc\"aped {{ n }}": {{ n }}}`,
+			`{"greeting": "Hello a \"quoted\"\nname's <b>!", "esc\"aped 42": 42}`},
+		{`{"greeting": "{{ name|escapejs }}"}`, `{"greeting": "a \u0022quoted\u0022\u000Aname\u0027s \u003Cb\u003E"}`},
+		{`{"meta": {{ meta|tojson }}, "name": {{ name|upper }}}`, `{"meta": {"a":null,"b":1.5}, "name": "A \"QUOTED\"\nNAME'S <B>"}`},
+		{`{% autoescape "none" %}{"n": {{ n }}}{% endautoescape %}`, `{"n": 42}`},
+	}
+	for _, test := range tests {
+		tpl, err := set.FromString(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Execute(ctx)
+		if err != nil || out != test.want {
+			t.Errorf("%s:\ngot  %q, %v\nwant %q", test.tpl, out, err, test.want)
+			continue
+		}
+		var v any
+		if err := json.Unmarshal([]byte(out), &v); err != nil {
+			t.Errorf("%s: invalid JSON: %v", test.tpl, err)
+		}
+	}
+
+	// Malformed output
+	tpl := pongo2.Must(set.FromString("{\n  \"a\": {{ n }},\n  \"b\": {{ name|safe }}\n}"))
+	for _, execute := range []func() error{
+		func() error { _, err := tpl.Execute(ctx); return err },
+		func() error { _, err := tpl.ExecuteBytes(ctx); return err },
+		func() error { return tpl.ExecuteWriter(ctx, io.Discard) },
+		func() error { return tpl.ExecuteWriterUnbuffered(ctx, io.Discard) },
+	} {
+		err := execute()
+		var jsonErr *pongo2.JSONOutputError
+		if !errors.As(err, &jsonErr) {
+			t.Fatalf("expected a JSONOutputError, got %v", err)
+		}
+		if jsonErr.Line != 3 || jsonErr.Column != 8 || jsonErr.Offset != 20 || !strings.Contains(jsonErr.Excerpt, `"b": a`) {
+			t.Errorf("got %+v", jsonErr)
+		}
+	}
+	if _, err := pongo2.Must(set.FromString(`{"a": 1} {{ n }}`)).Execute(ctx); err == nil {
+		t.Error("trailing data must be malformed")
+	}
+	if _, err := pongo2.Must(set.FromString(`{{ nothing|default:"" }}`)).Execute(ctx); err != nil {
+		t.Errorf("a JSON string is a valid document: %v", err)
+	}
+	if _, err := set.FromString(`{"a": {% if n %}"{% endif %}{{ name }}"}`); err == nil {
+		t.Error("branches ending inside and outside of a string literal must fail to parse")
+	}
+}
+
+func TestJSONFilters(t *testing.T) {
+	set := pongo2.NewSet("json filters", &DummyLoader{})
+	tpl := pongo2.Must(set.FromString(`{% with v=data|fromjson %}{{ v.list.1 }} {{ v.list.1 + 1 }} {{ v.obj.name }} {{ v|tojson:2 }}{% endwith %}`))
+	out, err := tpl.Execute(pongo2.Context{"data": `{"list": [1, 2], "obj": {"name": "<x>"}}`})
+	want := "2 3 &lt;x&gt; {\n  \"list\": [\n    1,\n    2\n  ],\n  \"obj\": {\n    \"name\": \"\\u003cx\\u003e\"\n  }\n}"
+	if err != nil || out != want {
+		t.Errorf("got %q, %v\nwant %q", out, err, want)
+	}
+
+	if _, err := pongo2.Must(set.FromString(`{{ data|fromjson }}`)).Execute(pongo2.Context{"data": `{"a": `}); err == nil {
+		t.Error("fromjson of invalid JSON must fail")
+	}
+
+	// Numbers are converted like the ones of json.RawMessages
+	data := `{"n": [0, -7, 2147483648, 1e2, 2.5, 123456789012345678901234567890]}`
+	tpl = pongo2.Must(set.FromString(`{% for n in v.n %}{{ n }} {{ n|add:1 }} {% endfor %}`))
+	fromRaw, err := tpl.Execute(pongo2.Context{"v": json.RawMessage(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl = pongo2.Must(set.FromString(`{% with v=data|fromjson %}{% for n in v.n %}{{ n }} {{ n|add:1 }} {% endfor %}{% endwith %}`))
+	fromFilter, err := tpl.Execute(pongo2.Context{"data": data})
+	if err != nil || fromFilter != fromRaw {
+		t.Errorf("fromjson: got %q, %v; json.RawMessage: %q", fromFilter, err, fromRaw)
+	}
+}
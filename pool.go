@@ -0,0 +1,77 @@
+package pongo2
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Pools of the internal state of executions, to reduce the allocations
+// (and the garbage) per execution. Only state which custom tags, filters
+// and functions can't reach is pooled: ExecutionContexts and the Contexts
+// they're executed with are handed out to them (and may be kept by them),
+// so they're never reused. Values are shared instead (see sharedValue()).
+
+// Buffers and contexts grown larger than this aren't put back into the
+// pools, so a single large execution doesn't keep its memory alive.
+const (
+	maxPooledBufferSize  = 64 << 10
+	maxPooledContextSize = 256
+)
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer with room for at least size bytes.
+// Return it with putBuffer() once its contents aren't referenced anymore.
+func getBuffer(size int) *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Grow(size)
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+var limitedBufferPool = sync.Pool{
+	New: func() any { return &limitedBuffer{Buffer: new(bytes.Buffer)} },
+}
+
+var executionStatePool = sync.Pool{
+	New: func() any { return new(executionState) },
+}
+
+// releaseExecutionState returns the state of a finished execution to the
+// pool. The state must not be used by any goroutine anymore (like the ones
+// of parallel includes).
+func releaseExecutionState(s *executionState) {
+	*s = executionState{}
+	executionStatePool.Put(s)
+}
+
+var scratchContextPool = sync.Pool{
+	New: func() any { return make(Context) },
+}
+
+// getScratchContext returns an empty Context for internal use only, like
+// building the context of an included template (which is copied by the
+// execution). It must not be handed out (e. g. as an ExecutionContext's
+// Public or Private context). Return it with putScratchContext().
+func getScratchContext() Context {
+	return scratchContextPool.Get().(Context)
+}
+
+func putScratchContext(c Context) {
+	if len(c) > maxPooledContextSize {
+		return
+	}
+	for k := range c {
+		delete(c, k)
+	}
+	scratchContextPool.Put(c)
+}
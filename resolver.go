@@ -0,0 +1,226 @@
+package pongo2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Resolver can be implemented by types which resolve their attributes
+// themselves. Templates accessing an attribute of such a value by name
+// (e. g. {{ event.user }} or {{ event.user() }}) call Resolve() instead of
+// looking up struct fields and methods using reflection, which is a lot
+// faster for large structs. If Resolve() reports false, the attribute is
+// missing and the set's undefined policy applies; fields and methods of the
+// type aren't considered then.
+//
+// Attributes returned by a Resolver are not subject to the set's
+// AttributePolicy (like map keys aren't).
+type Resolver interface {
+	// Resolve returns the value of the attribute name (which may be a
+	// *Value or a function like any other value in a Context) and whether
+	// it exists.
+	Resolve(name string) (any, bool)
+}
+
+var typeOfResolver = reflect.TypeOf((*Resolver)(nil)).Elem()
+
+// typeInfo caches the results of the reflection lookups the variable
+// resolver does on a type.
+type typeInfo struct {
+	fields   map[string][]int // struct fields as returned by Type.FieldByName()
+	methods  map[string]int   // method indexes as returned by Type.MethodByName()
+	resolver bool             // whether the type implements Resolver
+}
+
+// typeInfos holds the *typeInfo of all types seen so far. They're keyed by
+// type only (not by the looked up names), so names evaluated at runtime
+// (e. g. {{ obj[name] }}) can't grow it.
+var typeInfos sync.Map // reflect.Type -> *typeInfo
+
+func typeInfoOf(t reflect.Type) *typeInfo {
+	if info, ok := typeInfos.Load(t); ok {
+		return info.(*typeInfo)
+	}
+
+	info := &typeInfo{
+		methods:  make(map[string]int, t.NumMethod()),
+		resolver: t.Implements(typeOfResolver),
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		info.methods[t.Method(i).Name] = i
+	}
+	if t.Kind() == reflect.Struct {
+		// Every field FieldByName() finds is visible, but not every visible
+		// field is found (e. g. ambiguous ones), so ask FieldByName() to get
+		// the same results.
+		visible := reflect.VisibleFields(t)
+		info.fields = make(map[string][]int, len(visible))
+		for _, f := range visible {
+			if field, ok := t.FieldByName(f.Name); ok {
+				info.fields[f.Name] = field.Index
+			}
+		}
+	}
+
+	actual, _ := typeInfos.LoadOrStore(t, info)
+	return actual.(*typeInfo)
+}
+
+// fieldByName is like v.FieldByName(name), but cached per type. v must be
+// a struct.
+func fieldByName(v reflect.Value, name string) reflect.Value {
+	index, ok := typeInfoOf(v.Type()).fields[name]
+	if !ok {
+		return reflect.Value{}
+	}
+	return v.FieldByIndex(index)
+}
+
+// methodByName is like v.MethodByName(name), but cached per type.
+func methodByName(v reflect.Value, name string) reflect.Value {
+	index, ok := typeInfoOf(v.Type()).methods[name]
+	if !ok {
+		return reflect.Value{}
+	}
+	return v.Method(index)
+}
+
+// resolverOf returns v as Resolver if its type implements it (and it's not
+// a nil pointer or interface).
+func resolverOf(v reflect.Value) (Resolver, bool) {
+	if !typeInfoOf(v.Type()).resolver || !v.CanInterface() {
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+	}
+	r, ok := v.Interface().(Resolver)
+	return r, ok
+}
+
+// TypeResolver resolves the attributes and items of values of a type which
+// doesn't implement Resolver, e. g. a type of another package like
+// *structpb.Struct or a gjson document. key is a string for attributes
+// ({{ doc.name }}), an int for numeric parts ({{ doc.0 }}) and the evaluated
+// subscript for subscripts ({{ doc[key] }}, usually a string or an int).
+// The second result reports whether the key exists; if not, the set's
+// undefined policy applies. The returned value is resolved further like any
+// other value, so it may be another document of the same type.
+//
+// TypeResolvers are registered for a type using RegisterTypeResolver() or
+// TemplateSet.RegisterTypeResolver() and take precedence over the Resolver
+// interface and the reflection based lookups. json.RawMessage values are
+// resolved without one (they're decoded once per execution), unless one is
+// registered for them.
+type TypeResolver func(value any, key any) (any, bool)
+
+// Registry of all global type resolvers
+var typeResolvers = make(map[reflect.Type]TypeResolver)
+
+// RegisterTypeResolver registers a global resolver for values of type t
+// (see TypeResolver). Register resolvers during the initialization of your
+// program only, the registry isn't synchronized.
+func RegisterTypeResolver(t reflect.Type, fn TypeResolver) error {
+	if _, existing := typeResolvers[t]; existing {
+		return fmt.Errorf("type resolver for type %s is already registered", t)
+	}
+	typeResolvers[t] = fn
+	return nil
+}
+
+func MustRegisterTypeResolver(t reflect.Type, fn TypeResolver) {
+	if err := RegisterTypeResolver(t, fn); err != nil {
+		panic(err)
+	}
+}
+
+var typeOfJSONRawMessage = reflect.TypeOf(json.RawMessage(nil))
+
+// jsonDocumentKey identifies a json.RawMessage by its bytes.
+type jsonDocumentKey struct {
+	data *byte
+	len  int
+}
+
+// jsonDocument decodes raw, a json.RawMessage whose attributes or items are
+// accessed, like the fromjson filter does: objects and arrays are decoded to
+// map[string]any and []any (so they're resolved, iterated and used with
+// filters as usual), integers to ints and all other numbers to float64s.
+// Each document is decoded once per execution, no matter how many of its
+// attributes are accessed. It reports false if raw isn't valid JSON.
+func (s *executionState) jsonDocument(raw json.RawMessage) (any, bool) {
+	if len(raw) == 0 {
+		return nil, false
+	}
+	key := jsonDocumentKey{data: &raw[0], len: len(raw)}
+	if s != nil {
+		s.jsonMu.Lock()
+		doc, has := s.jsonDocs[key]
+		s.jsonMu.Unlock()
+		if has {
+			return doc, doc != nil
+		}
+	}
+
+	doc, err := decodeJSON(bytes.NewReader(raw))
+	if err != nil {
+		doc = nil
+	}
+
+	if s != nil {
+		s.jsonMu.Lock()
+		if s.jsonDocs == nil {
+			s.jsonDocs = make(map[jsonDocumentKey]any)
+		}
+		s.jsonDocs[key] = doc
+		s.jsonMu.Unlock()
+	}
+	return doc, doc != nil
+}
+
+// decodeJSON decodes a single JSON value (like json.RawMessages and the
+// fromjson filter's input) with the numbers converted by jsonNumbers().
+func decodeJSON(r io.Reader) (any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("invalid data after the JSON value")
+	}
+	return jsonNumbers(v), nil
+}
+
+// jsonNumbers replaces the json.Numbers of a decoded JSON value by ints (if
+// they're integers fitting into an int) or float64s, so they're output and
+// compared like numbers in templates.
+func jsonNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.Atoi(string(v)); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, item := range v {
+			v[k] = jsonNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = jsonNumbers(item)
+		}
+	}
+	return v
+}
@@ -99,17 +99,19 @@ func (p *Parser) parseTagElement() (INodeTag, *Error) {
 	}
 
 	// Check for the existing tag
-	tag, exists := tags[tokenName.Val]
+	tag, exists := p.template.set.lookupTag(tokenName.Val)
 	if !exists {
 		// Does not exists
 		return nil, p.Error(fmt.Errorf("Tag '%s' not found (or beginning tag not provided)", tokenName.Val), tokenName)
 	}
 
 	// Check sandbox tag restriction
-	if _, isBanned := p.template.set.bannedTags[tokenName.Val]; isBanned {
-		return nil, p.Error(fmt.Errorf("Usage of tag '%s' is not allowed (sandbox restriction active).", tokenName.Val), tokenName)
+	if !p.template.set.tagAllowed(tokenName.Val) {
+		return nil, p.sandboxError(fmt.Errorf("Usage of tag '%s' is not allowed (sandbox restriction active).", tokenName.Val), tokenName)
 	}
 
+	p.template.tagTokens = append(p.template.tagTokens, tokenName)
+
 	var argsToken []*Token
 	for p.Peek(TokenSymbol, "%}") == nil && p.Remaining() > 0 {
 		// Add token to args
@@ -1,22 +1,20 @@
 package pongo2
 
-import (
-	"bytes"
-)
-
 type tagAllowMissingVal struct {
 	position    *Token
 	bodyWrapper *NodeWrapper
 }
 
 func (node *tagAllowMissingVal) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	temp := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB size
+	temp := ctx.state.getBuffer(1024) // 1 KiB size
+	defer temp.put()
 	ctx.AllowMissingVal = true
 
 	err := node.bodyWrapper.Execute(ctx, temp)
 	if err != nil {
 		return err
 	}
+	temp.release()
 	templateSet := ctx.template.set
 	currentTemplate, err2 := templateSet.FromBytes(temp.Bytes())
 	if err2 != nil {
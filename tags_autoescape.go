@@ -5,18 +5,25 @@ import "fmt"
 type tagAutoescapeNode struct {
 	wrapper    *NodeWrapper
 	autoescape bool
+	escaper    string // name of the escaper to switch to, if any
 }
 
 func (node *tagAutoescapeNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	old := ctx.Autoescape
-	ctx.Autoescape = node.autoescape
+	old, oldEscaper := ctx.Autoescape, ctx.escaper
+	if node.escaper != "" {
+		if err := ctx.setEscaper(node.escaper); err != nil {
+			return ctx.Error(err, nil)
+		}
+	} else {
+		ctx.Autoescape = node.autoescape
+	}
 
 	err := node.wrapper.Execute(ctx, writer)
 	if err != nil {
 		return err
 	}
 
-	ctx.Autoescape = old
+	ctx.Autoescape, ctx.escaper = old, oldEscaper
 
 	return nil
 }
@@ -30,16 +37,23 @@ func tagAutoescapeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag
 	}
 	autoescapeNode.wrapper = wrapper
 
-	modeToken := arguments.MatchType(TokenIdentifier)
-	if modeToken == nil {
-		return nil, arguments.Error(fmt.Errorf("A mode is required for autoescape-tag."), nil)
-	}
-	if modeToken.Val == "on" {
-		autoescapeNode.autoescape = true
-	} else if modeToken.Val == "off" {
-		autoescapeNode.autoescape = false
+	if escaperToken := arguments.MatchType(TokenString); escaperToken != nil {
+		if _, err := lookupEscaper(escaperToken.Val); err != nil {
+			return nil, arguments.Error(err, escaperToken)
+		}
+		autoescapeNode.escaper = escaperToken.Val
 	} else {
-		return nil, arguments.Error(fmt.Errorf("Only 'on' or 'off' is valid as an autoescape-mode."), nil)
+		modeToken := arguments.MatchType(TokenIdentifier)
+		if modeToken == nil {
+			return nil, arguments.Error(fmt.Errorf("A mode is required for autoescape-tag."), nil)
+		}
+		if modeToken.Val == "on" {
+			autoescapeNode.autoescape = true
+		} else if modeToken.Val == "off" {
+			autoescapeNode.autoescape = false
+		} else {
+			return nil, arguments.Error(fmt.Errorf("Only 'on', 'off' or the name of an escaper is valid as an autoescape-mode."), nil)
+		}
 	}
 
 	if arguments.Remaining() > 0 {
@@ -1,12 +1,13 @@
 package pongo2
 
 import (
-	"bytes"
 	"fmt"
+	"sync/atomic"
 )
 
 type tagBlockNode struct {
-	name string
+	position *Token // name of the block
+	name     string
 }
 
 func (node *tagBlockNode) getBlockWrappers(tpl *Template) []*NodeWrapper {
@@ -43,11 +44,18 @@ func (node *tagBlockNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		ctx:      ctx,
 		wrappers: blockWrappers[0 : lenBlockWrappers-1],
 	}
+	depth := atomic.AddInt32(&ctx.state.blockDepth, 1)
 	err := blockWrapper.Execute(ctx, writer)
+	atomic.AddInt32(&ctx.state.blockDepth, -1)
 	if err != nil {
 		return err
 	}
 
+	if ctx.state.flushBlocks && depth == 1 {
+		if err := ctx.state.flush(); err != nil {
+			return ctx.Error(err, node.position)
+		}
+	}
 	return nil
 }
 
@@ -70,8 +78,9 @@ func (t tagBlockInformation) Super() (*Value, error) {
 	}
 
 	blockWrapper := t.wrappers[lenWrappers-1]
-	buf := bytes.NewBufferString("")
-	err := blockWrapper.Execute(superCtx, &templateWriter{buf})
+	buf := superCtx.state.getBuffer(0)
+	defer buf.put()
+	err := blockWrapper.Execute(superCtx, buf)
 	if err != nil {
 		return AsSafeValue(""), err
 	}
@@ -121,7 +130,10 @@ func tagBlockParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 		return nil, arguments.Error(fmt.Errorf("Block named '%s' already defined", nameToken.Val), nil)
 	}
 
-	return &tagBlockNode{name: nameToken.Val}, nil
+	return &tagBlockNode{
+		position: nameToken,
+		name:     nameToken.Val,
+	}, nil
 }
 
 func init() {
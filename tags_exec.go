@@ -1,9 +1,6 @@
 package pongo2
 
-import (
-	"bytes"
-	"fmt"
-)
+import "fmt"
 
 type tagExecNode struct {
 	position    *Token
@@ -11,12 +8,24 @@ type tagExecNode struct {
 }
 
 func (node *tagExecNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	temp := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB size
+	temp := ctx.state.getBuffer(1024) // 1 KiB size
+	defer temp.put()
 
 	err := node.bodyWrapper.Execute(ctx, temp)
 	if err != nil {
 		return err
 	}
+	temp.release()
+	if err := ctx.checkCancelled(node.position); err != nil {
+		return err
+	}
+	if max := ctx.state.limits.MaxExecDepth; max > 0 && ctx.execDepth >= max {
+		return ctx.limitError("limit:exec",
+			fmt.Errorf("maximum exec nesting depth reached (max is %d)", max), node.position)
+	}
+	ctx.execDepth++
+	defer func() { ctx.execDepth-- }()
+
 	templateSet := ctx.template.set
 	currentTemplate, err2 := templateSet.FromBytes(temp.Bytes())
 	if err2 != nil {
@@ -3,6 +3,7 @@ package pongo2
 import "fmt"
 
 type tagExtendsNode struct {
+	position *Token
 	filename string
 }
 
@@ -11,7 +12,9 @@ func (node *tagExtendsNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 }
 
 func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	extendsNode := &tagExtendsNode{}
+	extendsNode := &tagExtendsNode{
+		position: start,
+	}
 
 	if doc.template.level > 1 {
 		return nil, arguments.Error(fmt.Errorf("The 'extends' tag can only defined on root level."), start)
@@ -31,12 +34,14 @@ func tagExtendsParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 		// Parse the parent
 		parentTemplate, err := doc.template.set.FromFile(parentFilename)
 		if err != nil {
-			return nil, err.(*Error)
+			return nil, err.(*Error).pushFrame("extends", start)
 		}
 
 		// Keep track of things
 		parentTemplate.child = doc.template
 		doc.template.parent = parentTemplate
+		doc.template.addDependency(parentTemplate)
+		doc.template.extendsToken = start
 		extendsNode.filename = parentFilename
 	} else {
 		return nil, arguments.Error(fmt.Errorf("Tag 'extends' requires a template filename as string."), nil)
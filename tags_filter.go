@@ -1,13 +1,12 @@
 package pongo2
 
-import (
-	"bytes"
-	"fmt"
-)
+import "fmt"
 
 type nodeFilterCall struct {
-	name      string
-	paramExpr IEvaluator
+	token      *Token
+	name       string
+	paramExpr  IEvaluator
+	filterFunc FilterFunction
 }
 
 type tagFilterNode struct {
@@ -17,12 +16,14 @@ type tagFilterNode struct {
 }
 
 func (node *tagFilterNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	temp := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB size
+	temp := ctx.state.getBuffer(1024) // 1 KiB size
+	defer temp.put()
 
 	err := node.bodyWrapper.Execute(ctx, temp)
 	if err != nil {
 		return err
 	}
+	temp.release()
 
 	value := AsValue(temp.String())
 
@@ -36,7 +37,7 @@ func (node *tagFilterNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 		} else {
 			param = AsValue(nil)
 		}
-		value, err = ApplyFilter(call.name, value, param)
+		value, err = call.filterFunc(value, param)
 		if err != nil {
 			return ctx.Error(err, node.position)
 		}
@@ -67,8 +68,18 @@ func tagFilterParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 		if nameToken == nil {
 			return nil, arguments.Error(fmt.Errorf("Expected a filter name (identifier)."), nil)
 		}
+		filterCall.token = nameToken
 		filterCall.name = nameToken.Val
 
+		filterFn, exists := doc.template.set.lookupFilter(nameToken.Val)
+		if !exists {
+			return nil, arguments.Error(fmt.Errorf("Filter '%s' does not exist.", nameToken.Val), nameToken)
+		}
+		if !doc.template.set.filterAllowed(nameToken.Val) {
+			return nil, arguments.sandboxError(fmt.Errorf("Usage of filter '%s' is not allowed (sandbox restriction active).", nameToken.Val), nameToken)
+		}
+		filterCall.filterFunc = filterFn
+
 		if arguments.MatchOne(TokenSymbol, ":") != nil {
 			// Filter parameter
 			// NOTICE: we can't use ParseExpression() here, because it would parse the next filter "|..." as well in the argument list
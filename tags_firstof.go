@@ -13,14 +13,12 @@ func (node *tagFirstofNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 		}
 
 		if val.IsTrue() {
+			s := val.String()
 			if ctx.Autoescape && !arg.FilterApplied("safe") {
-				val, err = ApplyFilter("escape", val, nil)
-				if err != nil {
-					return err
-				}
+				s = ctx.escaper.Escape(val)
 			}
 
-			if _, err := writer.WriteString(val.String()); err != nil {
+			if _, err := writer.WriteString(s); err != nil {
 				return ctx.Error(err, node.position)
 			}
 			return nil
@@ -0,0 +1,30 @@
+package pongo2
+
+import "fmt"
+
+type tagFlushNode struct {
+	position *Token
+}
+
+func (node *tagFlushNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	if err := ctx.state.flush(); err != nil {
+		return ctx.Error(err, node.position)
+	}
+	return nil
+}
+
+// {% flush %} flushes the output written so far if the writer can be flushed
+// (see Options.FlushBytes), also within included templates (unless they're
+// rendered in parallel, see Options.ParallelIncludes). Within tags capturing
+// their content (like filter or spaceless) only the output before them is
+// flushed.
+func tagFlushParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	if arguments.Remaining() > 0 {
+		return nil, arguments.Error(fmt.Errorf("Tag 'flush' does not take any argument."), nil)
+	}
+	return &tagFlushNode{position: start}, nil
+}
+
+func init() {
+	MustRegisterTag("flush", tagFlushParser)
+}
@@ -3,6 +3,7 @@ package pongo2
 import "fmt"
 
 type tagForNode struct {
+	position        *Token
 	key             string
 	value           string // only for maps: for key, value in map
 	objectEvaluator IEvaluator
@@ -23,7 +24,14 @@ type tagForLoopInformation struct {
 	Parentloop  *tagForLoopInformation
 }
 
-func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (forError *Error) {
+func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	return node.iterate(ctx, &wrapperBodies{body: node.bodyWrapper, empty: node.emptyWrapper, writer: writer})
+}
+
+// iterate executes the body for each item (with the loop variables and the
+// forloop set in its context) or the empty body if there's nothing to
+// iterate over. It's shared by Execute and templates compiled to Go code.
+func (node *tagForNode) iterate(ctx *ExecutionContext, bodies tagBodies) (forError *Error) {
 	// Backup forloop (as parentloop in public context), key-name and value-name
 	forCtx := NewChildExecutionContext(ctx)
 	parentloop := forCtx.Private["forloop"]
@@ -48,6 +56,10 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 
 	obj.IterateOrder(func(idx, count int, key, value *Value) bool {
 		// There's something to iterate over (correct type and at least 1 item)
+		if err := forCtx.enterLoopIteration(node.position); err != nil {
+			forError = err
+			return false
+		}
 
 		// Update loop infos and public context
 		forCtx.Private[node.key] = key
@@ -66,7 +78,7 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 		loopInfo.Revcounter0 = count - (idx + 1) // TODO: Not sure about this, have to look it up
 
 		// Render elements with updated context
-		err := node.bodyWrapper.Execute(forCtx, writer)
+		err := bodies.executeBody(forCtx)
 		if err != nil {
 			forError = err
 			return false
@@ -74,19 +86,16 @@ func (node *tagForNode) Execute(ctx *ExecutionContext, writer TemplateWriter) (f
 		return true
 	}, func() {
 		// Nothing to iterate over (maybe wrong type or no items)
-		if node.emptyWrapper != nil {
-			err := node.emptyWrapper.Execute(forCtx, writer)
-			if err != nil {
-				forError = err
-			}
-		}
+		forError = bodies.executeEmpty(forCtx)
 	}, node.reversed, node.sorted)
 
 	return forError
 }
 
 func tagForParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	forNode := &tagForNode{}
+	forNode := &tagForNode{
+		position: start,
+	}
 
 	// Arguments parsing
 	var valueToken *Token
@@ -17,11 +17,12 @@ func (node *tagIfchangedNode) Execute(ctx *ExecutionContext, writer TemplateWrit
 	if len(node.watchedExpr) == 0 {
 		// Check against own rendered body
 
-		buf := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB
+		buf := &limitedBuffer{Buffer: bytes.NewBuffer(make([]byte, 0, 1024)), state: ctx.state} // 1 KiB
 		err := node.thenWrapper.Execute(ctx, buf)
 		if err != nil {
 			return err
 		}
+		buf.release()
 
 		bufBytes := buf.Bytes()
 		if !bytes.Equal(node.lastContent, bufBytes) {
@@ -14,6 +14,9 @@ func (node *tagImportNode) Execute(ctx *ExecutionContext, writer TemplateWriter)
 	for name, macro := range node.macros {
 		func(name string, macro *tagMacroNode) {
 			ctx.Private[name] = func(args ...*Value) (*Value, error) {
+				if err := ctx.checkCancelled(macro.position); err != nil {
+					return nil, err
+				}
 				return macro.call(ctx, args...)
 			}
 		}(name, macro)
@@ -41,8 +44,9 @@ func tagImportParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *E
 	// Compile the given template
 	tpl, err := doc.template.set.FromFile(importNode.filename)
 	if err != nil {
-		return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, start)
+		return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, start).pushFrame("import", start)
 	}
+	doc.template.addDependency(tpl)
 
 	for arguments.Remaining() > 0 {
 		macroNameToken := arguments.MatchType(TokenIdentifier)
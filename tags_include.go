@@ -3,6 +3,7 @@ package pongo2
 import "fmt"
 
 type tagIncludeNode struct {
+	position          *Token
 	tpl               *Template
 	filenameEvaluator IEvaluator
 	lazy              bool
@@ -13,8 +14,19 @@ type tagIncludeNode struct {
 }
 
 func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	// Building the context for the template
-	includeCtx := make(Context)
+	tpl, includeCtx, err := node.prepare(ctx)
+	if err != nil || tpl == nil {
+		return err
+	}
+	return node.executeIncluded(ctx, tpl, includeCtx, writer)
+}
+
+// prepare determines the template to include and builds its context. The
+// template is nil if it doesn't exist, but the include is optional.
+func (node *tagIncludeNode) prepare(ctx *ExecutionContext) (*Template, Context, *Error) {
+	// Building the context for the template (copied by the execution, so
+	// it's returned to the pool afterwards)
+	includeCtx := getScratchContext()
 
 	// Fill the context with all data from the parent
 	if !node.only {
@@ -26,7 +38,7 @@ func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 	for key, value := range node.withPairs {
 		val, err := value.Evaluate(ctx)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		includeCtx[key] = val
 	}
@@ -36,11 +48,11 @@ func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 		// Evaluate the filename
 		filename, err := node.filenameEvaluator.Evaluate(ctx)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		if filename.String() == "" {
-			return ctx.Error(fmt.Errorf("Filename for 'include'-tag evaluated to an empty string."), nil)
+			return nil, nil, ctx.Error(fmt.Errorf("Filename for 'include'-tag evaluated to an empty string."), nil)
 		}
 
 		// Get include-filename
@@ -50,25 +62,59 @@ func (node *tagIncludeNode) Execute(ctx *ExecutionContext, writer TemplateWriter
 		if err2 != nil {
 			// if this is ReadFile error, and "if_exists" flag is enabled
 			if node.ifExists && err2.(*Error).Sender == "fromfile" {
-				return nil
+				return nil, nil, nil
 			}
-			return err2.(*Error)
+			return nil, nil, err2.(*Error).pushFrame("include", node.position)
 		}
-		err2 = includedTpl.ExecuteWriter(includeCtx, writer)
-		if err2 != nil {
-			return err2.(*Error)
+		return includedTpl, includeCtx, nil
+	}
+	// Template is already parsed with static filename
+	return node.tpl, includeCtx, nil
+}
+
+// executeIncluded renders the included template into a buffer first, so
+// nothing gets written on error (like ExecuteWriter does), while sharing
+// the execution state (cancellation and limits) of the including template.
+// When streaming the output (see Options.FlushBytes), it's written to the
+// writer directly instead, so the included template's output (and its
+// flush-tags) reach the client as well.
+func (node *tagIncludeNode) executeIncluded(ctx *ExecutionContext, tpl *Template, includeCtx Context, writer TemplateWriter) *Error {
+	if ctx.state.flusher != nil {
+		defer putScratchContext(includeCtx)
+		if err := tpl.executeWithState(ctx.state, includeCtx, writer); err != nil {
+			return err.(*Error).pushFrame("include", node.position)
 		}
 		return nil
 	}
-	// Template is already parsed with static filename
-	err := node.tpl.ExecuteWriter(includeCtx, writer)
+
+	buf, err := node.render(ctx.state, tpl, includeCtx)
 	if err != nil {
-		return err.(*Error)
+		return err
+	}
+	defer buf.put()
+	buf.release()
+	if _, err := buf.WriteTo(writer); err != nil {
+		return ctx.Error(err, nil)
 	}
 	return nil
 }
 
-type tagIncludeEmptyNode struct{}
+// render renders tpl into a buffer from the pool (to be returned with
+// put()).
+func (node *tagIncludeNode) render(state *executionState, tpl *Template, includeCtx Context) (*limitedBuffer, *Error) {
+	defer putScratchContext(includeCtx)
+	buf := state.getBuffer(int(float64(tpl.size) * 1.3))
+	if err := tpl.executeWithState(state, includeCtx, buf); err != nil {
+		buf.put()
+		return nil, err.(*Error).pushFrame("include", node.position)
+	}
+	return buf, nil
+}
+
+type tagIncludeEmptyNode struct {
+	position *Token
+	filename string
+}
 
 func (node *tagIncludeEmptyNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	return nil
@@ -76,6 +122,7 @@ func (node *tagIncludeEmptyNode) Execute(ctx *ExecutionContext, writer TemplateW
 
 func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
 	includeNode := &tagIncludeNode{
+		position:  start,
 		withPairs: make(map[string]IEvaluator),
 	}
 
@@ -94,11 +141,15 @@ func tagIncludeParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *
 		if err != nil {
 			// if this is ReadFile error, and "if_exists" token presents we should create and empty node
 			if err.(*Error).Sender == "fromfile" && ifExists {
-				return &tagIncludeEmptyNode{}, nil
+				return &tagIncludeEmptyNode{
+					position: start,
+					filename: includedFilename,
+				}, nil
 			}
-			return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, filenameToken)
+			return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, filenameToken).pushFrame("include", start)
 		}
 		includeNode.tpl = includedTpl
+		doc.template.addDependency(includedTpl)
 	} else {
 		// No String, then the user wants to use lazy-evaluation (slower, but possible)
 		filenameEvaluator, err := arguments.ParseExpression()
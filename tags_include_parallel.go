@@ -0,0 +1,290 @@
+package pongo2
+
+import "sync/atomic"
+
+// executeNodes executes a list of nodes. With Options.ParallelIncludes, the
+// eligible includes of the list are rendered ahead of time by other
+// goroutines and their output is written when the list reaches them.
+func executeNodes(ctx *ExecutionContext, nodes []INode, writer TemplateWriter) *Error {
+	var p *parallelIncludes
+	if ctx.state.includeSlots != nil {
+		p = newParallelIncludes(ctx, nodes)
+	}
+	if p != nil {
+		defer p.wait()
+	}
+
+	for i, n := range nodes {
+		if p != nil {
+			p.start(i + 1)
+		}
+		if err := ctx.enterNode(); err != nil {
+			return err
+		}
+		if p != nil {
+			if r := p.result(i); r != nil {
+				if r.err != nil {
+					return r.err
+				}
+				r.buf.release()
+				_, err := r.buf.WriteTo(writer)
+				r.buf.put()
+				if err != nil {
+					return ctx.Error(err, nil)
+				}
+				continue
+			}
+		}
+		if err := n.Execute(ctx, writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parallelIncludes renders the includes of a list of nodes ahead of time.
+// Only includes which aren't preceded by a node which may change the
+// context are eligible (see mutatesContext()), so building their context
+// ahead of time leads to the same result. Once the execution reaches the
+// first node changing the context, all of them have been waited for, so
+// the context isn't changed while they're rendered.
+type parallelIncludes struct {
+	ctx      *ExecutionContext
+	nodes    []INode
+	eligible []int // indexes of the eligible includes
+	next     int   // in eligible, of the next include to start
+	pending  map[int]*includeResult
+}
+
+type includeResult struct {
+	done  chan struct{}
+	buf   *limitedBuffer
+	err   *Error
+	panic any
+}
+
+func newParallelIncludes(ctx *ExecutionContext, nodes []INode) *parallelIncludes {
+	var eligible []int
+	for i, n := range nodes {
+		if _, ok := n.(*tagIncludeNode); ok {
+			eligible = append(eligible, i)
+		} else if mutatesContext(n) {
+			break
+		}
+	}
+	if len(eligible) < 2 {
+		// Nothing to render in parallel to
+		return nil
+	}
+	return &parallelIncludes{
+		ctx:      ctx,
+		nodes:    nodes,
+		eligible: eligible,
+		pending:  make(map[int]*includeResult),
+	}
+}
+
+// start starts rendering the eligible includes from index from on as long
+// as there are free slots. Slots are never waited for, so includes rendered
+// in parallel can render their own includes in parallel without deadlocks.
+func (p *parallelIncludes) start(from int) {
+	for p.next < len(p.eligible) {
+		i := p.eligible[p.next]
+		if i < from {
+			// Reached by the execution already
+			p.next++
+			continue
+		}
+		select {
+		case p.ctx.state.includeSlots <- struct{}{}:
+		default:
+			return
+		}
+		p.next++
+
+		node := p.nodes[i].(*tagIncludeNode)
+		r := &includeResult{done: make(chan struct{})}
+		p.pending[i] = r
+		tpl, includeCtx, err := node.prepare(p.ctx)
+		if err != nil || tpl == nil || !tpl.parallelSafe() {
+			// Errors are returned when the include is reached; templates
+			// which can't be rendered in parallel are rendered then as well
+			r.err = err
+			if err == nil {
+				delete(p.pending, i)
+			}
+			close(r.done)
+			<-p.ctx.state.includeSlots
+			continue
+		}
+		go func() {
+			defer func() {
+				r.panic = recover()
+				<-p.ctx.state.includeSlots
+				close(r.done)
+			}()
+			r.buf, r.err = node.render(p.ctx.state, tpl, includeCtx)
+		}()
+	}
+}
+
+// result returns the result of the include at index i, or nil if it hasn't
+// been rendered ahead of time.
+func (p *parallelIncludes) result(i int) *includeResult {
+	r, has := p.pending[i]
+	if !has {
+		return nil
+	}
+	delete(p.pending, i)
+	<-r.done
+	if r.panic != nil {
+		panic(r.panic)
+	}
+	return r
+}
+
+// wait waits for all includes still being rendered (if the execution of
+// the list has been aborted).
+func (p *parallelIncludes) wait() {
+	for _, r := range p.pending {
+		<-r.done
+	}
+}
+
+// mutatesContext reports whether executing n may change the context
+// (ExecutionContext.Private) it's executed with. Unknown nodes (e. g.
+// custom tags) are assumed to do so.
+func mutatesContext(n INode) bool {
+	switch n := n.(type) {
+	case *nodeHTML, *nodeVariable, *tagCommentNode, *tagExtendsNode, *tagFirstofNode,
+		*tagFlushNode, *tagIncludeNode, *tagIncludeEmptyNode, *tagLoremNode, *tagNowNode,
+		*tagSSINode, *tagTemplateTagNode:
+		return false
+	case *tagForNode, *tagWithNode:
+		// Executed with a child context
+		return false
+	case *tagCycleNode:
+		return n.asName != ""
+	case *tagWidthratioNode:
+		return n.ctxName != ""
+	case *tagIfNode:
+		return wrappersMutateContext(n.wrappers...)
+	case *tagIfchangedNode:
+		return wrappersMutateContext(n.thenWrapper, n.elseWrapper)
+	case *tagIfEqualNode:
+		return wrappersMutateContext(n.thenWrapper, n.elseWrapper)
+	case *tagIfNotEqualNode:
+		return wrappersMutateContext(n.thenWrapper, n.elseWrapper)
+	case *tagAutoescapeNode:
+		return wrappersMutateContext(n.wrapper)
+	case *tagAllowMissingVal:
+		return wrappersMutateContext(n.bodyWrapper)
+	case *tagFilterNode:
+		return wrappersMutateContext(n.bodyWrapper)
+	case *tagSpacelessNode:
+		return wrappersMutateContext(n.wrapper)
+	}
+	return true
+}
+
+func wrappersMutateContext(wrappers ...*NodeWrapper) bool {
+	for _, w := range wrappers {
+		if w == nil {
+			continue
+		}
+		for _, n := range w.nodes {
+			if mutatesContext(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parallelSafe reports whether tpl can be rendered by a parallel include:
+// neither itself nor a template it extends, includes, imports or embeds
+// (with ssi) uses tags keeping state between executions (cycle and
+// ifchanged) or includes templates lazily (which can't be checked).
+func (tpl *Template) parallelSafe() bool {
+	switch atomic.LoadInt32(&tpl.parallelSafety) {
+	case 1:
+		return true
+	case 2:
+		return false
+	}
+	safe := parallelSafeTemplate(tpl, make(map[*Template]bool))
+	if safe {
+		atomic.StoreInt32(&tpl.parallelSafety, 1)
+	} else {
+		atomic.StoreInt32(&tpl.parallelSafety, 2)
+	}
+	return safe
+}
+
+func parallelSafeTemplate(tpl *Template, visited map[*Template]bool) bool {
+	for ; tpl != nil; tpl = tpl.parent {
+		if visited[tpl] {
+			return true
+		}
+		visited[tpl] = true
+		if !parallelSafeNodes(tpl.root.Nodes, visited) {
+			return false
+		}
+		for _, w := range tpl.blocks {
+			if !parallelSafeNodes(w.nodes, visited) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parallelSafeNodes(nodes []INode, visited map[*Template]bool) bool {
+	for _, n := range nodes {
+		var wrappers []*NodeWrapper
+		switch n := n.(type) {
+		case *tagCycleNode, *tagIfchangedNode:
+			return false
+		case *tagIncludeNode:
+			if n.lazy || !parallelSafeTemplate(n.tpl, visited) {
+				return false
+			}
+		case *tagSSINode:
+			if (n.lazy && n.parsed) || !parallelSafeTemplate(n.template, visited) {
+				return false
+			}
+		case *tagImportNode:
+			for _, m := range n.macros {
+				wrappers = append(wrappers, m.wrapper)
+			}
+		case *tagMacroNode:
+			wrappers = append(wrappers, n.wrapper)
+		case *tagIfNode:
+			wrappers = n.wrappers
+		case *tagForNode:
+			wrappers = []*NodeWrapper{n.bodyWrapper, n.emptyWrapper}
+		case *tagWithNode:
+			wrappers = []*NodeWrapper{n.wrapper}
+		case *tagIfEqualNode:
+			wrappers = []*NodeWrapper{n.thenWrapper, n.elseWrapper}
+		case *tagIfNotEqualNode:
+			wrappers = []*NodeWrapper{n.thenWrapper, n.elseWrapper}
+		case *tagAutoescapeNode:
+			wrappers = []*NodeWrapper{n.wrapper}
+		case *tagAllowMissingVal:
+			wrappers = []*NodeWrapper{n.bodyWrapper}
+		case *tagFilterNode:
+			wrappers = []*NodeWrapper{n.bodyWrapper}
+		case *tagSpacelessNode:
+			wrappers = []*NodeWrapper{n.wrapper}
+		case *tagExecNode:
+			wrappers = []*NodeWrapper{n.bodyWrapper}
+		}
+		for _, w := range wrappers {
+			if w != nil && !parallelSafeNodes(w.nodes, visited) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,14 +1,15 @@
 package pongo2
 
 import (
-	"bytes"
 	"fmt"
+	"sync/atomic"
 )
 
 const maxMacroDepth = 1000
 
 type tagMacroNode struct {
 	position  *Token
+	nameToken *Token
 	name      string
 	argsOrder []string
 	args      map[string]IEvaluator
@@ -19,15 +20,17 @@ type tagMacroNode struct {
 
 func (node *tagMacroNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
 	ctx.Private[node.name] = func(args ...*Value) (*Value, error) {
-		ctx.macroDepth++
-		defer func() {
-			ctx.macroDepth--
-		}()
+		depth := atomic.AddInt32(&ctx.macroDepth, 1)
+		defer atomic.AddInt32(&ctx.macroDepth, -1)
 
-		if ctx.macroDepth > maxMacroDepth {
+		if depth > maxMacroDepth {
 			return nil, ctx.Error(fmt.Errorf("maximum recursive macro call depth reached (max is %v)", maxMacroDepth), node.position)
 		}
 
+		if err := ctx.checkCancelled(node.position); err != nil {
+			return nil, err
+		}
+
 		return node.call(ctx, args...)
 	}
 
@@ -71,8 +74,9 @@ func (node *tagMacroNode) call(ctx *ExecutionContext, args ...*Value) (*Value, e
 		macroCtx.Private[node.argsOrder[idx]] = argValue.Interface()
 	}
 
-	var b bytes.Buffer
-	err := node.wrapper.Execute(macroCtx, &b)
+	b := ctx.state.getBuffer(0)
+	defer b.put()
+	err := node.wrapper.Execute(macroCtx, b)
 	if err != nil {
 		return AsSafeValue(""), err.updateFromTokenIfNeeded(ctx.template, node.position)
 	}
@@ -90,6 +94,7 @@ func tagMacroParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Er
 	if nameToken == nil {
 		return nil, arguments.Error(fmt.Errorf("Macro-tag needs at least an identifier as name."), nil)
 	}
+	macroNode.nameToken = nameToken
 	macroNode.name = nameToken.Val
 
 	if arguments.MatchOne(TokenSymbol, "(") == nil {
@@ -1,7 +1,6 @@
 package pongo2
 
 import (
-	"bytes"
 	"fmt"
 	"regexp"
 )
@@ -13,12 +12,14 @@ type tagSpacelessNode struct {
 var tagSpacelessRegexp = regexp.MustCompile(`(?U:(<.*>))([\t\n\v\f\r ]+)(?U:(<.*>))`)
 
 func (node *tagSpacelessNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	b := bytes.NewBuffer(make([]byte, 0, 1024)) // 1 KiB
+	b := ctx.state.getBuffer(1024) // 1 KiB
+	defer b.put()
 
 	err := node.wrapper.Execute(ctx, b)
 	if err != nil {
 		return err
 	}
+	b.release()
 
 	s := b.String()
 	// Repeat this recursively
@@ -1,68 +1,136 @@
 package pongo2
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"io"
 )
 
 type tagSSINode struct {
-	filename string
-	content  string
-	template *Template
+	position          *Token
+	filename          string
+	filenameEvaluator IEvaluator
+	lazy              bool
+	parsed            bool
+	content           string
+	template          *Template
 }
 
 func (node *tagSSINode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
-	if node.template != nil {
+	content, tpl := node.content, node.template
+	if node.lazy {
+		// Evaluate the filename
+		filename, err := node.filenameEvaluator.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		if filename.String() == "" {
+			return ctx.Error(fmt.Errorf("Filename for 'ssi'-tag evaluated to an empty string."), node.position)
+		}
+
+		if node.parsed {
+			includedTpl, err2 := ctx.template.set.FromFile(ctx.template.set.resolveFilename(ctx.template, filename.String()))
+			if err2 != nil {
+				return err2.(*Error).pushFrame("ssi", node.position)
+			}
+			tpl = includedTpl
+		} else {
+			content, _, err = readSSIFile(ctx.template, filename.String())
+			if err != nil {
+				return err.updateFromTokenIfNeeded(ctx.template, node.position)
+			}
+		}
+	}
+
+	if tpl != nil {
 		// Execute the template within the current context
 		includeCtx := make(Context)
 		includeCtx.Update(ctx.Public)
 		includeCtx.Update(ctx.Private)
 
-		err := node.template.execute(includeCtx, writer)
+		err := tpl.executeWithState(ctx.state, includeCtx, writer)
 		if err != nil {
-			return err.(*Error)
+			return err.(*Error).pushFrame("ssi", node.position)
 		}
 	} else {
 		// Just print out the content
-		if _, err := writer.WriteString(node.content); err != nil {
+		if _, err := writer.WriteString(content); err != nil {
 			return ctx.Error(err, nil)
 		}
 	}
 	return nil
 }
 
-func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
-	SSINode := &tagSSINode{}
+// readSSIFile reads a file to be included as is, using the loaders of
+// tpl's set (relative to tpl).
+func readSSIFile(tpl *Template, filename string) (string, templateSource, *Error) {
+	if tpl.set.DisableRawSSI {
+		return "", templateSource{}, &Error{
+			Sender:    "tag:ssi",
+			Kind:      ErrorKindSandbox,
+			OrigError: errors.New("including files as is (without 'parsed') is disabled for this set"),
+		}
+	}
+
+	name, loader, fd, err := tpl.set.resolveTemplate(tpl, filename)
+	if err == nil {
+		var buf []byte
+		if buf, err = io.ReadAll(fd); err == nil {
+			return string(buf), newTemplateSource(loader, name), nil
+		}
+	}
+	if e, ok := err.(*Error); ok {
+		// Denied by the sandbox
+		return "", templateSource{}, e
+	}
+	return "", templateSource{}, &Error{
+		Sender:    "tag:ssi",
+		OrigError: fmt.Errorf("%s: %w", filename, err),
+	}
+}
 
-	if fileToken := arguments.MatchType(TokenString); fileToken != nil {
-		SSINode.filename = fileToken.Val
+func tagSSIParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
+	SSINode := &tagSSINode{
+		position: start,
+	}
 
-		if arguments.Match(TokenIdentifier, "parsed") != nil {
-			// parsed
-			temporaryTpl, err := doc.template.set.FromFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
-			if err != nil {
-				return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, fileToken)
-			}
-			SSINode.template = temporaryTpl
-		} else {
-			// plaintext
-			buf, err := os.ReadFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
-			if err != nil {
-				return nil, (&Error{
-					Sender:    "tag:ssi",
-					OrigError: err,
-				}).updateFromTokenIfNeeded(doc.template, fileToken)
-			}
-			SSINode.content = string(buf)
+	fileToken := arguments.MatchType(TokenString)
+	if fileToken == nil {
+		// No String, then the user wants to use lazy-evaluation (like include)
+		filenameEvaluator, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		return nil, arguments.Error(fmt.Errorf("First argument must be a string."), nil)
+		SSINode.filenameEvaluator = filenameEvaluator
+		SSINode.lazy = true
 	}
+	SSINode.parsed = arguments.Match(TokenIdentifier, "parsed") != nil
 
 	if arguments.Remaining() > 0 {
 		return nil, arguments.Error(fmt.Errorf("Malformed SSI-tag argument."), nil)
 	}
 
+	if SSINode.lazy {
+		return SSINode, nil
+	}
+
+	SSINode.filename = fileToken.Val
+	if SSINode.parsed {
+		temporaryTpl, err := doc.template.set.FromFile(doc.template.set.resolveFilename(doc.template, fileToken.Val))
+		if err != nil {
+			return nil, err.(*Error).updateFromTokenIfNeeded(doc.template, fileToken).pushFrame("ssi", start)
+		}
+		SSINode.template = temporaryTpl
+		doc.template.addDependency(temporaryTpl)
+	} else {
+		content, source, err := readSSIFile(doc.template, fileToken.Val)
+		if err != nil {
+			return nil, err.updateFromTokenIfNeeded(doc.template, fileToken)
+		}
+		SSINode.content = content
+		doc.template.sources = append(doc.template.sources, source)
+	}
+
 	return SSINode, nil
 }
 
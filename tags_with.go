@@ -8,6 +8,12 @@ type tagWithNode struct {
 }
 
 func (node *tagWithNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	return node.scope(ctx, &wrapperBodies{body: node.wrapper, writer: writer})
+}
+
+// scope executes the body with a child context containing the with-pairs.
+// It's shared by Execute and templates compiled to Go code.
+func (node *tagWithNode) scope(ctx *ExecutionContext, bodies tagBodies) *Error {
 	// new context for block
 	withctx := NewChildExecutionContext(ctx)
 
@@ -20,7 +26,7 @@ func (node *tagWithNode) Execute(ctx *ExecutionContext, writer TemplateWriter) *
 		withctx.Private[key] = val
 	}
 
-	return node.wrapper.Execute(withctx, writer)
+	return bodies.executeBody(withctx)
 }
 
 func tagWithParser(doc *Parser, start *Token, arguments *Parser) (INodeTag, *Error) {
@@ -2,9 +2,13 @@ package pongo2
 
 import (
 	"bytes"
+	goContext "context"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type TemplateWriter interface {
@@ -44,6 +48,44 @@ type Template struct {
 	blocks         map[string]*NodeWrapper
 	exportedMacros map[string]*tagMacroNode
 
+	// Analysis (start tokens of all used tags)
+	tagTokens []*Token
+
+	// Start token of the extends-tag, if any (for error stacks)
+	extendsToken *Token
+
+	// Contextual auto-escaping (see computeEscapeContexts()): the variables
+	// found while parsing and the HTML state at the start of each block
+	variables     []*nodeVariable
+	blockScanners map[string]htmlScanner
+
+	// Error recovery (see TemplateSet.FromStringAll())
+	collectErrors  bool
+	parseErrors    []*Error
+	pendingEndTags map[string]int
+
+	// Change detection for TemplateSet.FromCache(): the loaded files this
+	// template consists of and the time of the last check (in unix nanoseconds)
+	sources     []templateSource
+	lastChecked int64
+
+	// TrimBlocks/LStripBlocks have been applied to the tokens (see
+	// applyWhitespaceOptions())
+	whitespaceApplied int32
+	whitespaceMutex   sync.Mutex
+
+	// Whether the template may be rendered by parallel includes (see
+	// parallelSafe())
+	parallelSafety int32
+
+	// Code generated for the template by GenerateGo() (if it's loaded by
+	// CompiledTemplates): the compiled template, the nodes and expressions
+	// its code refers to and why the code can't be used (if so), see
+	// CompiledTemplates.attach()
+	compiled     *CompiledTemplate
+	compiledTree *compiledTree
+	compiledErr  error
+
 	// Output
 	root *nodeDocument
 
@@ -61,6 +103,17 @@ func (tpl *Template) GetExportedMacros() map[string]*tagMacroNode {
 }
 
 func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*Template, error) {
+	t, errs := compileTemplate(set, name, isTplString, tpl, false)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return t, nil
+}
+
+// compileTemplate creates and parses a template. If collect is true, it
+// doesn't stop at the first error, but returns all lexer and parser
+// errors (sorted by position).
+func compileTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte, collect bool) (*Template, []*Error) {
 	strTpl := string(tpl)
 
 	// Create the template
@@ -73,33 +126,69 @@ func newTemplate(set *TemplateSet, name string, isTplString bool, tpl []byte) (*
 		blocks:         make(map[string]*NodeWrapper),
 		exportedMacros: make(map[string]*tagMacroNode),
 		Options:        newOptions(),
+		collectErrors:  collect,
 	}
 	// Copy all settings from another Options.
 	t.Options.Update(set.Options)
 
 	// Tokenize it
-	tokens, err := lex(name, strTpl)
-	if err != nil {
-		return nil, err
+	var errs []*Error
+	if collect {
+		t.tokens, errs = lexAll(name, strTpl)
+	} else {
+		tokens, err := lex(name, strTpl)
+		if err != nil {
+			err.Template = t
+			return nil, []*Error{err}
+		}
+		t.tokens = tokens
 	}
-	t.tokens = tokens
 
 	// For debugging purposes, show all tokens:
-	/*for i, t := range tokens {
+	/*for i, t := range t.tokens {
 		fmt.Printf("%3d. %s\n", i, t)
 	}*/
 
 	// Parse it
-	err = t.parse()
-	if err != nil {
-		return nil, err
+	if err := t.parse(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, t.parseErrors...)
+	t.parseErrors, t.pendingEndTags = nil, nil
+
+	if len(errs) > 0 {
+		for _, err := range errs {
+			err.setKindIfUnknown(ErrorKindParse)
+			if err.Template == nil {
+				err.Template = t
+			}
+		}
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].Line != errs[j].Line {
+				return errs[i].Line < errs[j].Line
+			}
+			return errs[i].Column < errs[j].Column
+		})
+		return nil, errs
 	}
 
 	return t, nil
 }
 
-func (tpl *Template) newContextForExecution(context Context) (*Template, *ExecutionContext, error) {
+// applyWhitespaceOptions applies the TrimBlocks and LStripBlocks options
+// to the template's HTML tokens. They're applied once only, so the template
+// can be executed concurrently.
+func (tpl *Template) applyWhitespaceOptions() {
+	if atomic.LoadInt32(&tpl.whitespaceApplied) != 0 {
+		return
+	}
+	tpl.whitespaceMutex.Lock()
+	defer tpl.whitespaceMutex.Unlock()
+	if tpl.whitespaceApplied != 0 {
+		return
+	}
 	if tpl.Options.TrimBlocks || tpl.Options.LStripBlocks {
+		defer atomic.StoreInt32(&tpl.whitespaceApplied, 1)
 		// Issue #94 https://github.com/flosch/pongo2/issues/94
 		// If an application configures pongo2 template to trim_blocks,
 		// the first newline after a template tag is removed automatically (like in PHP).
@@ -126,6 +215,10 @@ func (tpl *Template) newContextForExecution(context Context) (*Template, *Execut
 			prev = t
 		}
 	}
+}
+
+func (tpl *Template) newContextForExecution(state *executionState, context Context) (*Template, *ExecutionContext, error) {
+	tpl.applyWhitespaceOptions()
 
 	// Determine the parent to be executed (for template inheritance)
 	parent := tpl
@@ -162,34 +255,118 @@ func (tpl *Template) newContextForExecution(context Context) (*Template, *Execut
 	}
 
 	// Create operational context
-	ctx := newExecutionContext(parent, newContext)
+	ctx := newExecutionContext(state, parent, newContext)
+	ctx.undefinedPolicy = tpl.Options.UndefinedPolicy
+	ctx.contextualAutoescape = tpl.Options.ContextualAutoescape
+	escaper := tpl.Options.Escaper
+	if escaper == "" && tpl.Options.JSONOutput {
+		escaper = "json"
+	}
+	if err := ctx.setEscaper(escaper); err != nil {
+		return parent, nil, &Error{
+			Filename:  tpl.name,
+			Sender:    "execution",
+			OrigError: err,
+		}
+	}
 
 	return parent, ctx, nil
 }
 
-func (tpl *Template) execute(context Context, writer TemplateWriter) error {
-	parent, ctx, err := tpl.newContextForExecution(context)
+func (tpl *Template) execute(goCtx goContext.Context, context Context, writer TemplateWriter) error {
+	state := newExecutionState(goCtx, tpl.set.Limits)
+	if tpl.Options.ParallelIncludes > 1 {
+		state.includeSlots = make(chan struct{}, tpl.Options.ParallelIncludes)
+	}
+	writer = state.flushWriter(writer, tpl.Options)
+	if !tpl.Options.JSONOutput {
+		err := tpl.executeWithState(state, context, state.limitWriter(writer))
+		releaseExecutionState(state)
+		return err
+	}
+
+	// Validate the output
+	out, buffered := writer.(*bytes.Buffer)
+	start := 0
+	if buffered {
+		start = out.Len()
+	} else {
+		out = getBuffer(int(float64(tpl.size) * 1.3))
+		defer putBuffer(out)
+		writer = &jsonRecordingWriter{w: writer, buf: out}
+	}
+	err := tpl.executeWithState(state, context, state.limitWriter(writer))
+	releaseExecutionState(state)
+	if err != nil {
+		return err
+	}
+	if err := tpl.validateJSONOutput(out.Bytes()[start:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// executeWithState executes the template as part of an already running
+// execution (e. g. for included templates), sharing its state and budgets.
+func (tpl *Template) executeWithState(state *executionState, context Context, writer TemplateWriter) error {
+	parent, ctx, err := tpl.newContextForExecution(state, context)
 	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.setKindIfUnknown(ErrorKindExecution)
+		}
 		return err
 	}
 
-	// Run the selected document
-	if err := parent.root.Execute(ctx, writer); err != nil {
+	if err := ctx.checkCancelled(nil); err != nil {
 		return err
 	}
 
+	// Run the selected document
+	var execErr *Error
+	if parent.useCompiled() {
+		execErr = parent.executeCompiled(ctx, writer)
+	} else {
+		execErr = parent.root.Execute(ctx, writer)
+	}
+	if execErr != nil {
+		return tpl.pushExtendsFrames(execErr.setKindIfUnknown(ErrorKindExecution))
+	}
+
 	return nil
 }
 
-func (tpl *Template) newTemplateWriterAndExecute(context Context, writer io.Writer) error {
-	return tpl.execute(context, &templateWriter{w: writer})
+// pushExtendsFrames adds the extends-chain of tpl to err's stack.
+func (tpl *Template) pushExtendsFrames(err *Error) *Error {
+	var chain []*Template
+	for t := tpl; t.parent != nil; t = t.parent {
+		chain = append(chain, t)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		err.pushFrame("extends", chain[i].extendsToken)
+	}
+	return err
 }
 
-func (tpl *Template) newBufferAndExecute(context Context) (*bytes.Buffer, error) {
+func (tpl *Template) newTemplateWriterAndExecute(goCtx goContext.Context, context Context, writer io.Writer) error {
+	return tpl.execute(goCtx, context, &templateWriter{w: writer})
+}
+
+func (tpl *Template) newBufferAndExecute(goCtx goContext.Context, context Context) (*bytes.Buffer, error) {
 	// Create output buffer
 	// We assume that the rendered template will be 30% larger
 	buffer := bytes.NewBuffer(make([]byte, 0, int(float64(tpl.size)*1.3)))
-	if err := tpl.execute(context, buffer); err != nil {
+	if err := tpl.execute(goCtx, context, buffer); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// newPooledBufferAndExecute is like newBufferAndExecute, but the buffer is
+// taken from the pool. Return it with putBuffer() (unless on error).
+func (tpl *Template) newPooledBufferAndExecute(goCtx goContext.Context, context Context) (*bytes.Buffer, error) {
+	buffer := getBuffer(int(float64(tpl.size) * 1.3))
+	if err := tpl.execute(goCtx, context, buffer); err != nil {
+		putBuffer(buffer)
 		return nil, err
 	}
 	return buffer, nil
@@ -199,10 +376,17 @@ func (tpl *Template) newBufferAndExecute(context Context) (*bytes.Buffer, error)
 // on success. Context can be nil. Nothing is written on error; instead the error
 // is being returned.
 func (tpl *Template) ExecuteWriter(context Context, writer io.Writer) error {
-	buf, err := tpl.newBufferAndExecute(context)
+	return tpl.ExecuteWriterContext(goContext.Background(), context, writer)
+}
+
+// ExecuteWriterContext is like ExecuteWriter, but aborts the execution
+// with an error as soon as goCtx is cancelled or its deadline is exceeded.
+func (tpl *Template) ExecuteWriterContext(goCtx goContext.Context, context Context, writer io.Writer) error {
+	buf, err := tpl.newPooledBufferAndExecute(goCtx, context)
 	if err != nil {
 		return err
 	}
+	defer putBuffer(buf)
 	_, err = buf.WriteTo(writer)
 	if err != nil {
 		return err
@@ -214,15 +398,28 @@ func (tpl *Template) ExecuteWriter(context Context, writer io.Writer) error {
 // this function might already have written parts of the generated template in the
 // case of an execution error because there's no intermediate buffer involved for
 // performance reasons. This is handy if you need high performance template
-// generation or if you want to manage your own pool of buffers.
+// generation or if you want to manage your own pool of buffers. It's also
+// able to stream the output (see Options.FlushBytes and the flush-tag).
 func (tpl *Template) ExecuteWriterUnbuffered(context Context, writer io.Writer) error {
-	return tpl.newTemplateWriterAndExecute(context, writer)
+	return tpl.newTemplateWriterAndExecute(goContext.Background(), context, writer)
+}
+
+// ExecuteWriterUnbufferedContext is like ExecuteWriterUnbuffered, but aborts
+// the execution with an error as soon as goCtx is done.
+func (tpl *Template) ExecuteWriterUnbufferedContext(goCtx goContext.Context, context Context, writer io.Writer) error {
+	return tpl.newTemplateWriterAndExecute(goCtx, context, writer)
 }
 
 // Executes the template and returns the rendered template as a []byte
 func (tpl *Template) ExecuteBytes(context Context) ([]byte, error) {
+	return tpl.ExecuteBytesContext(goContext.Background(), context)
+}
+
+// ExecuteBytesContext is like ExecuteBytes, but aborts the execution
+// with an error as soon as goCtx is done.
+func (tpl *Template) ExecuteBytesContext(goCtx goContext.Context, context Context) ([]byte, error) {
 	// Execute template
-	buffer, err := tpl.newBufferAndExecute(context)
+	buffer, err := tpl.newBufferAndExecute(goCtx, context)
 	if err != nil {
 		return nil, err
 	}
@@ -231,16 +428,30 @@ func (tpl *Template) ExecuteBytes(context Context) ([]byte, error) {
 
 // Executes the template and returns the rendered template as a string
 func (tpl *Template) Execute(context Context) (string, error) {
+	return tpl.ExecuteContext(goContext.Background(), context)
+}
+
+// ExecuteContext is like Execute, but aborts the execution with an error
+// as soon as goCtx is cancelled or its deadline is exceeded. The returned
+// *Error wraps goCtx.Err(), so errors.Is(err, context.Canceled) works.
+func (tpl *Template) ExecuteContext(goCtx goContext.Context, context Context) (string, error) {
 	// Execute template
-	buffer, err := tpl.newBufferAndExecute(context)
+	buffer, err := tpl.newPooledBufferAndExecute(goCtx, context)
 	if err != nil {
 		return "", err
 	}
+	defer putBuffer(buffer)
 
 	return buffer.String(), nil
 }
 
 func (tpl *Template) ExecuteBlocks(context Context, blocks []string) (map[string]string, error) {
+	return tpl.ExecuteBlocksContext(goContext.Background(), context, blocks)
+}
+
+// ExecuteBlocksContext is like ExecuteBlocks, but aborts the execution
+// with an error as soon as goCtx is done.
+func (tpl *Template) ExecuteBlocksContext(goCtx goContext.Context, context Context, blocks []string) (map[string]string, error) {
 	var parents []*Template
 	result := make(map[string]string)
 
@@ -271,14 +482,14 @@ func (tpl *Template) ExecuteBlocks(context Context, blocks []string) (map[string
 				}
 				// assign the context if we haven't done so
 				if ctx == nil {
-					_, ctx, err = t.newContextForExecution(context)
+					_, ctx, err = t.newContextForExecution(newExecutionState(goCtx, t.set.Limits), context)
 					if err != nil {
 						return nil, err
 					}
 				}
-				bErr := blockWrapper.Execute(ctx, buffer)
+				bErr := blockWrapper.Execute(ctx, ctx.state.limitWriter(buffer))
 				if bErr != nil {
-					return nil, bErr
+					return nil, bErr.setKindIfUnknown(ErrorKindExecution)
 				}
 				result[blockName] = buffer.String()
 				buffer.Reset()
@@ -0,0 +1,1284 @@
+package pongo2
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
+)
+
+// binaryMagic and binaryFormatVersion start every serialized template (see
+// Template.MarshalBinary()). The format version must be incremented whenever
+// the encoding or one of the serialized node types changes.
+const (
+	binaryMagic         = "pongo2\x00tpl"
+	binaryFormatVersion = 8
+)
+
+// ErrStaleTemplate is wrapped by the errors of TemplateSet.FromBinary() if
+// a serialized template can't be used anymore: it has been created by
+// another version of pongo2, one of its source files has changed or it
+// doesn't match the set (e. g. a tag has been replaced or a filter removed).
+// The template must be compiled (and serialized) again.
+var ErrStaleTemplate = errors.New("serialized template is stale")
+
+// Node types of the binary format
+const (
+	binaryNodeNil = iota
+	binaryNodeHTML
+	binaryNodeWrapper
+	binaryNodeExpression
+	binaryNodeRelationalExpression
+	binaryNodeSimpleExpression
+	binaryNodeNamedTerm
+	binaryNodeTerm
+	binaryNodePower
+	binaryNodeStringResolver
+	binaryNodeIntResolver
+	binaryNodeFloatResolver
+	binaryNodeBoolResolver
+	binaryNodeVariableResolver
+	binaryNodeFilteredVariable
+	binaryNodeVariable
+	binaryNodeAllowMissingVal
+	binaryNodeAutoescape
+	binaryNodeBlock
+	binaryNodeComment
+	binaryNodeCycle
+	binaryNodeExec
+	binaryNodeExtends
+	binaryNodeFilter
+	binaryNodeFirstof
+	binaryNodeFlush
+	binaryNodeFor
+	binaryNodeIf
+	binaryNodeIfchanged
+	binaryNodeIfEqual
+	binaryNodeIfNotEqual
+	binaryNodeImport
+	binaryNodeInclude
+	binaryNodeIncludeEmpty
+	binaryNodeLorem
+	binaryNodeMacro
+	binaryNodeNow
+	binaryNodeSet
+	binaryNodeSpaceless
+	binaryNodeSSI
+	binaryNodeTemplateTag
+	binaryNodeWidthratio
+	binaryNodeWith
+)
+
+// MarshalBinary serializes the compiled template (its node tree, blocks,
+// exported macros and all statically extended, included and imported
+// templates) to a compact binary form, which TemplateSet.FromBinary() loads
+// without lexing and parsing the template again. It also contains hashes
+// of the template's source files, so changed sources are detected when
+// loading it. Sources of loaders implementing TemplateVersioner are only
+// read and hashed again if their version has changed.
+//
+// Templates using tags implemented outside of pongo2 (or set-local tags)
+// can't be serialized. Don't serialize a template while it's executed with
+// TrimBlocks or LStripBlocks enabled (they're applied to the tokens).
+func (tpl *Template) MarshalBinary() ([]byte, error) {
+	e := &binaryEncoder{
+		set: tpl.set,
+		ids: make(map[any]int),
+	}
+	e.string(binaryMagic)
+	e.uint(binaryFormatVersion)
+	e.string(Version)
+	e.bool(tpl.Options.JSONOutput) // the escape contexts depend on it
+	e.template(tpl)
+	if e.err != nil {
+		return nil, fmt.Errorf("template '%s' can't be serialized: %w", tpl.name, e.err)
+	}
+	return e.buf, nil
+}
+
+// FromBinary loads a template serialized by Template.MarshalBinary() into
+// the set. The template is checked against the set like it would be during
+// parsing (existence of its tags and filters and the sandbox restrictions);
+// filters are bound to the set's ones. Its source files must be unchanged
+// and readable through the set's loaders. Errors caused by outdated data
+// wrap ErrStaleTemplate.
+func (set *TemplateSet) FromBinary(data []byte) (*Template, error) {
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
+
+	d := &binaryDecoder{
+		set:      set,
+		buf:      data,
+		verified: make(map[string]bool),
+	}
+	if d.string() != binaryMagic {
+		return nil, d.error(errors.New("not a serialized template"))
+	}
+	if version := d.uint(); version != binaryFormatVersion {
+		return nil, d.error(fmt.Errorf("%w: format version %d, expected %d", ErrStaleTemplate, version, binaryFormatVersion))
+	}
+	if version := d.string(); version != Version {
+		return nil, d.error(fmt.Errorf("%w: created by pongo2 %s, this is %s", ErrStaleTemplate, version, Version))
+	}
+	if jsonOutput := d.bool(); jsonOutput != set.Options.JSONOutput {
+		return nil, d.error(fmt.Errorf("%w: parsed with JSONOutput %t, the set uses %t", ErrStaleTemplate, jsonOutput, set.Options.JSONOutput))
+	}
+	tpl := d.template()
+	if d.err == nil && tpl == nil {
+		d.fail(errors.New("no template"))
+	}
+	if d.err == nil && len(d.buf) > 0 {
+		d.fail(errors.New("trailing data"))
+	}
+	if d.err != nil {
+		return nil, d.error(d.err)
+	}
+	return tpl, nil
+}
+
+// binaryEncoder writes the binary format. Pointers to tokens, templates,
+// wrappers and macros (and the filenames of tokens) are written once and
+// referenced afterwards, so shared and cyclic structures (e. g. a parent
+// and its child template) are restored as they are.
+type binaryEncoder struct {
+	set *TemplateSet
+	buf []byte
+	ids map[any]int
+	err error // the first error; everything else is ignored afterwards
+}
+
+// binaryString is the key of a shared string in binaryEncoder.ids.
+type binaryString string
+
+func (e *binaryEncoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *binaryEncoder) uint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *binaryEncoder) int(v int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], int64(v))]...)
+}
+
+func (e *binaryEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *binaryEncoder) float(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *binaryEncoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *binaryEncoder) strings(list []string) {
+	e.uint(uint64(len(list)))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+// ref writes a reference to the object key (0 for nil, 1 if the object is
+// defined right here, otherwise its id + 2) and reports whether the object
+// has to be written now.
+func (e *binaryEncoder) ref(key any, isNil bool) bool {
+	if isNil {
+		e.uint(0)
+		return false
+	}
+	if id, has := e.ids[key]; has {
+		e.uint(uint64(id) + 2)
+		return false
+	}
+	e.ids[key] = len(e.ids)
+	e.uint(1)
+	return true
+}
+
+func (e *binaryEncoder) sharedString(s string) {
+	if e.ref(binaryString(s), false) {
+		e.string(s)
+	}
+}
+
+func (e *binaryEncoder) token(t *Token) {
+	if !e.ref(t, t == nil) {
+		return
+	}
+	e.sharedString(t.Filename)
+	e.uint(uint64(t.Typ))
+	e.string(t.Val)
+	e.int(t.Line)
+	e.int(t.Col)
+	e.bool(t.TrimWhitespaces)
+}
+
+func (e *binaryEncoder) tokens(tokens []*Token) {
+	e.uint(uint64(len(tokens)))
+	for _, t := range tokens {
+		e.token(t)
+	}
+}
+
+func (e *binaryEncoder) template(tpl *Template) {
+	if !e.ref(tpl, tpl == nil) {
+		return
+	}
+	e.string(tpl.name)
+	e.bool(tpl.isTplString)
+	e.string(tpl.tpl)
+
+	e.uint(uint64(len(tpl.sources)))
+	for _, src := range tpl.sources {
+		e.source(src)
+	}
+
+	e.tokens(tpl.tokens)
+	e.tokens(tpl.tagTokens)
+	for _, t := range tpl.tagTokens {
+		if _, has := e.set.tags[t.Val]; has {
+			e.fail(fmt.Errorf("set-local tag '%s'", t.Val))
+		}
+	}
+	e.token(tpl.extendsToken)
+	e.template(tpl.parent)
+	e.template(tpl.child)
+
+	e.nodes(tpl.root.Nodes)
+
+	names := make([]string, 0, len(tpl.blocks))
+	for name := range tpl.blocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.uint(uint64(len(names)))
+	for _, name := range names {
+		e.string(name)
+		e.wrapper(tpl.blocks[name])
+	}
+	e.macros(tpl.exportedMacros)
+}
+
+// source writes a source file of a template together with the hash of its
+// current content.
+func (e *binaryEncoder) source(src templateSource) {
+	index := -1
+	for i, loader := range e.set.loaders {
+		if reflect.TypeOf(loader).Comparable() && loader == src.loader {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		// Plain files (used by the ssi-tag)
+		if l, ok := src.loader.(*LocalFilesystemLoader); !ok || l.baseDir != "" {
+			e.fail(fmt.Errorf("source '%s' isn't loaded by a loader of the set", src.path))
+			return
+		}
+	}
+	if v, ok := src.loader.(TemplateVersioner); ok {
+		// The hash must be the one of the content the template was parsed from
+		if version, err := v.Version(src.path); err != nil || version != src.version {
+			e.fail(fmt.Errorf("source '%s' has changed since the template was loaded", src.path))
+			return
+		}
+	}
+	hash, err := sourceHash(src.loader, src.path)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	e.int(index)
+	e.string(src.path)
+	e.string(src.version)
+	e.string(hash)
+}
+
+func sourceHash(loader TemplateLoader, path string) (string, error) {
+	r, err := loader.Get(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return string(h.Sum(nil)), nil
+}
+
+func (e *binaryEncoder) wrapper(w *NodeWrapper) {
+	if !e.ref(w, w == nil) {
+		return
+	}
+	e.string(w.Endtag)
+	e.nodes(w.nodes)
+}
+
+func (e *binaryEncoder) macro(m *tagMacroNode) {
+	if !e.ref(m, m == nil) {
+		return
+	}
+	e.token(m.position)
+	e.token(m.nameToken)
+	e.string(m.name)
+	e.strings(m.argsOrder)
+	e.evaluatorMap(m.args)
+	e.bool(m.exported)
+	e.wrapper(m.wrapper)
+}
+
+func (e *binaryEncoder) macros(macros map[string]*tagMacroNode) {
+	names := make([]string, 0, len(macros))
+	for name := range macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.uint(uint64(len(names)))
+	for _, name := range names {
+		e.string(name)
+		e.macro(macros[name])
+	}
+}
+
+func (e *binaryEncoder) nodes(nodes []INode) {
+	e.uint(uint64(len(nodes)))
+	for _, n := range nodes {
+		e.node(n)
+	}
+}
+
+func (e *binaryEncoder) evaluators(list []IEvaluator) {
+	e.uint(uint64(len(list)))
+	for _, ev := range list {
+		e.node(ev)
+	}
+}
+
+func (e *binaryEncoder) evaluatorMap(m map[string]IEvaluator) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e.uint(uint64(len(keys)))
+	for _, k := range keys {
+		e.string(k)
+		e.node(m[k])
+	}
+}
+
+func (e *binaryEncoder) filterCalls(chain []*filterCall) {
+	e.uint(uint64(len(chain)))
+	for _, fc := range chain {
+		e.token(fc.token)
+		e.string(fc.name)
+		e.node(fc.parameter)
+	}
+}
+
+// node writes a node or evaluator (which may be nil) including its type.
+func (e *binaryEncoder) node(n any) {
+	if e.err != nil {
+		return
+	}
+	switch n := n.(type) {
+	case nil:
+		e.uint(binaryNodeNil)
+	case *nodeHTML:
+		e.uint(binaryNodeHTML)
+		e.token(n.token)
+		e.bool(n.trimLeft)
+		e.bool(n.trimRight)
+	case *NodeWrapper:
+		e.uint(binaryNodeWrapper)
+		e.wrapper(n)
+
+	// Expressions
+	case *Expression:
+		e.uint(binaryNodeExpression)
+		e.node(n.expr1)
+		e.node(n.expr2)
+		e.token(n.opToken)
+	case *relationalExpression:
+		e.uint(binaryNodeRelationalExpression)
+		e.node(n.expr1)
+		e.node(n.expr2)
+		e.token(n.opToken)
+	case *simpleExpression:
+		e.uint(binaryNodeSimpleExpression)
+		e.bool(n.negate)
+		e.bool(n.negativeSign)
+		e.node(n.term1)
+		e.node(n.term2)
+		e.token(n.opToken)
+	case *namedTerm:
+		e.uint(binaryNodeNamedTerm)
+		e.string(n.name)
+		e.node(n.term)
+	case *term:
+		e.uint(binaryNodeTerm)
+		e.node(n.factor1)
+		e.node(n.factor2)
+		e.token(n.opToken)
+	case *power:
+		e.uint(binaryNodePower)
+		e.node(n.power1)
+		e.node(n.power2)
+
+	// Variables and literals
+	case *stringResolver:
+		e.uint(binaryNodeStringResolver)
+		e.token(n.locationToken)
+		e.string(n.val)
+	case *intResolver:
+		e.uint(binaryNodeIntResolver)
+		e.token(n.locationToken)
+		e.int(n.val)
+	case *floatResolver:
+		e.uint(binaryNodeFloatResolver)
+		e.token(n.locationToken)
+		e.float(n.val)
+	case *boolResolver:
+		e.uint(binaryNodeBoolResolver)
+		e.token(n.locationToken)
+		e.bool(n.val)
+	case *variableResolver:
+		e.uint(binaryNodeVariableResolver)
+		e.token(n.locationToken)
+		e.uint(uint64(len(n.parts)))
+		for _, part := range n.parts {
+			e.int(part.typ)
+			e.string(part.s)
+			e.int(part.i)
+			e.node(part.subscript)
+			e.bool(part.isNil)
+			e.bool(part.isFunctionCall)
+			e.uint(uint64(len(part.callingArgs)))
+			for _, arg := range part.callingArgs {
+				e.node(arg)
+			}
+		}
+	case *nodeFilteredVariable:
+		e.uint(binaryNodeFilteredVariable)
+		e.token(n.locationToken)
+		e.node(n.resolver)
+		e.filterCalls(n.filterChain)
+	case *nodeVariable:
+		e.uint(binaryNodeVariable)
+		e.token(n.locationToken)
+		e.node(n.expr)
+		e.uint(uint64(n.escapeContext.kind))
+		e.uint(uint64(n.escapeContext.attr))
+
+	// Tags
+	case *tagAllowMissingVal:
+		e.uint(binaryNodeAllowMissingVal)
+		e.token(n.position)
+		e.wrapper(n.bodyWrapper)
+	case *tagAutoescapeNode:
+		e.uint(binaryNodeAutoescape)
+		e.wrapper(n.wrapper)
+		e.bool(n.autoescape)
+		e.string(n.escaper)
+	case *tagBlockNode:
+		e.uint(binaryNodeBlock)
+		e.token(n.position)
+		e.string(n.name)
+	case *tagCommentNode:
+		e.uint(binaryNodeComment)
+	case *tagCycleNode:
+		e.uint(binaryNodeCycle)
+		e.token(n.position)
+		e.evaluators(n.args)
+		e.string(n.asName)
+		e.bool(n.silent)
+	case *tagExecNode:
+		e.uint(binaryNodeExec)
+		e.token(n.position)
+		e.wrapper(n.bodyWrapper)
+	case *tagExtendsNode:
+		e.uint(binaryNodeExtends)
+		e.token(n.position)
+		e.string(n.filename)
+	case *tagFilterNode:
+		e.uint(binaryNodeFilter)
+		e.token(n.position)
+		e.wrapper(n.bodyWrapper)
+		e.uint(uint64(len(n.filterChain)))
+		for _, fc := range n.filterChain {
+			e.token(fc.token)
+			e.string(fc.name)
+			e.node(fc.paramExpr)
+		}
+	case *tagFirstofNode:
+		e.uint(binaryNodeFirstof)
+		e.token(n.position)
+		e.evaluators(n.args)
+	case *tagFlushNode:
+		e.uint(binaryNodeFlush)
+		e.token(n.position)
+	case *tagForNode:
+		e.uint(binaryNodeFor)
+		e.token(n.position)
+		e.string(n.key)
+		e.string(n.value)
+		e.node(n.objectEvaluator)
+		e.bool(n.reversed)
+		e.bool(n.sorted)
+		e.wrapper(n.bodyWrapper)
+		e.wrapper(n.emptyWrapper)
+	case *tagIfNode:
+		e.uint(binaryNodeIf)
+		e.evaluators(n.conditions)
+		e.uint(uint64(len(n.wrappers)))
+		for _, w := range n.wrappers {
+			e.wrapper(w)
+		}
+	case *tagIfchangedNode:
+		e.uint(binaryNodeIfchanged)
+		e.evaluators(n.watchedExpr)
+		e.wrapper(n.thenWrapper)
+		e.wrapper(n.elseWrapper)
+	case *tagIfEqualNode:
+		e.uint(binaryNodeIfEqual)
+		e.node(n.var1)
+		e.node(n.var2)
+		e.wrapper(n.thenWrapper)
+		e.wrapper(n.elseWrapper)
+	case *tagIfNotEqualNode:
+		e.uint(binaryNodeIfNotEqual)
+		e.node(n.var1)
+		e.node(n.var2)
+		e.wrapper(n.thenWrapper)
+		e.wrapper(n.elseWrapper)
+	case *tagImportNode:
+		e.uint(binaryNodeImport)
+		e.token(n.position)
+		e.string(n.filename)
+		e.macros(n.macros)
+	case *tagIncludeNode:
+		e.uint(binaryNodeInclude)
+		e.token(n.position)
+		e.template(n.tpl)
+		e.node(n.filenameEvaluator)
+		e.bool(n.lazy)
+		e.bool(n.only)
+		e.string(n.filename)
+		e.evaluatorMap(n.withPairs)
+		e.bool(n.ifExists)
+	case *tagIncludeEmptyNode:
+		e.uint(binaryNodeIncludeEmpty)
+		e.token(n.position)
+		e.string(n.filename)
+	case *tagLoremNode:
+		e.uint(binaryNodeLorem)
+		e.token(n.position)
+		e.int(n.count)
+		e.string(n.method)
+		e.bool(n.random)
+	case *tagMacroNode:
+		e.uint(binaryNodeMacro)
+		e.macro(n)
+	case *tagNowNode:
+		e.uint(binaryNodeNow)
+		e.token(n.position)
+		e.string(n.format)
+		e.bool(n.fake)
+	case *tagSetNode:
+		e.uint(binaryNodeSet)
+		e.string(n.name)
+		e.node(n.expression)
+	case *tagSpacelessNode:
+		e.uint(binaryNodeSpaceless)
+		e.wrapper(n.wrapper)
+	case *tagSSINode:
+		e.uint(binaryNodeSSI)
+		e.token(n.position)
+		e.string(n.filename)
+		e.node(n.filenameEvaluator)
+		e.bool(n.lazy)
+		e.bool(n.parsed)
+		e.string(n.content)
+		e.template(n.template)
+	case *tagTemplateTagNode:
+		e.uint(binaryNodeTemplateTag)
+		e.string(n.content)
+	case *tagWidthratioNode:
+		e.uint(binaryNodeWidthratio)
+		e.token(n.position)
+		e.node(n.current)
+		e.node(n.max)
+		e.node(n.width)
+		e.string(n.ctxName)
+	case *tagWithNode:
+		e.uint(binaryNodeWith)
+		e.evaluatorMap(n.withPairs)
+		e.wrapper(n.wrapper)
+	default:
+		e.fail(fmt.Errorf("unsupported node type %T", n))
+	}
+}
+
+// binaryDecoder reads the binary format (see binaryEncoder).
+type binaryDecoder struct {
+	set      *TemplateSet
+	buf      []byte
+	objects  []any           // by id
+	verified map[string]bool // sources already checked
+	err      error           // the first error; reads return zero values afterwards
+}
+
+func (d *binaryDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *binaryDecoder) error(err error) *Error {
+	return &Error{
+		Sender:    "frombinary",
+		Kind:      ErrorKindLoad,
+		OrigError: err,
+	}
+}
+
+func (d *binaryDecoder) corrupt() {
+	d.fail(errors.New("corrupt serialized template"))
+}
+
+func (d *binaryDecoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.corrupt()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 || v != int64(int(v)) {
+		d.corrupt()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return int(v)
+}
+
+func (d *binaryDecoder) bool() bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.buf) == 0 || d.buf[0] > 1 {
+		d.corrupt()
+		return false
+	}
+	v := d.buf[0] == 1
+	d.buf = d.buf[1:]
+	return v
+}
+
+func (d *binaryDecoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 8 {
+		d.corrupt()
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+// count reads the length of a list. Each element takes at least a byte,
+// so corrupt lengths don't lead to huge allocations.
+func (d *binaryDecoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.corrupt()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *binaryDecoder) strings() []string {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	list := make([]string, n)
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+// ref reads a reference. It returns the already decoded object or define
+// is true if the object follows (and has to be registered with define()).
+func (d *binaryDecoder) ref() (obj any, define bool) {
+	v := d.uint()
+	switch {
+	case d.err != nil || v == 0:
+		return nil, false
+	case v == 1:
+		return nil, true
+	case v-2 >= uint64(len(d.objects)):
+		d.corrupt()
+		return nil, false
+	}
+	return d.objects[v-2], false
+}
+
+func (d *binaryDecoder) define(obj any) {
+	d.objects = append(d.objects, obj)
+}
+
+func (d *binaryDecoder) sharedString() string {
+	obj, define := d.ref()
+	if define {
+		s := d.string()
+		d.define(binaryString(s))
+		return s
+	}
+	s, ok := obj.(binaryString)
+	if obj != nil && !ok {
+		d.corrupt()
+	}
+	return string(s)
+}
+
+func (d *binaryDecoder) token() *Token {
+	obj, define := d.ref()
+	if !define {
+		t, ok := obj.(*Token)
+		if obj != nil && !ok {
+			d.corrupt()
+		}
+		return t
+	}
+	t := &Token{}
+	d.define(t)
+	t.Filename = d.sharedString()
+	t.Typ = TokenType(d.uint())
+	t.Val = d.string()
+	t.Line = d.int()
+	t.Col = d.int()
+	t.TrimWhitespaces = d.bool()
+	return t
+}
+
+func (d *binaryDecoder) tokens() []*Token {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	tokens := make([]*Token, n)
+	for i := range tokens {
+		tokens[i] = d.token()
+	}
+	return tokens
+}
+
+func (d *binaryDecoder) template() *Template {
+	obj, define := d.ref()
+	if !define {
+		tpl, ok := obj.(*Template)
+		if obj != nil && !ok {
+			d.corrupt()
+		}
+		return tpl
+	}
+	tpl := &Template{
+		set:            d.set,
+		blocks:         make(map[string]*NodeWrapper),
+		exportedMacros: make(map[string]*tagMacroNode),
+		Options:        newOptions(),
+	}
+	tpl.Options.Update(d.set.Options)
+	d.define(tpl)
+
+	tpl.name = d.string()
+	tpl.isTplString = d.bool()
+	tpl.tpl = d.string()
+	tpl.size = len(tpl.tpl)
+
+	for n := d.count(); n > 0; n-- {
+		d.source(tpl)
+	}
+
+	tpl.tokens = d.tokens()
+	tpl.tagTokens = d.tokens()
+	for _, t := range tpl.tagTokens {
+		d.checkTag(t)
+	}
+	tpl.extendsToken = d.token()
+	tpl.parent = d.template()
+	tpl.child = d.template()
+
+	tpl.root = &nodeDocument{Nodes: d.nodes()}
+
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		name := d.string()
+		tpl.blocks[name] = d.wrapper()
+	}
+	tpl.exportedMacros = d.macros()
+	if d.err == nil {
+		tpl.attachCompiled()
+	}
+	return tpl
+}
+
+// source reads a source file of tpl and checks whether it's unchanged.
+func (d *binaryDecoder) source(tpl *Template) {
+	index := d.int()
+	path := d.string()
+	version := d.string()
+	hash := d.string()
+	if d.err != nil {
+		return
+	}
+	var loader TemplateLoader = &LocalFilesystemLoader{}
+	if index >= len(d.set.loaders) {
+		d.fail(fmt.Errorf("%w: source '%s' is loaded by loader %d, but the set has only %d", ErrStaleTemplate, path, index, len(d.set.loaders)))
+		return
+	} else if index >= 0 {
+		loader = d.set.loaders[index]
+	}
+	src := newTemplateSource(loader, path)
+	if !d.verified[path] {
+		// Sources with an unchanged version (see TemplateVersioner) don't
+		// need to be read and hashed
+		if version == "" || src.version != version {
+			current, err := sourceHash(loader, path)
+			if err != nil || current != hash {
+				d.fail(fmt.Errorf("%w: source '%s' has changed", ErrStaleTemplate, path))
+				return
+			}
+		}
+		d.verified[path] = true
+	}
+	tpl.sources = append(tpl.sources, src)
+}
+
+// checkTag makes sure a tag of the template is parsed by this set the same
+// way it has been parsed when the template was serialized.
+func (d *binaryDecoder) checkTag(t *Token) {
+	if t == nil || d.err != nil {
+		return
+	}
+	if _, has := d.set.tags[t.Val]; has {
+		d.fail(fmt.Errorf("%w: tag '%s' is a set-local tag", ErrStaleTemplate, t.Val))
+		return
+	}
+	if _, exists := d.set.lookupTag(t.Val); !exists {
+		d.fail(fmt.Errorf("%w: tag '%s' not found", ErrStaleTemplate, t.Val))
+		return
+	}
+	if !d.set.tagAllowed(t.Val) {
+		d.fail(fmt.Errorf("Usage of tag '%s' is not allowed (sandbox restriction active).", t.Val))
+	}
+}
+
+// filter returns the set's filter function for name.
+func (d *binaryDecoder) filter(name string) FilterFunction {
+	if d.err != nil {
+		return nil
+	}
+	fn, exists := d.set.lookupFilter(name)
+	if !exists {
+		d.fail(fmt.Errorf("%w: filter '%s' does not exist", ErrStaleTemplate, name))
+		return nil
+	}
+	if !d.set.filterAllowed(name) {
+		d.fail(fmt.Errorf("Usage of filter '%s' is not allowed (sandbox restriction active).", name))
+		return nil
+	}
+	return fn
+}
+
+func (d *binaryDecoder) wrapper() *NodeWrapper {
+	obj, define := d.ref()
+	if !define {
+		w, ok := obj.(*NodeWrapper)
+		if obj != nil && !ok {
+			d.corrupt()
+		}
+		return w
+	}
+	w := &NodeWrapper{}
+	d.define(w)
+	w.Endtag = d.string()
+	w.nodes = d.nodes()
+	return w
+}
+
+func (d *binaryDecoder) macro() *tagMacroNode {
+	obj, define := d.ref()
+	if !define {
+		m, ok := obj.(*tagMacroNode)
+		if obj != nil && !ok {
+			d.corrupt()
+		}
+		return m
+	}
+	m := &tagMacroNode{}
+	d.define(m)
+	m.position = d.token()
+	m.nameToken = d.token()
+	m.name = d.string()
+	m.argsOrder = d.strings()
+	m.args = d.evaluatorMap()
+	m.exported = d.bool()
+	m.wrapper = d.wrapper()
+	return m
+}
+
+func (d *binaryDecoder) macros() map[string]*tagMacroNode {
+	macros := make(map[string]*tagMacroNode)
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		name := d.string()
+		macros[name] = d.macro()
+	}
+	return macros
+}
+
+func (d *binaryDecoder) nodes() []INode {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	nodes := make([]INode, 0, n)
+	for ; n > 0 && d.err == nil; n-- {
+		nodes = append(nodes, d.inode())
+	}
+	return nodes
+}
+
+func (d *binaryDecoder) inode() INode {
+	n := d.node()
+	if n == nil {
+		return nil
+	}
+	node, ok := n.(INode)
+	if !ok {
+		d.corrupt()
+	}
+	return node
+}
+
+func (d *binaryDecoder) evaluator() IEvaluator {
+	n := d.node()
+	if n == nil {
+		return nil
+	}
+	ev, ok := n.(IEvaluator)
+	if !ok {
+		d.corrupt()
+	}
+	return ev
+}
+
+func (d *binaryDecoder) evaluators() []IEvaluator {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	list := make([]IEvaluator, 0, n)
+	for ; n > 0 && d.err == nil; n-- {
+		list = append(list, d.evaluator())
+	}
+	return list
+}
+
+func (d *binaryDecoder) evaluatorMap() map[string]IEvaluator {
+	m := make(map[string]IEvaluator)
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		k := d.string()
+		m[k] = d.evaluator()
+	}
+	return m
+}
+
+func (d *binaryDecoder) filterCalls() []*filterCall {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	chain := make([]*filterCall, 0, n)
+	for ; n > 0 && d.err == nil; n-- {
+		fc := &filterCall{token: d.token(), name: d.string()}
+		fc.parameter = d.evaluator()
+		fc.filterFunc = d.filter(fc.name)
+		chain = append(chain, fc)
+	}
+	return chain
+}
+
+// node reads a node or evaluator written by binaryEncoder.node().
+func (d *binaryDecoder) node() any {
+	typ := d.uint()
+	if d.err != nil {
+		return nil
+	}
+	switch typ {
+	case binaryNodeNil:
+		return nil
+	case binaryNodeHTML:
+		return &nodeHTML{token: d.token(), trimLeft: d.bool(), trimRight: d.bool()}
+	case binaryNodeWrapper:
+		return d.wrapper()
+
+	// Expressions
+	case binaryNodeExpression:
+		return &Expression{expr1: d.evaluator(), expr2: d.evaluator(), opToken: d.token()}
+	case binaryNodeRelationalExpression:
+		return &relationalExpression{expr1: d.evaluator(), expr2: d.evaluator(), opToken: d.token()}
+	case binaryNodeSimpleExpression:
+		return &simpleExpression{
+			negate:       d.bool(),
+			negativeSign: d.bool(),
+			term1:        d.evaluator(),
+			term2:        d.evaluator(),
+			opToken:      d.token(),
+		}
+	case binaryNodeNamedTerm:
+		return &namedTerm{name: d.string(), term: d.evaluator()}
+	case binaryNodeTerm:
+		return &term{factor1: d.evaluator(), factor2: d.evaluator(), opToken: d.token()}
+	case binaryNodePower:
+		return &power{power1: d.evaluator(), power2: d.evaluator()}
+
+	// Variables and literals
+	case binaryNodeStringResolver:
+		return newStringResolver(d.token(), d.string())
+	case binaryNodeIntResolver:
+		return newIntResolver(d.token(), d.int())
+	case binaryNodeFloatResolver:
+		return newFloatResolver(d.token(), d.float())
+	case binaryNodeBoolResolver:
+		return newBoolResolver(d.token(), d.bool())
+	case binaryNodeVariableResolver:
+		vr := &variableResolver{locationToken: d.token()}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			part := &variablePart{
+				typ:       d.int(),
+				s:         d.string(),
+				i:         d.int(),
+				subscript: d.evaluator(),
+				isNil:     d.bool(),
+			}
+			part.isFunctionCall = d.bool()
+			for m := d.count(); m > 0 && d.err == nil; m-- {
+				part.callingArgs = append(part.callingArgs, d.evaluator())
+			}
+			vr.parts = append(vr.parts, part)
+		}
+		return vr
+	case binaryNodeFilteredVariable:
+		return &nodeFilteredVariable{
+			locationToken: d.token(),
+			resolver:      d.evaluator(),
+			filterChain:   d.filterCalls(),
+		}
+	case binaryNodeVariable:
+		return &nodeVariable{
+			locationToken: d.token(),
+			expr:          d.evaluator(),
+			escapeContext: escapeContext{kind: escapeKind(d.uint()), attr: attrQuoting(d.uint())},
+		}
+
+	// Tags
+	case binaryNodeAllowMissingVal:
+		return &tagAllowMissingVal{position: d.token(), bodyWrapper: d.wrapper()}
+	case binaryNodeAutoescape:
+		return &tagAutoescapeNode{wrapper: d.wrapper(), autoescape: d.bool(), escaper: d.string()}
+	case binaryNodeBlock:
+		return &tagBlockNode{position: d.token(), name: d.string()}
+	case binaryNodeComment:
+		return &tagCommentNode{}
+	case binaryNodeCycle:
+		return &tagCycleNode{position: d.token(), args: d.evaluators(), asName: d.string(), silent: d.bool()}
+	case binaryNodeExec:
+		return &tagExecNode{position: d.token(), bodyWrapper: d.wrapper()}
+	case binaryNodeExtends:
+		return &tagExtendsNode{position: d.token(), filename: d.string()}
+	case binaryNodeFilter:
+		node := &tagFilterNode{position: d.token(), bodyWrapper: d.wrapper()}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			fc := &nodeFilterCall{token: d.token(), name: d.string()}
+			fc.paramExpr = d.evaluator()
+			fc.filterFunc = d.filter(fc.name)
+			node.filterChain = append(node.filterChain, fc)
+		}
+		return node
+	case binaryNodeFirstof:
+		return &tagFirstofNode{position: d.token(), args: d.evaluators()}
+	case binaryNodeFlush:
+		return &tagFlushNode{position: d.token()}
+	case binaryNodeFor:
+		return &tagForNode{
+			position:        d.token(),
+			key:             d.string(),
+			value:           d.string(),
+			objectEvaluator: d.evaluator(),
+			reversed:        d.bool(),
+			sorted:          d.bool(),
+			bodyWrapper:     d.wrapper(),
+			emptyWrapper:    d.wrapper(),
+		}
+	case binaryNodeIf:
+		node := &tagIfNode{conditions: d.evaluators()}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			node.wrappers = append(node.wrappers, d.wrapper())
+		}
+		return node
+	case binaryNodeIfchanged:
+		return &tagIfchangedNode{watchedExpr: d.evaluators(), thenWrapper: d.wrapper(), elseWrapper: d.wrapper()}
+	case binaryNodeIfEqual:
+		return &tagIfEqualNode{var1: d.evaluator(), var2: d.evaluator(), thenWrapper: d.wrapper(), elseWrapper: d.wrapper()}
+	case binaryNodeIfNotEqual:
+		return &tagIfNotEqualNode{var1: d.evaluator(), var2: d.evaluator(), thenWrapper: d.wrapper(), elseWrapper: d.wrapper()}
+	case binaryNodeImport:
+		return &tagImportNode{position: d.token(), filename: d.string(), macros: d.macros()}
+	case binaryNodeInclude:
+		return &tagIncludeNode{
+			position:          d.token(),
+			tpl:               d.template(),
+			filenameEvaluator: d.evaluator(),
+			lazy:              d.bool(),
+			only:              d.bool(),
+			filename:          d.string(),
+			withPairs:         d.evaluatorMap(),
+			ifExists:          d.bool(),
+		}
+	case binaryNodeIncludeEmpty:
+		return &tagIncludeEmptyNode{position: d.token(), filename: d.string()}
+	case binaryNodeLorem:
+		return &tagLoremNode{position: d.token(), count: d.int(), method: d.string(), random: d.bool()}
+	case binaryNodeMacro:
+		return d.macro()
+	case binaryNodeNow:
+		return &tagNowNode{position: d.token(), format: d.string(), fake: d.bool()}
+	case binaryNodeSet:
+		return &tagSetNode{name: d.string(), expression: d.evaluator()}
+	case binaryNodeSpaceless:
+		return &tagSpacelessNode{wrapper: d.wrapper()}
+	case binaryNodeSSI:
+		return &tagSSINode{
+			position:          d.token(),
+			filename:          d.string(),
+			filenameEvaluator: d.evaluator(),
+			lazy:              d.bool(),
+			parsed:            d.bool(),
+			content:           d.string(),
+			template:          d.template(),
+		}
+	case binaryNodeTemplateTag:
+		return &tagTemplateTagNode{content: d.string()}
+	case binaryNodeWidthratio:
+		return &tagWidthratioNode{
+			position: d.token(),
+			current:  d.evaluator(),
+			max:      d.evaluator(),
+			width:    d.evaluator(),
+			ctxName:  d.string(),
+		}
+	case binaryNodeWith:
+		return &tagWithNode{withPairs: d.evaluatorMap(), wrapper: d.wrapper()}
+	}
+	d.corrupt()
+	return nil
+}
+
+// fromPrecompiled loads a template for FromCache() from PrecompiledDir if
+// it has been serialized there before and is still valid. Otherwise it's
+// compiled and written to PrecompiledDir (failures to write are ignored,
+// the directory is a cache only).
+func (set *TemplateSet) fromPrecompiled(name string) (*Template, error) {
+	filename := set.precompiledFilename(name)
+	if data, err := os.ReadFile(filename); err == nil {
+		if tpl, err := set.FromBinary(data); err == nil && tpl.name == name {
+			return tpl, nil
+		}
+	}
+
+	tpl, err := set.FromFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := tpl.MarshalBinary()
+	if err != nil {
+		// Not serializable (e. g. because of custom tags), just compile it
+		// every time
+		return tpl, nil
+	}
+	if err := writePrecompiled(set.PrecompiledDir, filename, data); err != nil {
+		// The template itself is fine, so don't fail its loading
+		logger.Printf("[template set: %s] can't store the precompiled template '%s': %v", set.name, name, err)
+	}
+	return tpl, nil
+}
+
+// writePrecompiled writes the file atomically, other processes might read
+// it concurrently.
+func writePrecompiled(dir, filename string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// precompiledFilename returns the file in PrecompiledDir for a template.
+func (set *TemplateSet) precompiledFilename(name string) string {
+	hash := sha256.Sum256([]byte(set.name + "\x00" + name))
+	return filepath.Join(set.PrecompiledDir, fmt.Sprintf("%x.p2t", hash[:16]))
+}
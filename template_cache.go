@@ -0,0 +1,283 @@
+package pongo2
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TemplateCache stores compiled templates for TemplateSet.FromCache(). Keys are
+// the resolved template filenames. Implementations must be safe for concurrent use.
+type TemplateCache interface {
+	// Get returns the cached template for name, if any.
+	Get(name string) (*Template, bool)
+
+	// Set adds (or replaces) the template for name.
+	Set(name string, tpl *Template)
+
+	// Delete removes the templates with the given names from the cache.
+	Delete(names ...string)
+
+	// Clear removes all templates from the cache.
+	Clear()
+}
+
+// templateCachePeeker is implemented by caches which are able to look up a
+// template without counting the lookup in their metrics (LRUTemplateCache).
+type templateCachePeeker interface {
+	peek(name string) (*Template, bool)
+}
+
+// TemplateCacheStats contains the overall metrics of a LRUTemplateCache.
+type TemplateCacheStats struct {
+	Entries     int
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64 // entries removed because MaxEntries was reached
+	Expirations uint64 // entries removed because their TTL was exceeded
+}
+
+// TemplateCacheEntryStats contains the metrics of a single cached template.
+type TemplateCacheEntryStats struct {
+	Name       string
+	Hits       uint64
+	Created    time.Time
+	LastAccess time.Time
+}
+
+// LRUTemplateCache is the default TemplateCache. It holds at most MaxEntries
+// templates (evicting the least recently used one) and drops templates which
+// have been cached for longer than the TTL. It is safe for concurrent use;
+// lookups don't take any lock (the hit and miss counters and the recency of
+// the entries are updated atomically), only changes of the cache do.
+type LRUTemplateCache struct {
+	// Accessed atomically (first for the 64-bit alignment on 32-bit platforms)
+	hits   uint64
+	misses uint64
+	clock  uint64 // incremented on each hit and Set(), orders the entries by recency
+
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	entries sync.Map // name -> *lruTemplateCacheEntry
+
+	mu          sync.Mutex // serializes changes of entries and protects the following fields
+	count       int
+	evictions   uint64
+	expirations uint64
+}
+
+type lruTemplateCacheEntry struct {
+	// Accessed atomically
+	hits       uint64
+	lastUse    uint64 // the cache's clock at the last hit
+	lastAccess int64  // unix nanoseconds
+
+	tpl     *Template
+	name    string
+	created time.Time
+}
+
+// NewLRUTemplateCache creates a new LRUTemplateCache. A maxEntries or ttl
+// of 0 means unlimited.
+func NewLRUTemplateCache(maxEntries int, ttl time.Duration) *LRUTemplateCache {
+	return &LRUTemplateCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+// Get returns the cached template for name, if any and not expired.
+func (c *LRUTemplateCache) Get(name string) (*Template, bool) {
+	v, has := c.entries.Load(name)
+	if !has {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+
+	entry := v.(*lruTemplateCacheEntry)
+	now := c.now()
+	if c.expired(entry, now) {
+		c.mu.Lock()
+		if v, has := c.entries.Load(name); has && v == entry {
+			c.remove(entry)
+			c.expirations++
+		}
+		c.mu.Unlock()
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+
+	atomic.StoreUint64(&entry.lastUse, atomic.AddUint64(&c.clock, 1))
+	atomic.AddUint64(&entry.hits, 1)
+	atomic.StoreInt64(&entry.lastAccess, now.UnixNano())
+	atomic.AddUint64(&c.hits, 1)
+	return entry.tpl, true
+}
+
+// peek returns the cached template for name like Get(), but without
+// counting the lookup in the metrics or marking the template as used.
+func (c *LRUTemplateCache) peek(name string) (*Template, bool) {
+	v, has := c.entries.Load(name)
+	if !has {
+		return nil, false
+	}
+	entry := v.(*lruTemplateCacheEntry)
+	if c.expired(entry, c.now()) {
+		return nil, false
+	}
+	return entry.tpl, true
+}
+
+func (c *LRUTemplateCache) expired(entry *lruTemplateCacheEntry, now time.Time) bool {
+	return c.ttl > 0 && now.Sub(entry.created) > c.ttl
+}
+
+// Set adds (or replaces) the template for name, evicting the least
+// recently used template if the cache is full.
+func (c *LRUTemplateCache) Set(name string, tpl *Template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry := &lruTemplateCacheEntry{
+		lastUse:    atomic.AddUint64(&c.clock, 1),
+		lastAccess: now.UnixNano(),
+		tpl:        tpl,
+		name:       name,
+		created:    now,
+	}
+	if _, has := c.entries.Load(name); !has {
+		c.count++
+	}
+	c.entries.Store(name, entry)
+
+	for c.maxEntries > 0 && c.count > c.maxEntries {
+		c.remove(c.leastRecentlyUsed())
+		c.evictions++
+	}
+}
+
+// leastRecentlyUsed returns the entry used least recently. Finding it takes
+// a scan of all entries, which only happens when the cache is full.
+func (c *LRUTemplateCache) leastRecentlyUsed() *lruTemplateCacheEntry {
+	var lru *lruTemplateCacheEntry
+	var lruUse uint64
+	c.entries.Range(func(_, v any) bool {
+		entry := v.(*lruTemplateCacheEntry)
+		if use := atomic.LoadUint64(&entry.lastUse); lru == nil || use < lruUse {
+			lru, lruUse = entry, use
+		}
+		return true
+	})
+	return lru
+}
+
+// Delete removes the templates with the given names from the cache.
+func (c *LRUTemplateCache) Delete(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		if v, has := c.entries.Load(name); has {
+			c.remove(v.(*lruTemplateCacheEntry))
+		}
+	}
+}
+
+// Clear removes all templates from the cache. Metrics are kept.
+func (c *LRUTemplateCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries.Range(func(k, _ any) bool {
+		c.entries.Delete(k)
+		return true
+	})
+	c.count = 0
+}
+
+// Stats returns the overall cache metrics.
+func (c *LRUTemplateCache) Stats() TemplateCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return TemplateCacheStats{
+		Entries:     c.count,
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+	}
+}
+
+// EntryStats returns the metrics of all cached templates, sorted by name.
+func (c *LRUTemplateCache) EntryStats() []TemplateCacheEntryStats {
+	var stats []TemplateCacheEntryStats
+	c.entries.Range(func(_, v any) bool {
+		entry := v.(*lruTemplateCacheEntry)
+		stats = append(stats, TemplateCacheEntryStats{
+			Name:       entry.name,
+			Hits:       atomic.LoadUint64(&entry.hits),
+			Created:    entry.created,
+			LastAccess: time.Unix(0, atomic.LoadInt64(&entry.lastAccess)),
+		})
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// remove removes the entry; c.mu must be held.
+func (c *LRUTemplateCache) remove(entry *lruTemplateCacheEntry) {
+	c.entries.Delete(entry.name)
+	c.count--
+}
+
+// templateSource is a loaded file a template consists of, used for
+// change detection (see TemplateSet.CacheCheckInterval).
+type templateSource struct {
+	loader  TemplateLoader
+	path    string
+	version string
+}
+
+func newTemplateSource(loader TemplateLoader, path string) templateSource {
+	src := templateSource{
+		loader: loader,
+		path:   path,
+	}
+	if v, ok := loader.(TemplateVersioner); ok {
+		// An error leads to an empty version which will be detected as change later
+		src.version, _ = v.Version(path)
+	}
+	return src
+}
+
+// addDependency records the sources of a statically extended, included or
+// imported template, so changes to them are detected as well.
+func (tpl *Template) addDependency(dep *Template) {
+	tpl.sources = append(tpl.sources, dep.sources...)
+}
+
+// sourcesChanged reports whether any of the template's sources has changed
+// since it has been loaded. Sources of loaders not implementing
+// TemplateVersioner are never considered changed.
+func (tpl *Template) sourcesChanged() bool {
+	for _, src := range tpl.sources {
+		v, ok := src.loader.(TemplateVersioner)
+		if !ok {
+			continue
+		}
+		version, err := v.Version(src.path)
+		if err != nil || version != src.version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,841 @@
+package pongo2
+
+import (
+	goContext "context"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Runtime support for templates compiled ahead of time to Go code by
+// GenerateGo(). The types are used by the generated code; their API may
+// change between versions, so generated code must be regenerated after
+// upgrading pongo2.
+
+// CompiledTemplate is a template compiled to Go code. Its fields are set
+// by the generated code.
+type CompiledTemplate struct {
+	// Name is the template's name (relative to the template directory).
+	Name string
+
+	// Source is the template's source. It's parsed once per TemplateSet for
+	// the tags which aren't compiled and the error positions.
+	Source string
+
+	// Render implements the template. It's nil for templates which are
+	// executed by the interpreter (templates extending another template).
+	Render func(rt *Runtime) error
+
+	// Layout describes the kinds of the nodes and expressions Render refers
+	// to (see compiledTree.layout()).
+	Layout string
+
+	// TrimBlocks and LStripBlocks are the options the template was compiled
+	// with (they're applied to the HTML at compile time).
+	TrimBlocks   bool
+	LStripBlocks bool
+
+	// The template parsed by the last set it was executed with
+	// (*compiledSetTemplate)
+	parsed atomic.Value
+}
+
+type compiledSetTemplate struct {
+	set *TemplateSet
+	tpl *Template
+}
+
+// CompiledTemplates are the templates of a generated package. It's the
+// TemplateLoader for their sources, so templates can extend, include and
+// import each other like in the template directory they were compiled from.
+// Templates parsed from a CompiledTemplates (by any set) are executed with
+// their compiled code.
+type CompiledTemplates struct {
+	templates map[string]*CompiledTemplate
+}
+
+// NewCompiledTemplates creates the collection of a generated package's templates.
+func NewCompiledTemplates(templates ...*CompiledTemplate) *CompiledTemplates {
+	ct := &CompiledTemplates{
+		templates: make(map[string]*CompiledTemplate, len(templates)),
+	}
+	for _, t := range templates {
+		ct.templates[t.Name] = t
+	}
+	return ct
+}
+
+// Abs resolves name relative to the template directory (like a
+// LocalFilesystemLoader with a base directory).
+func (ct *CompiledTemplates) Abs(base, name string) string {
+	return path.Clean(name)
+}
+
+// Get returns the source of a compiled template.
+func (ct *CompiledTemplates) Get(name string) (io.Reader, error) {
+	t, has := ct.templates[name]
+	if !has {
+		return nil, fmt.Errorf("compiled template '%s' not found", name)
+	}
+	return strings.NewReader(t.Source), nil
+}
+
+// ExecuteWriter executes the compiled template name and writes the result
+// to w. The templates are parsed with set, whose loader must be ct. Nothing
+// is written on error; instead the error is being returned.
+func (ct *CompiledTemplates) ExecuteWriter(set *TemplateSet, name string, context Context, w io.Writer) error {
+	return ct.ExecuteWriterContext(goContext.Background(), set, name, context, w)
+}
+
+// ExecuteWriterContext is like ExecuteWriter, but aborts the execution
+// with an error as soon as goCtx is cancelled or its deadline is exceeded.
+func (ct *CompiledTemplates) ExecuteWriterContext(goCtx goContext.Context, set *TemplateSet, name string, context Context, w io.Writer) error {
+	c, has := ct.templates[name]
+	if !has {
+		return fmt.Errorf("compiled template '%s' not found", name)
+	}
+	tpl, err := c.template(set)
+	if err != nil {
+		return err
+	}
+	return tpl.ExecuteWriterContext(goCtx, context, w)
+}
+
+// template returns the template parsed by set, which has been checked
+// against the compiled code when it was loaded (see attach()).
+func (c *CompiledTemplate) template(set *TemplateSet) (*Template, error) {
+	if parsed, ok := c.parsed.Load().(*compiledSetTemplate); ok && parsed.set == set {
+		return parsed.tpl, nil
+	}
+	tpl, err := set.FromCache(c.Name)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.compiledErr != nil {
+		return nil, tpl.compiledErr
+	}
+	if c.Render != nil && tpl.parent == nil && tpl.compiled != c {
+		return nil, fmt.Errorf("template '%s' differs from the compiled one (is the set's loader the CompiledTemplates?)", c.Name)
+	}
+	if !set.Debug {
+		c.parsed.Store(&compiledSetTemplate{set: set, tpl: tpl})
+	}
+	return tpl, nil
+}
+
+// attachCompiled makes a template loaded from a file execute its compiled
+// code if the file is a compiled template. The file's source is the last
+// one (after the ones of the templates it depends on).
+func (tpl *Template) attachCompiled() {
+	if tpl.isTplString || len(tpl.sources) == 0 {
+		return
+	}
+	src := tpl.sources[len(tpl.sources)-1]
+	if ct, ok := src.loader.(*CompiledTemplates); ok {
+		ct.attach(src.path, tpl)
+	}
+}
+
+// attach makes tpl, which has just been parsed from the source of the
+// compiled template name, execute the compiled code (if the structure of
+// the parsed template matches it).
+func (ct *CompiledTemplates) attach(name string, tpl *Template) {
+	c, has := ct.templates[name]
+	if !has || c.Render == nil || tpl.parent != nil {
+		return
+	}
+	if tpl.Options.TrimBlocks != c.TrimBlocks || tpl.Options.LStripBlocks != c.LStripBlocks {
+		tpl.compiledErr = fmt.Errorf("template '%s' was compiled with different TrimBlocks/LStripBlocks options", name)
+		return
+	}
+	tree := newCompiledTree(tpl)
+	if tree.layout() != c.Layout {
+		tpl.compiledErr = fmt.Errorf("template '%s' doesn't match the compiled one (are the same tags registered?)", name)
+		return
+	}
+	tpl.compiled = c
+	tpl.compiledTree = tree
+}
+
+// useCompiled reports whether the template is executed by its compiled code.
+// Changing the whitespace options after parsing falls back to the
+// interpreter.
+func (tpl *Template) useCompiled() bool {
+	return tpl.compiled != nil &&
+		tpl.Options.TrimBlocks == tpl.compiled.TrimBlocks &&
+		tpl.Options.LStripBlocks == tpl.compiled.LStripBlocks
+}
+
+func (tpl *Template) executeCompiled(ctx *ExecutionContext, writer TemplateWriter) *Error {
+	rt := runtimePool.Get().(*Runtime)
+	*rt = Runtime{ctx: ctx, writer: writer, tree: tpl.compiledTree}
+	err := tpl.compiled.Render(rt)
+	*rt = Runtime{}
+	runtimePool.Put(rt)
+	if err != nil {
+		return ctx.Error(err, nil)
+	}
+	return nil
+}
+
+// Runtimes are only used by the generated code (which doesn't keep them),
+// so they're reused.
+var runtimePool = sync.Pool{
+	New: func() any {
+		return new(Runtime)
+	},
+}
+
+// compiledTree numbers the nodes, node lists and expressions of a template
+// the way the code generated by GenerateGo() refers to them.
+type compiledTree struct {
+	nodes []INode
+	lists [][]INode    // lists with includes which may be rendered in parallel
+	exprs []IEvaluator // the expressions of variables and if-tags
+	paths []atomic.Value
+}
+
+func newCompiledTree(tpl *Template) *compiledTree {
+	t := &compiledTree{}
+	t.walk(tpl.root.Nodes)
+	t.paths = make([]atomic.Value, len(t.exprs))
+	return t
+}
+
+// walk numbers the nodes depth-first, descending into the tags compiled to
+// Go code.
+func (t *compiledTree) walk(nodes []INode) {
+	if parallelIncludeCandidates(nodes) {
+		t.lists = append(t.lists, nodes)
+	}
+
+	for _, n := range nodes {
+		t.nodes = append(t.nodes, n)
+		switch n := n.(type) {
+		case *nodeVariable:
+			t.expr(n.expr)
+		case *tagIfNode:
+			for _, condition := range n.conditions {
+				t.expr(condition)
+			}
+			for _, w := range n.wrappers {
+				t.walk(w.nodes)
+			}
+		case *tagForNode:
+			t.walk(n.bodyWrapper.nodes)
+			if n.emptyWrapper != nil {
+				t.walk(n.emptyWrapper.nodes)
+			}
+		case *tagWithNode:
+			t.walk(n.wrapper.nodes)
+		}
+	}
+}
+
+// expr numbers an expression and its operands depth-first.
+func (t *compiledTree) expr(e IEvaluator) {
+	t.exprs = append(t.exprs, e)
+	switch e := e.(type) {
+	case *Expression:
+		t.exprs2(e.expr1, e.expr2)
+	case *relationalExpression:
+		if e.expr2 != nil || e.opToken == nil {
+			t.exprs2(e.expr1, e.expr2)
+		}
+	case *simpleExpression:
+		t.exprs2(e.term1, e.term2)
+	case *term:
+		t.exprs2(e.factor1, e.factor2)
+	case *power:
+		t.exprs2(e.power1, e.power2)
+	case *nodeFilteredVariable:
+		if !e.handlesUndefined() {
+			t.expr(e.resolver)
+		}
+	}
+}
+
+func (t *compiledTree) exprs2(e1, e2 IEvaluator) {
+	t.expr(e1)
+	if e2 != nil {
+		t.expr(e2)
+	}
+}
+
+// parallelIncludeCandidates reports whether nodes contains includes which
+// may be rendered in parallel (see newParallelIncludes()).
+func parallelIncludeCandidates(nodes []INode) bool {
+	includes := 0
+	for _, n := range nodes {
+		if _, ok := n.(*tagIncludeNode); ok {
+			includes++
+		}
+	}
+	return includes >= 2
+}
+
+// layout describes the kind of each node and expression, so code generated
+// for another structure (e. g. because a set replaces the if-tag) isn't
+// used.
+func (t *compiledTree) layout() string {
+	var b strings.Builder
+	for _, n := range t.nodes {
+		switch n.(type) {
+		case *nodeHTML:
+			b.WriteByte('h')
+		case *nodeVariable:
+			b.WriteByte('v')
+		case *tagCommentNode:
+			b.WriteByte('c')
+		case *tagIfNode:
+			b.WriteByte('i')
+		case *tagForNode:
+			b.WriteByte('f')
+		case *tagWithNode:
+			b.WriteByte('w')
+		case *tagIncludeNode:
+			b.WriteByte('x')
+		default:
+			b.WriteByte('n')
+		}
+	}
+	b.WriteByte('|')
+	for _, e := range t.exprs {
+		switch e.(type) {
+		case *Expression:
+			b.WriteByte('e')
+		case *relationalExpression:
+			b.WriteByte('r')
+		case *simpleExpression:
+			b.WriteByte('s')
+		case *term:
+			b.WriteByte('t')
+		case *power:
+			b.WriteByte('p')
+		case *nodeFilteredVariable:
+			b.WriteByte('f')
+		case *variableResolver:
+			b.WriteByte('v')
+		case *stringResolver:
+			b.WriteByte('q')
+		case *intResolver:
+			b.WriteByte('i')
+		case *floatResolver:
+			b.WriteByte('d')
+		case *boolResolver:
+			b.WriteByte('b')
+		default:
+			b.WriteByte('n')
+		}
+	}
+	return b.String()
+}
+
+// Runtime is the state of a compiled template's execution. Each method
+// executing a node counts it against the Limits and checks for
+// cancellation first, just like the interpreter.
+//
+// The methods evaluating expressions return a placeholder once an
+// expression failed; the error is returned by the method consuming the
+// expression's value (Output() or Cond()).
+type Runtime struct {
+	ctx    *ExecutionContext // the context of the tag body being executed
+	writer TemplateWriter
+	tree   *compiledTree
+	err    *Error
+
+	// The bodies of the for- or with-tag being executed (see tagBodies)
+	body, empty func(rt *Runtime) error
+}
+
+// HTML writes the content of a HTML node.
+func (rt *Runtime) HTML(s string) error {
+	if err := rt.ctx.enterNode(); err != nil {
+		return err
+	}
+	if _, err := rt.writer.WriteString(s); err != nil {
+		return rt.ctx.Error(err, nil)
+	}
+	return nil
+}
+
+// Skip counts a node without output (a comment).
+func (rt *Runtime) Skip() error {
+	return rt.Enter()
+}
+
+// Enter counts a node whose code follows (a variable or an if-tag).
+func (rt *Runtime) Enter() error {
+	if err := rt.ctx.enterNode(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Node executes node i with the interpreter.
+func (rt *Runtime) Node(i int) error {
+	if err := rt.ctx.enterNode(); err != nil {
+		return err
+	}
+	if err := rt.tree.nodes[i].Execute(rt.ctx, rt.writer); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Output writes v, the evaluated expression of variable node i, escaped as
+// configured.
+func (rt *Runtime) Output(i int, v *Value) error {
+	if rt.err != nil {
+		return rt.failed()
+	}
+	if err := rt.tree.nodes[i].(*nodeVariable).write(rt.ctx, rt.writer, v); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Cond returns whether the evaluated condition v of an if-tag is true.
+func (rt *Runtime) Cond(v *Value) (bool, error) {
+	if rt.err != nil {
+		return false, rt.failed()
+	}
+	return v.IsTrue(), nil
+}
+
+// For executes the for-tag i: body is called for each item, empty (which
+// may be nil) if there's nothing to iterate over.
+func (rt *Runtime) For(i int, body, empty func(rt *Runtime) error) error {
+	if err := rt.ctx.enterNode(); err != nil {
+		return err
+	}
+	node := rt.tree.nodes[i].(*tagForNode)
+	rt.body, rt.empty = body, empty
+	if err := node.iterate(rt.ctx, rt); err != nil {
+		return err
+	}
+	return nil
+}
+
+// With executes the with-tag i: body is called with the tag's variables.
+func (rt *Runtime) With(i int, body func(rt *Runtime) error) error {
+	if err := rt.ctx.enterNode(); err != nil {
+		return err
+	}
+	node := rt.tree.nodes[i].(*tagWithNode)
+	rt.body, rt.empty = body, nil
+	if err := node.scope(rt.ctx, rt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rt *Runtime) executeBody(ctx *ExecutionContext) *Error {
+	return rt.execute(ctx, rt.body)
+}
+
+func (rt *Runtime) executeEmpty(ctx *ExecutionContext) *Error {
+	return rt.execute(ctx, rt.empty)
+}
+
+// execute runs the generated code of a tag body with the tag's (child)
+// context. The runtime is reused for it (instead of allocating one per
+// body), so its context and the bodies (which nested tags replace) are
+// restored afterwards.
+func (rt *Runtime) execute(ctx *ExecutionContext, fn func(rt *Runtime) error) *Error {
+	if fn == nil {
+		return nil
+	}
+	parent, body, empty := rt.ctx, rt.body, rt.empty
+	rt.ctx = ctx
+	err := fn(rt)
+	rt.ctx, rt.body, rt.empty = parent, body, empty
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return ctx.Error(err, nil)
+}
+
+// IncludeGroup renders the includes of a node list in parallel if the
+// template's Options.ParallelIncludes say so.
+type IncludeGroup struct {
+	p *parallelIncludes
+}
+
+// Includes returns the group of the node list l (nil if its includes are
+// rendered one after another).
+func (rt *Runtime) Includes(l int) *IncludeGroup {
+	if rt.ctx.state.includeSlots == nil {
+		return nil
+	}
+	p := newParallelIncludes(rt.ctx, rt.tree.lists[l])
+	if p == nil {
+		return nil
+	}
+	return &IncludeGroup{p: p}
+}
+
+// Start must be called before the execution of the list's node i-1 with i.
+func (g *IncludeGroup) Start(i int) {
+	if g != nil {
+		g.p.start(i)
+	}
+}
+
+// Wait waits for the includes still being rendered (if the execution of the
+// list has been aborted).
+func (g *IncludeGroup) Wait() {
+	if g != nil {
+		g.p.wait()
+	}
+}
+
+// Include executes the include-tag i, which is node j of the list of g.
+func (rt *Runtime) Include(i int, g *IncludeGroup, j int) error {
+	if err := rt.ctx.enterNode(); err != nil {
+		return err
+	}
+	if g != nil {
+		if r := g.p.result(j); r != nil {
+			if r.err != nil {
+				return r.err
+			}
+			r.buf.release()
+			_, err := r.buf.WriteTo(rt.writer)
+			r.buf.put()
+			if err != nil {
+				return rt.ctx.Error(err, nil)
+			}
+			return nil
+		}
+	}
+	if err := rt.tree.nodes[i].Execute(rt.ctx, rt.writer); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Eval evaluates expression k with the interpreter.
+func (rt *Runtime) Eval(k int) *Value {
+	if rt.err != nil {
+		return rt.placeholder()
+	}
+	v, err := rt.tree.exprs[k].Evaluate(rt.ctx)
+	return rt.result(v, err)
+}
+
+// Path evaluates the variable k (e. g. user.Name), which consists of names
+// and indexes only. The lookups are cached per type (see compiledPath).
+func (rt *Runtime) Path(k int) *Value {
+	if rt.err != nil {
+		return rt.placeholder()
+	}
+	vr := rt.tree.exprs[k].(*variableResolver)
+	cache := &rt.tree.paths[k]
+	if p, ok := cache.Load().(*compiledPath); ok {
+		if v, ok := p.resolve(rt.ctx, vr); ok {
+			return v
+		}
+	}
+	if v, ok := vr.resolveFast(rt.ctx); ok {
+		return v
+	}
+	if p := newCompiledPath(rt.ctx, vr); p != nil {
+		cache.Store(p)
+		if v, ok := p.resolve(rt.ctx, vr); ok {
+			return v
+		}
+	}
+	return rt.Eval(k)
+}
+
+// Var returns the variable name of the context (like the first part of a
+// path) for code accessing its fields directly (see GenerateGoWithTypes()):
+// the value of a *Value, unless it's a safe or an undefined one, or nil if
+// there's no such variable. The code falls back to Path() if the variable
+// hasn't the expected type.
+func (rt *Runtime) Var(name string) any {
+	val, has := rt.ctx.Private[name]
+	if !has {
+		val = rt.ctx.Public[name]
+	}
+	if v, ok := val.(*Value); ok && v != nil && !v.safe && !v.undefined && v.val.IsValid() && v.val.CanInterface() {
+		return v.val.Interface()
+	}
+	return val
+}
+
+// Typed reports whether the path k (whose first variable has the expected
+// type) may be resolved by accessing the fields directly, types being the
+// static types of the values the parts after the first are looked up in.
+// The set's AttributePolicy and TypeResolvers (which may change at any time)
+// are respected; otherwise the code falls back to Path().
+func (rt *Runtime) Typed(k int, types []reflect.Type) bool {
+	if rt.err != nil {
+		return false
+	}
+	set := rt.ctx.template.set
+	parts := rt.tree.exprs[k].(*variableResolver).parts[1:]
+	for idx, t := range types {
+		if _, has := set.lookupTypeResolver(t); has {
+			return false
+		}
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct && !checkPathField(rt.ctx, t, parts[idx].s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter applies filter j of the filtered variable k to v.
+func (rt *Runtime) Filter(k, j int, v *Value) *Value {
+	if rt.err != nil {
+		return rt.placeholder()
+	}
+	v, err := rt.tree.exprs[k].(*nodeFilteredVariable).filterChain[j].Execute(v, rt.ctx)
+	return rt.result(v, err)
+}
+
+// Rel applies the comparison k to v1 and v2.
+func (rt *Runtime) Rel(k int, v1, v2 *Value) *Value {
+	if rt.err != nil {
+		return rt.placeholder()
+	}
+	v, err := rt.tree.exprs[k].(*relationalExpression).compare(rt.ctx, v1, v2)
+	return rt.result(v, err)
+}
+
+// Simple applies the signs and the operator of the expression k to t1 and
+// t2 (which is nil without a second term).
+func (rt *Runtime) Simple(k int, t1, t2 *Value) *Value {
+	if rt.err != nil {
+		return rt.placeholder()
+	}
+	v, err := rt.tree.exprs[k].(*simpleExpression).apply(rt.ctx, t1, t2)
+	return rt.result(v, err)
+}
+
+// Term applies the operator of the term k to f1 and f2.
+func (rt *Runtime) Term(k int, f1, f2 *Value) *Value {
+	if rt.err != nil {
+		return rt.placeholder()
+	}
+	v, err := rt.tree.exprs[k].(*term).apply(rt.ctx, f1, f2)
+	return rt.result(v, err)
+}
+
+// Power raises p1 to the power of p2.
+func (rt *Runtime) Power(p1, p2 *Value) *Value {
+	if rt.err != nil {
+		return rt.placeholder()
+	}
+	return AsValue(math.Pow(p1.Float(), p2.Float()))
+}
+
+// True reports whether v is true (false after an error).
+func (rt *Runtime) True(v *Value) bool {
+	return rt.err == nil && v.IsTrue()
+}
+
+// Bool returns b as value.
+func (rt *Runtime) Bool(b bool) *Value {
+	return AsValue(b)
+}
+
+func (rt *Runtime) result(v *Value, err *Error) *Value {
+	if err != nil {
+		rt.err = err
+		return rt.placeholder()
+	}
+	return v
+}
+
+func (rt *Runtime) placeholder() *Value {
+	return AsValue(nil)
+}
+
+// failed returns the error of the failed expression and resets it.
+func (rt *Runtime) failed() *Error {
+	err := rt.err
+	rt.err = nil
+	return err
+}
+
+// compiledPath caches how a variable path like user.Name was resolved the
+// last time: the type of each value a part was looked up in and how it was
+// looked up. As long as the values have the same types, the lookups are
+// repeated without asking the variable resolver. Everything which isn't a
+// plain struct field, string map key or index (types with a TypeResolver,
+// Resolvers, methods, functions, missing values, nil pointers, ...) is left
+// to the resolver, so the results are the same.
+type compiledPath struct {
+	types []reflect.Type // of the values the parts after the first are looked up in
+	steps []pathStep
+}
+
+type pathStep struct {
+	deref bool          // whether the value is a pointer to dereference first
+	field []int         // index of the struct field
+	key   reflect.Value // map key (if the value is a map)
+}
+
+var typeOfString = reflect.TypeOf("")
+
+// isPath reports whether the variable consists of names and indexes only
+// (e. g. user.Name or items.0, but not user.Name() or items[i]).
+func (vr *variableResolver) isPath() bool {
+	if len(vr.parts) == 0 || vr.parts[0].typ != varTypeIdent {
+		return false
+	}
+	for _, part := range vr.parts {
+		if part.isFunctionCall || (part.typ != varTypeIdent && part.typ != varTypeInt) {
+			return false
+		}
+	}
+	return true
+}
+
+func newCompiledPath(ctx *ExecutionContext, vr *variableResolver) *compiledPath {
+	current, _, ok := pathStart(ctx, vr)
+	if !ok {
+		return nil
+	}
+	p := &compiledPath{}
+	for _, part := range vr.parts[1:] {
+		t := current.Type()
+		if _, has := ctx.template.set.lookupTypeResolver(t); has || t == typeOfJSONRawMessage {
+			return nil
+		}
+		info := typeInfoOf(t)
+		var step pathStep
+		if part.typ == varTypeIdent {
+			if _, has := info.methods[part.s]; has || info.resolver {
+				return nil
+			}
+		}
+		if current.Kind() == reflect.Ptr {
+			step.deref = true
+			if current = current.Elem(); !current.IsValid() {
+				return nil
+			}
+		}
+		switch {
+		case part.typ == varTypeIdent && current.Kind() == reflect.Struct:
+			index, has := typeInfoOf(current.Type()).fields[part.s]
+			if !has || !checkPathField(ctx, current.Type(), part.s) {
+				return nil
+			}
+			step.field = index
+			current = current.FieldByIndex(index)
+		case part.typ == varTypeIdent && current.Kind() == reflect.Map && current.Type().Key() == typeOfString:
+			step.key = reflect.ValueOf(part.s)
+			current = current.MapIndex(step.key)
+		case part.typ == varTypeInt && part.i >= 0 &&
+			(current.Kind() == reflect.Slice || current.Kind() == reflect.Array || current.Kind() == reflect.String):
+			if part.i >= current.Len() {
+				return nil
+			}
+			current = current.Index(part.i)
+		default:
+			return nil
+		}
+		if current, _, ok = pathValue(current, false); !ok {
+			return nil
+		}
+		p.types = append(p.types, t)
+		p.steps = append(p.steps, step)
+	}
+	return p
+}
+
+// resolve repeats the lookups. It reports false if the values have other
+// types or the result must be left to the resolver.
+func (p *compiledPath) resolve(ctx *ExecutionContext, vr *variableResolver) (*Value, bool) {
+	current, safe, ok := pathStart(ctx, vr)
+	if !ok {
+		return nil, false
+	}
+	for idx, part := range vr.parts[1:] {
+		if current.Type() != p.types[idx] {
+			return nil, false
+		}
+		step := &p.steps[idx]
+		if step.deref {
+			if current = current.Elem(); !current.IsValid() {
+				return nil, false
+			}
+		}
+		switch {
+		case step.field != nil:
+			if !checkPathField(ctx, current.Type(), part.s) {
+				return nil, false
+			}
+			current = current.FieldByIndex(step.field)
+		case step.key.IsValid():
+			current = current.MapIndex(step.key)
+		default:
+			if part.i >= current.Len() {
+				return nil, false
+			}
+			current = current.Index(part.i)
+		}
+		if current, safe, ok = pathValue(current, safe); !ok {
+			return nil, false
+		}
+	}
+	return &Value{val: current, safe: safe}, true
+}
+
+// pathStart looks up the first part of the variable.
+func pathStart(ctx *ExecutionContext, vr *variableResolver) (reflect.Value, bool, bool) {
+	val, has := ctx.Private[vr.parts[0].s]
+	if !has {
+		val, has = ctx.Public[vr.parts[0].s]
+	}
+	if !has {
+		return reflect.Value{}, false, false
+	}
+	return pathValue(reflect.ValueOf(val), false)
+}
+
+// pathValue unpacks a looked up value like the variable resolver does. It
+// reports false for values left to the resolver (nil and undefined values
+// and functions).
+func pathValue(v reflect.Value, safe bool) (reflect.Value, bool, bool) {
+	if !v.IsValid() {
+		return v, safe, false
+	}
+	if v.Type() == typeOfValuePtr {
+		value := v.Interface().(*Value)
+		if value == nil || value.undefined {
+			return v, safe, false
+		}
+		v, safe = value.val, value.safe
+	}
+	if v.Kind() == reflect.Interface {
+		v = reflect.ValueOf(v.Interface())
+	}
+	if !v.IsValid() || v.Kind() == reflect.Func {
+		return v, safe, false
+	}
+	return v, safe, true
+}
+
+// checkPathField asks the set's AttributePolicy (which may change at any
+// time) whether the field name of the struct type t may be accessed.
+// Denied accesses are left to the resolver, which fails with the error.
+func checkPathField(ctx *ExecutionContext, t reflect.Type, name string) bool {
+	policy := ctx.template.set.AttributePolicy
+	return policy == nil || policy(t, name, false)
+}
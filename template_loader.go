@@ -9,7 +9,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"strings"
 )
 
 // FSLoader supports the fs.FS interface for loading templates
@@ -23,14 +25,38 @@ func NewFSLoader(fs fs.FS) *FSLoader {
 	}
 }
 
+// Abs resolves name relative to the directory of base. The result might be
+// outside of the file system (e. g. "../secret.html"); Get denies loading
+// it then.
 func (l *FSLoader) Abs(base, name string) string {
-	return filepath.Join(filepath.Dir(base), name)
+	return pathpkg.Join(pathpkg.Dir(filepath.ToSlash(base)), filepath.ToSlash(name))
 }
 
+// Get opens path, if it's a valid path inside of the file system (see
+// fs.ValidPath).
 func (l *FSLoader) Get(path string) (io.Reader, error) {
+	if !fs.ValidPath(path) {
+		return nil, sandboxPathError(path)
+	}
 	return l.fs.Open(path)
 }
 
+// Version returns the file's modification time and size (see TemplateVersioner).
+func (l *FSLoader) Version(path string) (string, error) {
+	if !fs.ValidPath(path) {
+		return "", sandboxPathError(path)
+	}
+	fi, err := fs.Stat(l.fs, path)
+	if err != nil {
+		return "", err
+	}
+	return fileInfoVersion(fi), nil
+}
+
+func fileInfoVersion(fi fs.FileInfo) string {
+	return fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size())
+}
+
 // LocalFilesystemLoader represents a local filesystem loader with basic
 // BaseDirectory capabilities. The access to the local filesystem is unrestricted.
 type LocalFilesystemLoader struct {
@@ -98,6 +124,15 @@ func (fs *LocalFilesystemLoader) Get(path string) (io.Reader, error) {
 	return bytes.NewReader(buf), nil
 }
 
+// Version returns the file's modification time and size (see TemplateVersioner).
+func (fs *LocalFilesystemLoader) Version(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fileInfoVersion(fi), nil
+}
+
 // Abs resolves a filename relative to the base directory. Absolute paths are allowed.
 // When there's no base dir set, the absolute path to the filename
 // will be calculated based on either the provided base directory (which
@@ -126,55 +161,183 @@ func (fs *LocalFilesystemLoader) Abs(base, name string) string {
 	return filepath.Join(fs.baseDir, name)
 }
 
-// SandboxedFilesystemLoader is still WIP.
+// ErrOutsideSandbox is wrapped by the errors of loaders denying access to
+// a path outside of their sandbox (see SandboxedFilesystemLoader and
+// FSLoader). Those errors are *Errors of kind ErrorKindSandbox.
+var ErrOutsideSandbox = errors.New("path is outside of the sandbox")
+
+func sandboxPathError(path string) *Error {
+	return &Error{
+		Filename:  path,
+		Sender:    "loader",
+		Kind:      ErrorKindSandbox,
+		OrigError: fmt.Errorf("%w: '%s'", ErrOutsideSandbox, path),
+	}
+}
+
+// SandboxedFilesystemLoader is a LocalFilesystemLoader which confines the
+// templates to its base directory: paths leaving it (using "..", absolute
+// paths or symlinks pointing outside of it) are denied with an *Error
+// wrapping ErrOutsideSandbox.
 type SandboxedFilesystemLoader struct {
 	*LocalFilesystemLoader
+
+	// AllowedDirectories restricts the templates further to the directories
+	// matching one of these patterns (and their subdirectories), if not
+	// empty. The patterns are relative to the base directory, use slashes
+	// and the syntax of path.Match (e. g. "shared" or "tenants/*"; "." is
+	// the base directory itself). Set it before loading any template.
+	AllowedDirectories []string
+
+	// The base directory with all symlinks resolved
+	root string
 }
 
-// NewSandboxedFilesystemLoader creates a new sandboxed local file system instance.
+// NewSandboxedFilesystemLoader creates a new sandboxed local file system
+// instance. A base directory is required.
 func NewSandboxedFilesystemLoader(baseDir string) (*SandboxedFilesystemLoader, error) {
-	fs, err := NewLocalFileSystemLoader(baseDir)
+	if baseDir == "" {
+		return nil, errors.New("the sandboxed filesystem loader requires a base directory")
+	}
+	fs := &SandboxedFilesystemLoader{
+		LocalFilesystemLoader: &LocalFilesystemLoader{},
+	}
+	if err := fs.SetBaseDir(baseDir); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// SetBaseDir sets the directory the templates are confined to.
+func (fs *SandboxedFilesystemLoader) SetBaseDir(path string) error {
+	if err := fs.LocalFilesystemLoader.SetBaseDir(path); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(fs.baseDir)
+	if err != nil {
+		return err
+	}
+	fs.root = root
+	return nil
+}
+
+// Abs resolves a filename relative to the base directory. The result might
+// be outside of the sandbox; Get denies loading it then.
+func (fs *SandboxedFilesystemLoader) Abs(base, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(fs.baseDir, name)
+}
+
+// Get reads the path's content from your local filesystem, if it's inside
+// of the sandbox.
+func (fs *SandboxedFilesystemLoader) Get(path string) (io.Reader, error) {
+	f, _, err := fs.open(path)
 	if err != nil {
 		return nil, err
 	}
-	return &SandboxedFilesystemLoader{
-		LocalFilesystemLoader: fs,
-	}, nil
-}
-
-// Move sandbox to a virtual fs
-
-/*
-if len(set.SandboxDirectories) > 0 {
-    defer func() {
-        // Remove any ".." or other crap
-        resolvedPath = filepath.Clean(resolvedPath)
-
-        // Make the path absolute
-        absPath, err := filepath.Abs(resolvedPath)
-        if err != nil {
-            panic(err)
-        }
-        resolvedPath = absPath
-
-        // Check against the sandbox directories (once one pattern matches, we're done and can allow it)
-        for _, pattern := range set.SandboxDirectories {
-            matched, err := filepath.Match(pattern, resolvedPath)
-            if err != nil {
-                panic("Wrong sandbox directory match pattern (see http://golang.org/pkg/path/filepath/#Match).")
-            }
-            if matched {
-                // OK!
-                return
-            }
-        }
-
-        // No pattern matched, we have to log+deny the request
-        set.logf("Access attempt outside of the sandbox directories (blocked): '%s'", resolvedPath)
-        resolvedPath = ""
-    }()
-}
-*/
+	defer f.Close()
+	buf, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(buf), nil
+}
+
+// Version returns the file's modification time and size (see
+// TemplateVersioner), if it's inside of the sandbox.
+func (fs *SandboxedFilesystemLoader) Version(path string) (string, error) {
+	f, fi, err := fs.open(path)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return fileInfoVersion(fi), nil
+}
+
+// Hooks of the tests, called before and after open() opens a file.
+var testHookSandboxOpen, testHookSandboxOpened func()
+
+// open opens path, if it's inside of the sandbox. The file is opened first
+// and verified afterwards, so the path can't be changed in between (e. g. by
+// swapping a directory for a symlink pointing outside): it must resolve to
+// the opened file inside of the sandbox.
+func (fs *SandboxedFilesystemLoader) open(path string) (*os.File, os.FileInfo, error) {
+	path = fs.Abs("", path)
+	if _, inside := relativePath(fs.baseDir, path); !inside {
+		return nil, nil, sandboxPathError(path)
+	}
+
+	if testHookSandboxOpen != nil {
+		testHookSandboxOpen()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if testHookSandboxOpened != nil {
+		testHookSandboxOpened()
+	}
+	fi, err := fs.verify(path, f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, fi, nil
+}
+
+// verify checks that the file f opened by path is inside of the sandbox:
+// path with all symlinks resolved (which might point anywhere) must be
+// inside of it and still be the opened file. It returns the file's info.
+func (fs *SandboxedFilesystemLoader) verify(path string, f *os.File) (os.FileInfo, error) {
+	opened, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, sandboxPathError(path)
+	}
+	rel, inside := relativePath(fs.root, resolved)
+	if !inside || !fs.directoryAllowed(filepath.ToSlash(filepath.Dir(rel))) {
+		return nil, sandboxPathError(path)
+	}
+	current, err := os.Lstat(resolved)
+	if err != nil || !os.SameFile(opened, current) {
+		return nil, sandboxPathError(path)
+	}
+	return opened, nil
+}
+
+// directoryAllowed reports whether dir (relative to the base directory)
+// matches AllowedDirectories.
+func (fs *SandboxedFilesystemLoader) directoryAllowed(dir string) bool {
+	if len(fs.AllowedDirectories) == 0 {
+		return true
+	}
+	for {
+		for _, pattern := range fs.AllowedDirectories {
+			if matched, _ := pathpkg.Match(pattern, dir); matched {
+				return true
+			}
+		}
+		if dir == "." {
+			return false
+		}
+		dir = pathpkg.Dir(dir)
+	}
+}
+
+// relativePath returns path relative to root and whether it's inside of it
+// (both must be absolute and clean).
+func relativePath(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
 
 // HttpFilesystemLoader supports loading templates
 // from an http.FileSystem - useful for using one of several
@@ -219,14 +382,31 @@ func (h *HttpFilesystemLoader) Abs(base, name string) string {
 
 // Get returns an io.Reader where the template's content can be read from.
 func (h *HttpFilesystemLoader) Get(path string) (io.Reader, error) {
-	fullPath := path
-	if h.baseDir != "" {
-		fullPath = fmt.Sprintf(
-			"%s/%s",
-			h.baseDir,
-			fullPath,
-		)
+	return h.fs.Open(h.fullPath(path))
+}
+
+// Version returns the file's modification time and size (see TemplateVersioner).
+func (h *HttpFilesystemLoader) Version(path string) (string, error) {
+	f, err := h.fs.Open(h.fullPath(path))
+	if err != nil {
+		return "", err
 	}
+	defer f.Close()
 
-	return h.fs.Open(fullPath)
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return fileInfoVersion(fi), nil
+}
+
+func (h *HttpFilesystemLoader) fullPath(path string) string {
+	if h.baseDir == "" {
+		return path
+	}
+	return fmt.Sprintf(
+		"%s/%s",
+		h.baseDir,
+		path,
+	)
 }
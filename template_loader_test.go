@@ -0,0 +1,76 @@
+package pongo2
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSandboxedFilesystemLoaderSwappedDirectory(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "page.html"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	tenant := filepath.Join(dir, "tenant")
+	if err := os.Mkdir(tenant, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tenant, "page.html"), []byte("page"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	// swap exchanges the tenant directory and the symlink pointing outside
+	swap := func() {
+		tmp := filepath.Join(dir, "tmp")
+		for _, rename := range [][2]string{{"tenant", "tmp"}, {"link", "tenant"}, {"tmp", "link"}} {
+			if err := os.Rename(filepath.Join(dir, rename[0]), filepath.Join(dir, rename[1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := os.Lstat(tmp); !os.IsNotExist(err) {
+			t.Fatalf("swapping the directory failed: %v", err)
+		}
+	}
+	defer func() {
+		testHookSandboxOpen, testHookSandboxOpened = nil, nil
+	}()
+
+	loader, err := NewSandboxedFilesystemLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() (string, error) {
+		r, err := loader.Get("tenant/page.html")
+		if err != nil {
+			return "", err
+		}
+		content, err := io.ReadAll(r)
+		return string(content), err
+	}
+	if content, err := get(); err != nil || content != "page" {
+		t.Fatalf("got %q, %v", content, err)
+	}
+
+	// Swapped after the path has been checked, before the file is opened
+	testHookSandboxOpen = swap
+	if content, err := get(); !errors.Is(err, ErrOutsideSandbox) {
+		t.Errorf("swapped before opening: got %q, %v; want ErrOutsideSandbox", content, err)
+	}
+	testHookSandboxOpen = nil
+
+	// Swapped back after the file outside has been opened, before it's
+	// verified (the path resolves inside of the sandbox again)
+	testHookSandboxOpened = swap
+	if content, err := get(); !errors.Is(err, ErrOutsideSandbox) {
+		t.Errorf("swapped after opening: got %q, %v; want ErrOutsideSandbox", content, err)
+	}
+	if _, err := loader.Version("tenant/page.html"); !errors.Is(err, ErrOutsideSandbox) {
+		t.Errorf("Version: got error %v, want ErrOutsideSandbox", err)
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"io"
 	"log"
 	"os"
+	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // TemplateLoader allows to implement a virtual file system.
@@ -19,6 +23,38 @@ type TemplateLoader interface {
 	Get(path string) (io.Reader, error)
 }
 
+// AttributePolicy decides whether a template may access the struct field or
+// method name of a value of type t (for methods, t is the receiver type which
+// might be a pointer). Denied accesses abort the execution with an *Error whose
+// Sender is "sandbox:attribute". Map keys, slice indexes and functions passed
+// within the context are not subject to the policy.
+//
+// Fields and methods accessed implicitly are checked as well: printing a
+// value ({{ user }}) calls its String method, the in-operator checks for a
+// field of a struct ("Password" in user) and the stringformat and tojson
+// filters (as well as JSON output and JavaScript values with contextual
+// autoescaping) format all fields of structs (or call their String, Error,
+// Format, MarshalJSON or MarshalText method). Other filters get the values
+// themselves and may call their methods, like String for the filters
+// working on strings.
+type AttributePolicy func(t reflect.Type, name string, isMethod bool) bool
+
+// NoMethodCalls is an AttributePolicy which allows all struct fields, but
+// no methods (including GetAttr) to be accessed by templates.
+func NoMethodCalls(t reflect.Type, name string, isMethod bool) bool {
+	return !isMethod
+}
+
+// TemplateVersioner is an optional capability of a TemplateLoader. If a loader
+// implements it, FromCache() is able to detect changed templates (see
+// TemplateSet.CacheCheckInterval).
+type TemplateVersioner interface {
+	// Version returns an opaque version of the template at path (e. g. its
+	// modification time or a hash of its content) which changes whenever
+	// the template's content changes.
+	Version(path string) (string, error)
+}
+
 // TemplateSet allows you to create your own group of templates with their own
 // global context (which is shared among all members of the set) and their own
 // configuration.
@@ -43,17 +79,72 @@ type TemplateSet struct {
 
 	// Sandbox features
 	// - Disallow access to specific tags and/or filters (using BanTag() and BanFilter())
+	// - Only allow access to specific tags and/or filters (using AllowTags() and AllowFilters())
+	// - Limit the resources used by an execution (using Limits)
 	//
-	// For efficiency reasons you can ban tags/filters only *before* you have
+	// For efficiency reasons you can ban/allow tags/filters only *before* you have
 	// added your first template to the set (restrictions are statically checked).
 	// After you added one, it's not possible anymore (for your personal security).
-	firstTemplateCreated bool
+	firstTemplateCreated int32 // accessed atomically, templates may be compiled concurrently
 	bannedTags           map[string]bool
 	bannedFilters        map[string]bool
+	allowedTags          map[string]bool // nil means all tags are allowed
+	allowedFilters       map[string]bool // nil means all filters are allowed
+
+	// Tags and filters only available to this set (see RegisterTag() and
+	// RegisterFilter()). They take precedence over the global ones.
+	tags    map[string]*tag
+	filters map[string]FilterFunction
+
+	// Type resolvers only available to this set (see RegisterTypeResolver())
+	typeResolvers map[reflect.Type]TypeResolver
+
+	// DisableRawSSI disables the ssi-tag without the 'parsed' argument,
+	// which outputs any file the set's loaders can read as is. Parsed
+	// templates can still be included with it (like with the include-tag).
+	DisableRawSSI bool
+
+	// AttributePolicy, if set, restricts which struct fields and methods
+	// templates are allowed to access by name (e. g. {{ user.Name }} or
+	// {{ user.Delete() }}). See AttributePolicy for more information.
+	AttributePolicy AttributePolicy
+
+	// Limits define execution budgets (output size, loop iterations, ...)
+	// for all templates of this set; see Limits for more information.
+	// Changing them only affects executions started afterwards.
+	Limits Limits
+
+	// Cache stores the compiled templates for FromCache(). Defaults to an
+	// unbounded LRUTemplateCache; use NewLRUTemplateCache() to create a cache
+	// with a size limit and/or TTL. It must not be nil.
+	Cache TemplateCache
+
+	// CacheCheckInterval enables change detection for FromCache(): a cached
+	// template is checked for changes (of itself and of all templates/files it
+	// statically extends, includes or imports) at most once per interval and
+	// recompiled if required (if this fails, the outdated template is removed
+	// from the cache and the error is returned). Only templates loaded
+	// through a loader implementing TemplateVersioner can be checked.
+	// Defaults to 0 (disabled).
+	CacheCheckInterval time.Duration
+
+	// PrecompiledDir, if set, is a directory where FromCache() stores the
+	// compiled templates in their serialized form (see
+	// Template.MarshalBinary()), so other processes (or later runs) load them
+	// from there instead of compiling them again. Stale files are detected
+	// and replaced. The directory must exist; it's not used in debug mode.
+	PrecompiledDir string
+
+	// Compilations in progress for FromCache(), so concurrent cache misses
+	// of the same template compile it only once
+	compilations      map[string]*templateCompilation
+	compilationsMutex sync.Mutex
+}
 
-	// Template cache (for FromCache())
-	templateCache      map[string]*Template
-	templateCacheMutex sync.Mutex
+type templateCompilation struct {
+	done chan struct{}
+	tpl  *Template
+	err  error
 }
 
 // NewSet can be used to create sets with different kind of templates
@@ -70,8 +161,12 @@ func NewSet(name string, loaders ...TemplateLoader) *TemplateSet {
 		Globals:       make(Context),
 		bannedTags:    make(map[string]bool),
 		bannedFilters: make(map[string]bool),
-		templateCache: make(map[string]*Template),
+		tags:          make(map[string]*tag),
+		filters:       make(map[string]FilterFunction),
+		typeResolvers: make(map[reflect.Type]TypeResolver),
+		Cache:         NewLRUTemplateCache(0, 0),
 		Options:       newOptions(),
+		compilations:  make(map[string]*templateCompilation),
 	}
 }
 
@@ -97,11 +192,11 @@ func (set *TemplateSet) resolveFilenameForLoader(loader TemplateLoader, tpl *Tem
 
 // BanTag bans a specific tag for this template set. See more in the documentation for TemplateSet.
 func (set *TemplateSet) BanTag(name string) error {
-	_, has := tags[name]
+	_, has := set.lookupTag(name)
 	if !has {
 		return fmt.Errorf("tag '%s' not found", name)
 	}
-	if set.firstTemplateCreated {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
 		return errors.New("you cannot ban any tags after you've added your first template to your template set")
 	}
 	_, has = set.bannedTags[name]
@@ -121,11 +216,11 @@ func (set *TemplateSet) MustBanTag(name string) {
 
 // BanFilter bans a specific filter for this template set. See more in the documentation for TemplateSet.
 func (set *TemplateSet) BanFilter(name string) error {
-	_, has := filters[name]
+	_, has := set.lookupFilter(name)
 	if !has {
 		return fmt.Errorf("filter '%s' not found", name)
 	}
-	if set.firstTemplateCreated {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
 		return errors.New("you cannot ban any filters after you've added your first template to your template set")
 	}
 	_, has = set.bannedFilters[name]
@@ -143,6 +238,234 @@ func (set *TemplateSet) MustBanFilter(name string) {
 	}
 }
 
+// AllowTags switches the set to allow-list mode for tags: only the given
+// tags (and the ones given in further calls) can be used by templates of this
+// set, including tags registered later. See more in the documentation for TemplateSet.
+func (set *TemplateSet) AllowTags(names ...string) error {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
+		return errors.New("you cannot allow any tags after you've added your first template to your template set")
+	}
+	for _, name := range names {
+		if _, has := set.lookupTag(name); !has {
+			return fmt.Errorf("tag '%s' not found", name)
+		}
+	}
+	if set.allowedTags == nil {
+		set.allowedTags = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		set.allowedTags[name] = true
+	}
+
+	return nil
+}
+
+func (set *TemplateSet) MustAllowTags(names ...string) {
+	if err := set.AllowTags(names...); err != nil {
+		panic(err)
+	}
+}
+
+// AllowFilters switches the set to allow-list mode for filters: only the given
+// filters (and the ones given in further calls) can be used by templates of this
+// set, including filters registered later. See more in the documentation for TemplateSet.
+func (set *TemplateSet) AllowFilters(names ...string) error {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
+		return errors.New("you cannot allow any filters after you've added your first template to your template set")
+	}
+	for _, name := range names {
+		if _, has := set.lookupFilter(name); !has {
+			return fmt.Errorf("filter '%s' not found", name)
+		}
+	}
+	if set.allowedFilters == nil {
+		set.allowedFilters = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		set.allowedFilters[name] = true
+	}
+
+	return nil
+}
+
+func (set *TemplateSet) MustAllowFilters(names ...string) {
+	if err := set.AllowFilters(names...); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterTag registers a new tag which is only available to templates of
+// this set. It fails if a tag with the same name is already registered
+// globally or within this set (use ReplaceTag() to override it). Tags can
+// only be registered before you have added your first template to the set.
+func (set *TemplateSet) RegisterTag(name string, parserFn TagParser) error {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
+		return errors.New("you cannot register any tags after you've added your first template to your template set")
+	}
+	if _, existing := set.lookupTag(name); existing {
+		return fmt.Errorf("tag with name '%s' is already registered", name)
+	}
+	set.tags[name] = &tag{
+		name:   name,
+		parser: parserFn,
+	}
+	return nil
+}
+
+func (set *TemplateSet) MustRegisterTag(name string, parserFn TagParser) {
+	if err := set.RegisterTag(name, parserFn); err != nil {
+		panic(err)
+	}
+}
+
+// ReplaceTag overrides an already registered (global or set) tag for the
+// templates of this set only.
+func (set *TemplateSet) ReplaceTag(name string, parserFn TagParser) error {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
+		return errors.New("you cannot replace any tags after you've added your first template to your template set")
+	}
+	if _, existing := set.lookupTag(name); !existing {
+		return fmt.Errorf("tag with name '%s' does not exist (therefore cannot be overridden)", name)
+	}
+	set.tags[name] = &tag{
+		name:   name,
+		parser: parserFn,
+	}
+	return nil
+}
+
+// RegisterFilter registers a new filter which is only available to templates
+// of this set. It fails if a filter with the same name is already registered
+// globally or within this set (use ReplaceFilter() to override it). Filters
+// can only be registered before you have added your first template to the set.
+func (set *TemplateSet) RegisterFilter(name string, fn FilterFunction) error {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
+		return errors.New("you cannot register any filters after you've added your first template to your template set")
+	}
+	if _, existing := set.lookupFilter(name); existing {
+		return fmt.Errorf("filter with name '%s' is already registered", name)
+	}
+	set.filters[name] = fn
+	return nil
+}
+
+func (set *TemplateSet) MustRegisterFilter(name string, fn FilterFunction) {
+	if err := set.RegisterFilter(name, fn); err != nil {
+		panic(err)
+	}
+}
+
+// ReplaceFilter overrides an already registered (global or set) filter for
+// the templates of this set only.
+func (set *TemplateSet) ReplaceFilter(name string, fn FilterFunction) error {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
+		return errors.New("you cannot replace any filters after you've added your first template to your template set")
+	}
+	if _, existing := set.lookupFilter(name); !existing {
+		return fmt.Errorf("filter with name '%s' does not exist (therefore cannot be overridden)", name)
+	}
+	set.filters[name] = fn
+	return nil
+}
+
+// RegisterTypeResolver registers a resolver for values of type t for the
+// templates of this set only (see TypeResolver). It takes precedence over a
+// global resolver for the same type.
+func (set *TemplateSet) RegisterTypeResolver(t reflect.Type, fn TypeResolver) error {
+	if atomic.LoadInt32(&set.firstTemplateCreated) != 0 {
+		return errors.New("you cannot register any type resolvers after you've added your first template to your template set")
+	}
+	if _, existing := set.typeResolvers[t]; existing {
+		return fmt.Errorf("type resolver for type %s is already registered", t)
+	}
+	set.typeResolvers[t] = fn
+	return nil
+}
+
+func (set *TemplateSet) MustRegisterTypeResolver(t reflect.Type, fn TypeResolver) {
+	if err := set.RegisterTypeResolver(t, fn); err != nil {
+		panic(err)
+	}
+}
+
+// TagNames returns the names of all tags (global and set tags) templates of
+// this set are allowed to use, sorted.
+func (set *TemplateSet) TagNames() []string {
+	names := make([]string, 0, len(tags)+len(set.tags))
+	for name := range tags {
+		if _, overridden := set.tags[name]; !overridden && set.tagAllowed(name) {
+			names = append(names, name)
+		}
+	}
+	for name := range set.tags {
+		if set.tagAllowed(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FilterNames returns the names of all filters (global and set filters)
+// templates of this set are allowed to use, sorted.
+func (set *TemplateSet) FilterNames() []string {
+	names := make([]string, 0, len(filters)+len(set.filters))
+	for name := range filters {
+		if _, overridden := set.filters[name]; !overridden && set.filterAllowed(name) {
+			names = append(names, name)
+		}
+	}
+	for name := range set.filters {
+		if set.filterAllowed(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupTag returns the tag for name; set tags take precedence over global ones.
+func (set *TemplateSet) lookupTag(name string) (*tag, bool) {
+	if t, has := set.tags[name]; has {
+		return t, true
+	}
+	t, has := tags[name]
+	return t, has
+}
+
+// lookupFilter returns the filter for name; set filters take precedence over global ones.
+func (set *TemplateSet) lookupFilter(name string) (FilterFunction, bool) {
+	if fn, has := set.filters[name]; has {
+		return fn, true
+	}
+	fn, has := filters[name]
+	return fn, has
+}
+
+func (set *TemplateSet) lookupTypeResolver(t reflect.Type) (TypeResolver, bool) {
+	if fn, has := set.typeResolvers[t]; has {
+		return fn, true
+	}
+	fn, has := typeResolvers[t]
+	return fn, has
+}
+
+// tagAllowed reports whether the sandbox allows templates to use the tag.
+func (set *TemplateSet) tagAllowed(name string) bool {
+	if set.bannedTags[name] {
+		return false
+	}
+	return set.allowedTags == nil || set.allowedTags[name]
+}
+
+// filterAllowed reports whether the sandbox allows templates to use the filter.
+func (set *TemplateSet) filterAllowed(name string) bool {
+	if set.bannedFilters[name] {
+		return false
+	}
+	return set.allowedFilters == nil || set.allowedFilters[name]
+}
+
 func (set *TemplateSet) resolveTemplate(tpl *Template, path string) (name string, loader TemplateLoader, fd io.Reader, err error) {
 	// iterate over loaders until we appear to have a valid template
 	for _, loader = range set.loaders {
@@ -151,6 +474,10 @@ func (set *TemplateSet) resolveTemplate(tpl *Template, path string) (name string
 		if err == nil {
 			return
 		}
+		if e, ok := err.(*Error); ok && e.Kind == ErrorKindSandbox {
+			// Denied by the loader, don't try the next one
+			return name, loader, nil, e
+		}
 	}
 
 	return path, nil, nil, fmt.Errorf("unable to resolve template")
@@ -160,23 +487,24 @@ func (set *TemplateSet) resolveTemplate(tpl *Template, path string) (name string
 // it will remove the template caches of those filenames.
 // Or it will empty the whole template cache. It is thread-safe.
 func (set *TemplateSet) CleanCache(filenames ...string) {
-	set.templateCacheMutex.Lock()
-	defer set.templateCacheMutex.Unlock()
-
 	if len(filenames) == 0 {
-		set.templateCache = make(map[string]*Template, len(set.templateCache))
+		set.Cache.Clear()
+		return
 	}
 
+	names := make([]string, 0, len(filenames))
 	for _, filename := range filenames {
-		delete(set.templateCache, set.resolveFilename(nil, filename))
+		names = append(names, set.resolveFilename(nil, filename))
 	}
+	set.Cache.Delete(names...)
 }
 
 // FromCache is a convenient method to cache templates. It is thread-safe
 // and will only compile the template associated with a filename once.
 // If TemplateSet.Debug is true (for example during development phase),
 // FromCache() will not cache the template and instead recompile it on any
-// call (to make changes to a template live instantaneously).
+// call (to make changes to a template live instantaneously). See
+// TemplateSet.Cache and TemplateSet.CacheCheckInterval for more options.
 func (set *TemplateSet) FromCache(filename string) (*Template, error) {
 	if set.Debug {
 		// Recompile on any request
@@ -185,66 +513,182 @@ func (set *TemplateSet) FromCache(filename string) (*Template, error) {
 	// Cache the template
 	cleanedFilename := set.resolveFilename(nil, filename)
 
-	set.templateCacheMutex.Lock()
-	defer set.templateCacheMutex.Unlock()
+	// Cache hit
+	tpl, has := set.Cache.Get(cleanedFilename)
+	if has && !set.cachedTemplateChanged(tpl) {
+		return tpl, nil
+	}
 
-	tpl, has := set.templateCache[cleanedFilename]
+	// Cache miss (or the template has changed)
+	return set.compileForCache(cleanedFilename, tpl)
+}
 
-	// Cache miss
-	if !has {
-		tpl, err := set.FromFile(cleanedFilename)
-		if err != nil {
-			return nil, err
-		}
-		set.templateCache[cleanedFilename] = tpl
+// compileForCache compiles the template and adds it to the cache. Concurrent
+// calls for the same name wait for the first one and share its result;
+// different names are compiled in parallel. stale is the outdated cached
+// template (if any) which must not be returned.
+func (set *TemplateSet) compileForCache(name string, stale *Template) (*Template, error) {
+	set.compilationsMutex.Lock()
+	if c, has := set.compilations[name]; has {
+		set.compilationsMutex.Unlock()
+		<-c.done
+		return c.tpl, c.err
+	}
+	// Another compilation might have finished since our cache lookup (which
+	// has been counted as miss already)
+	if tpl, has := set.peekCache(name); has && tpl != stale {
+		set.compilationsMutex.Unlock()
 		return tpl, nil
 	}
+	c := &templateCompilation{
+		done: make(chan struct{}),
+		err: &Error{
+			Filename:  name,
+			Sender:    "fromcache",
+			Kind:      ErrorKindLoad,
+			OrigError: errors.New("compilation aborted"),
+		},
+	}
+	set.compilations[name] = c
+	set.compilationsMutex.Unlock()
+
+	defer func() {
+		set.compilationsMutex.Lock()
+		delete(set.compilations, name)
+		set.compilationsMutex.Unlock()
+		close(c.done)
+	}()
+
+	if set.PrecompiledDir != "" {
+		c.tpl, c.err = set.fromPrecompiled(name)
+	} else {
+		c.tpl, c.err = set.FromFile(name)
+	}
+	if c.err != nil {
+		if stale != nil {
+			// Don't keep serving the outdated template until the next check
+			// (without reporting that its changes are broken)
+			set.Cache.Delete(name)
+		}
+		return nil, c.err
+	}
+	atomic.StoreInt64(&c.tpl.lastChecked, time.Now().UnixNano())
+	set.Cache.Set(name, c.tpl)
+	return c.tpl, nil
+}
 
-	// Cache hit
-	return tpl, nil
+// peekCache looks up the template in the cache, without counting the lookup
+// if the cache supports it.
+func (set *TemplateSet) peekCache(name string) (*Template, bool) {
+	if p, ok := set.Cache.(templateCachePeeker); ok {
+		return p.peek(name)
+	}
+	return set.Cache.Get(name)
+}
+
+// cachedTemplateChanged reports whether a cached template must be recompiled
+// because one of its sources has changed (see CacheCheckInterval).
+func (set *TemplateSet) cachedTemplateChanged(tpl *Template) bool {
+	if set.CacheCheckInterval <= 0 {
+		return false
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&tpl.lastChecked)
+	if now-last < int64(set.CacheCheckInterval) {
+		return false
+	}
+	if !atomic.CompareAndSwapInt64(&tpl.lastChecked, last, now) {
+		// Somebody else is checking right now
+		return false
+	}
+	return tpl.sourcesChanged()
 }
 
 // FromString loads a template from string and returns a Template instance.
 func (set *TemplateSet) FromString(tpl string) (*Template, error) {
-	set.firstTemplateCreated = true
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
 
 	return newTemplateString(set, []byte(tpl))
 }
 
+// FromStringAll is like FromString, but doesn't stop at the first syntax
+// error: broken tags and variables are skipped, so all lexer and parser errors
+// of the template are returned at once (sorted by position). A template is
+// only returned if there are no errors. Errors of included/extended/imported
+// templates are reported at the respective tag.
+func (set *TemplateSet) FromStringAll(tpl string) (*Template, []*Error) {
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
+
+	return compileTemplate(set, "<string>", true, []byte(tpl), true)
+}
+
+// Validate compiles the template source and returns all errors found
+// (see FromStringAll()), or nil if it's valid.
+func (set *TemplateSet) Validate(source string) []*Error {
+	_, errs := set.FromStringAll(source)
+	return errs
+}
+
 // FromBytes loads a template from bytes and returns a Template instance.
 func (set *TemplateSet) FromBytes(tpl []byte) (*Template, error) {
-	set.firstTemplateCreated = true
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
 
 	return newTemplateString(set, tpl)
 }
 
 // FromFile loads a template from a filename and returns a Template instance.
 func (set *TemplateSet) FromFile(filename string) (*Template, error) {
-	set.firstTemplateCreated = true
+	tpl, errs := set.fromFile(filename, false)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return tpl, nil
+}
 
-	_, _, fd, err := set.resolveTemplate(nil, filename)
+// FromFileAll is like FromFile, but returns all lexer and parser errors of
+// the template at once (see FromStringAll()).
+func (set *TemplateSet) FromFileAll(filename string) (*Template, []*Error) {
+	return set.fromFile(filename, true)
+}
+
+func (set *TemplateSet) fromFile(filename string, collect bool) (*Template, []*Error) {
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
+
+	name, loader, fd, err := set.resolveTemplate(nil, filename)
+	if e, ok := err.(*Error); ok {
+		return nil, []*Error{e}
+	}
 	if err != nil {
-		return nil, &Error{
+		return nil, []*Error{{
 			Filename:  filename,
 			Sender:    "fromfile",
+			Kind:      ErrorKindLoad,
 			OrigError: err,
-		}
+		}}
 	}
+	source := newTemplateSource(loader, name)
 	buf, err := io.ReadAll(fd)
 	if err != nil {
-		return nil, &Error{
+		return nil, []*Error{{
 			Filename:  filename,
 			Sender:    "fromfile",
+			Kind:      ErrorKindLoad,
 			OrigError: err,
-		}
+		}}
 	}
 
-	return newTemplate(set, filename, false, buf)
+	tpl, errs := compileTemplate(set, filename, false, buf, collect)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	tpl.sources = append(tpl.sources, source)
+	tpl.attachCompiled()
+	return tpl, nil
 }
 
 // RenderTemplateString is a shortcut and renders a template string directly.
 func (set *TemplateSet) RenderTemplateString(s string, ctx Context) (string, error) {
-	set.firstTemplateCreated = true
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
 
 	tpl := Must(set.FromString(s))
 	result, err := tpl.Execute(ctx)
@@ -256,7 +700,7 @@ func (set *TemplateSet) RenderTemplateString(s string, ctx Context) (string, err
 
 // RenderTemplateBytes is a shortcut and renders template bytes directly.
 func (set *TemplateSet) RenderTemplateBytes(b []byte, ctx Context) (string, error) {
-	set.firstTemplateCreated = true
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
 
 	tpl := Must(set.FromBytes(b))
 	result, err := tpl.Execute(ctx)
@@ -268,7 +712,7 @@ func (set *TemplateSet) RenderTemplateBytes(b []byte, ctx Context) (string, erro
 
 // RenderTemplateFile is a shortcut and renders a template file directly.
 func (set *TemplateSet) RenderTemplateFile(fn string, ctx Context) (string, error) {
-	set.firstTemplateCreated = true
+	atomic.StoreInt32(&set.firstTemplateCreated, 1)
 
 	tpl := Must(set.FromFile(fn))
 	result, err := tpl.Execute(ctx)
@@ -304,6 +748,8 @@ var (
 
 	// Methods on the default set
 	FromString           = DefaultSet.FromString
+	FromStringAll        = DefaultSet.FromStringAll
+	Validate             = DefaultSet.Validate
 	FromBytes            = DefaultSet.FromBytes
 	FromFile             = DefaultSet.FromFile
 	FromCache            = DefaultSet.FromCache
@@ -320,3 +320,10 @@ truncatewords_html
 {{ "<p>This </a>is a long test, which will be cutted after some words.</p>"|truncatewords_html:5 }}
 {{ "<p>This is a long test which will be cutted after some words.</p>"|truncatewords_html:2 }}
 {{ "<p>This is a long test which will be cutted after some words.</p>"|truncatewords_html:0 }}
+tojson
+{{ simple.name|tojson }}
+{{ simple.nil|tojson }}
+{{ simple.number|tojson }}
+{{ "<a href='x'>"|tojson }}
+fromjson
+{% with data='{"a": [1, 2.5, "x"], "b": true}'|fromjson %}{{ data.a.0 }} {{ data.a.1 }} {{ data.a.2 }} {{ data.b }} {{ data|tojson }}{% endwith %}
@@ -13,6 +13,8 @@ type Value struct {
 	name string // used for keyword arguments
 	val  reflect.Value
 	safe bool // used to indicate whether a Value needs explicit escaping in the template
+
+	undefined bool // used by UndefinedChainable for unresolvable variables
 }
 
 // AsValue converts any given value to a pongo2.Value
@@ -43,6 +45,49 @@ func AsSafeValue(i any) *Value {
 	}
 }
 
+// Values are immutable: once created, neither their methods nor the
+// template engine change them (deriving a Value, like a safe or a named one,
+// creates a new one). So the engine shares the Values of literals (created
+// once when they're parsed) and of common results (nil, booleans, the empty
+// string and small integers) instead of allocating them per evaluation.
+// AsValue and AsSafeValue return a new Value each.
+var (
+	valueNil         = &Value{val: reflect.ValueOf(nil)}
+	valueTrue        = &Value{val: reflect.ValueOf(true)}
+	valueFalse       = &Value{val: reflect.ValueOf(false)}
+	valueEmptyString = &Value{val: reflect.ValueOf("")}
+	valueSmallInts   [256]*Value
+)
+
+func init() {
+	for i := range valueSmallInts {
+		valueSmallInts[i] = &Value{val: reflect.ValueOf(i)}
+	}
+}
+
+// sharedValue is AsValue for values created by the engine: it returns the
+// shared Value of common values.
+func sharedValue(i any) *Value {
+	switch i := i.(type) {
+	case nil:
+		return valueNil
+	case bool:
+		if i {
+			return valueTrue
+		}
+		return valueFalse
+	case string:
+		if i == "" {
+			return valueEmptyString
+		}
+	case int:
+		if i >= 0 && i < len(valueSmallInts) {
+			return valueSmallInts[i]
+		}
+	}
+	return AsValue(i)
+}
+
 func (v *Value) getResolvedValue() reflect.Value {
 	if v.val.IsValid() && v.val.Kind() == reflect.Ptr {
 		return v.val.Elem()
@@ -98,6 +143,12 @@ func (v *Value) IsNil() bool {
 	return !v.getResolvedValue().IsValid()
 }
 
+// IsUndefined checks whether the value is the result of an unresolvable
+// variable (only when using UndefinedChainable). Undefined values are nil as well.
+func (v *Value) IsUndefined() bool {
+	return v.undefined
+}
+
 // IsKwarg checks whether the underlying value is a keyword argument
 func (v *Value) IsKwarg() bool {
 	return v.name != ""
@@ -347,7 +398,7 @@ func (v *Value) Contains(other *Value) bool {
 	baseValue := v.getResolvedValue()
 	switch baseValue.Kind() {
 	case reflect.Struct:
-		fieldValue := baseValue.FieldByName(other.String())
+		fieldValue := fieldByName(baseValue, other.String())
 		return fieldValue.IsValid()
 	case reflect.Map:
 		// We can't check against invalid types
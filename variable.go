@@ -1,6 +1,7 @@
 package pongo2
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -61,21 +62,43 @@ type functionCallArgument interface {
 type stringResolver struct {
 	locationToken *Token
 	val           string
+	value         *Value // of val, shared by all evaluations
 }
 
 type intResolver struct {
 	locationToken *Token
 	val           int
+	value         *Value // of val, shared by all evaluations
 }
 
 type floatResolver struct {
 	locationToken *Token
 	val           float64
+	value         *Value // of val, shared by all evaluations
 }
 
 type boolResolver struct {
 	locationToken *Token
 	val           bool
+	value         *Value // of val, shared by all evaluations
+}
+
+// The Values of literals are created when they're parsed (see sharedValue()).
+
+func newStringResolver(token *Token, val string) *stringResolver {
+	return &stringResolver{locationToken: token, val: val, value: sharedValue(val)}
+}
+
+func newIntResolver(token *Token, val int) *intResolver {
+	return &intResolver{locationToken: token, val: val, value: sharedValue(val)}
+}
+
+func newFloatResolver(token *Token, val float64) *floatResolver {
+	return &floatResolver{locationToken: token, val: val, value: sharedValue(val)}
+}
+
+func newBoolResolver(token *Token, val bool) *boolResolver {
+	return &boolResolver{locationToken: token, val: val, value: sharedValue(val)}
 }
 
 type variableResolver struct {
@@ -94,6 +117,7 @@ type nodeFilteredVariable struct {
 type nodeVariable struct {
 	locationToken *Token
 	expr          IEvaluator
+	escapeContext escapeContext // see Options.ContextualAutoescape
 }
 
 type executionCtxEval struct{}
@@ -189,19 +213,19 @@ func (b *boolResolver) GetPositionToken() *Token {
 }
 
 func (s *stringResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
-	return AsValue(s.val), nil
+	return s.value, nil
 }
 
 func (i *intResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
-	return AsValue(i.val), nil
+	return i.value, nil
 }
 
 func (f *floatResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
-	return AsValue(f.val), nil
+	return f.value, nil
 }
 
 func (b *boolResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
-	return AsValue(b.val), nil
+	return b.value, nil
 }
 
 func (s *stringResolver) FilterApplied(name string) bool {
@@ -229,16 +253,39 @@ func (nv *nodeVariable) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 	if err != nil {
 		return err
 	}
+	return nv.write(ctx, writer, value)
+}
 
-	if !nv.expr.FilterApplied("safe") && !value.safe && value.IsString() && ctx.Autoescape {
-		// apply escape filter
-		value, err = filters["escape"](value, nil)
-		if err != nil {
-			return err
+// write outputs the evaluated expression, escaped as configured.
+func (nv *nodeVariable) write(ctx *ExecutionContext, writer TemplateWriter, value *Value) *Error {
+	if err := checkFormat(ctx, value, formatString); err != nil {
+		return ctx.Error(err, nv.locationToken)
+	}
+	s := value.String()
+	if !nv.expr.FilterApplied("safe") && !value.safe && ctx.Autoescape {
+		_, html := ctx.escaper.(htmlValueEscaper)
+		_, json := ctx.escaper.(jsonValueEscaper)
+		switch {
+		case html && ctx.contextualAutoescape, json && nv.escapeContext.isJSON():
+			if nv.escapeContext.encodesJSON(nv.expr) {
+				if err := checkFormat(ctx, value, formatJSON); err != nil {
+					return ctx.Error(err, nv.locationToken)
+				}
+			}
+			s = nv.escapeContext.escape(nv.expr, value)
+		case html && !value.IsString():
+			// Only strings are escaped as HTML
+		default:
+			if json {
+				if err := checkFormat(ctx, value, formatJSON); err != nil {
+					return ctx.Error(err, nv.locationToken)
+				}
+			}
+			s = ctx.escaper.Escape(value)
 		}
 	}
 
-	if _, err := writer.WriteString(value.String()); err != nil {
+	if _, err := writer.WriteString(s); err != nil {
 		return ctx.Error(err, nv.locationToken)
 	}
 	return nil
@@ -289,8 +336,13 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 		}, nil
 	}
 
+	if value, ok := vr.resolveFast(ctx); ok {
+		return value, nil
+	}
+
 	for idx, part := range vr.parts {
 		currentPresent = false
+		missing := false
 		assumeAttr := false
 		if idx == 0 {
 			// We're looking up the first part of the variable.
@@ -301,6 +353,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 			if !inPrivate {
 				// Nothing found? Then have a final lookup in the public context
 				val, currentPresent = ctx.Public[vr.parts[0].s]
+				missing = !currentPresent
 			}
 
 			current = reflect.ValueOf(val) // Get the initial value
@@ -308,19 +361,70 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 		} else {
 			// Next parts, resolve it from current
 
+			// Types with a TypeResolver or implementing Resolver resolve their
+			// attributes themselves
+			resolved := false
+			fn, hasTypeResolver := ctx.template.set.lookupTypeResolver(current.Type())
+			if !hasTypeResolver && current.Type() == typeOfJSONRawMessage && current.CanInterface() {
+				// Resolved like the decoded document
+				if doc, ok := ctx.state.jsonDocument(current.Interface().(json.RawMessage)); ok {
+					current = reflect.ValueOf(doc)
+				} else {
+					current = reflect.Value{}
+					currentPresent, missing, resolved = false, true, true
+				}
+			}
+			switch {
+			case resolved:
+			case hasTypeResolver && current.CanInterface():
+				var key any
+				switch part.typ {
+				case varTypeIdent:
+					key = part.s
+				case varTypeInt:
+					key = part.i
+				case varTypeSubscript:
+					sv, err := part.subscript.Evaluate(ctx)
+					if err != nil {
+						return nil, err
+					}
+					key = sv.Interface()
+				}
+				if key != nil {
+					val, has := fn(current.Interface(), key)
+					current = reflect.ValueOf(val)
+					currentPresent = has
+					missing = !has
+					resolved = true
+				}
+			case part.typ == varTypeIdent:
+				if r, ok := resolverOf(current); ok {
+					val, has := r.Resolve(part.s)
+					current = reflect.ValueOf(val)
+					currentPresent = has
+					missing = !has
+					resolved = true
+				}
+			}
+
 			// Before resolving the pointer, let's see if we have a method to call
 			// Problem with resolving the pointer is we're changing the receiver
 			isFunc := false
 			funcName := ""
-			if part.typ == varTypeIdent {
+			switch {
+			case resolved:
+			case part.typ == varTypeIdent:
 				funcName = part.s
-			} else if part.typ == varTypeAttr {
+			case part.typ == varTypeAttr:
 				assumeAttr = true
 				funcName = getAttrMethodName
 			}
 			if funcName != "" {
-				funcValue := current.MethodByName(funcName)
+				funcValue := methodByName(current, funcName)
 				if funcValue.IsValid() {
+					if err := vr.checkAttribute(ctx, current.Type(), funcName, true); err != nil {
+						return nil, err
+					}
 					current = funcValue
 					currentPresent = true
 					isFunc = true
@@ -330,13 +434,13 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 				}
 			}
 
-			if !isFunc {
+			if !isFunc && !resolved {
 				// If current a pointer, resolve it
 				if current.Kind() == reflect.Ptr {
 					current = current.Elem()
 					if !current.IsValid() {
 						// Value is not valid (anymore)
-						return AsValue(nil), nil
+						return vr.undefined(ctx, idx, valueNil, nil)
 					}
 				}
 
@@ -352,7 +456,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 							currentPresent = true
 						} else {
 							// In Django, exceeding the length of a list is just empty.
-							return AsValue(nil), nil
+							return vr.undefined(ctx, idx, valueNil, nil)
 						}
 					default:
 						return nil, fmt.Errorf("can't access an index on type %s (variable %s)",
@@ -363,7 +467,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 					// Calling a field or key
 					switch current.Kind() {
 					case reflect.Struct:
-						tryField = current.FieldByName(part.s)
+						tryField = fieldByName(current, part.s)
 					case reflect.Map:
 						tryField = current.MapIndex(reflect.ValueOf(part.s))
 					default:
@@ -371,18 +475,27 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 							current.Kind().String(), vr.String())
 					}
 					if tryField.IsValid() {
+						if current.Kind() == reflect.Struct {
+							if err := vr.checkAttribute(ctx, current.Type(), part.s, false); err != nil {
+								return nil, err
+							}
+						}
 						current = tryField
 					} else {
-						getAttr := current.MethodByName(getAttrMethodName)
+						getAttr := methodByName(current, getAttrMethodName)
 						if !getAttr.IsValid() && current.CanAddr() {
-							getAttr = current.Addr().MethodByName(getAttrMethodName)
+							getAttr = methodByName(current.Addr(), getAttrMethodName)
 						}
 						if getAttr.IsValid() {
+							if err := vr.checkAttribute(ctx, current.Type(), getAttrMethodName, true); err != nil {
+								return nil, err
+							}
 							current = getAttr
 							currentPresent = true
 							assumeAttr = true
 						} else {
 							current = tryField
+							missing = true
 						}
 					}
 				case varTypeSubscript:
@@ -399,7 +512,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 							current = current.Index(si)
 						} else {
 							// In Django, exceeding the length of a list is just empty.
-							return AsValue(nil), nil
+							return vr.undefined(ctx, idx, valueNil, nil)
 						}
 					// Calling a field or key
 					case reflect.Struct:
@@ -407,21 +520,26 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 						if err != nil {
 							return nil, err
 						}
-						current = current.FieldByName(sv.String())
+						if err := vr.checkAttribute(ctx, current.Type(), sv.String(), false); err != nil {
+							return nil, err
+						}
+						current = fieldByName(current, sv.String())
 						currentPresent = true
+						missing = !current.IsValid()
 					case reflect.Map:
 						sv, err := part.subscript.Evaluate(ctx)
 						if err != nil {
 							return nil, err
 						}
 						if sv.IsNil() {
-							return AsValue(nil), nil
+							return vr.undefined(ctx, idx, valueNil, nil)
 						}
 						if sv.val.Type().AssignableTo(current.Type().Key()) {
 							current = current.MapIndex(sv.val)
 							currentPresent = true
+							missing = !current.IsValid()
 						} else {
-							return AsValue(nil), nil
+							return vr.undefined(ctx, idx, valueNil, nil)
 						}
 					default:
 						return nil, fmt.Errorf("can't access an index on type %s (variable %s)",
@@ -435,16 +553,7 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 
 		if !current.IsValid() {
 			// Value is not valid (anymore)
-			if !currentPresent {
-				if ctx.AllowMissingVal {
-					return AsValue(nil), nil
-				}
-
-				return AsValue("NOT FOUND"), fmt.Errorf("No value found for %s", vr)
-			}
-
-			return AsValue(nil), nil
-
+			return vr.invalid(ctx, idx, currentPresent, missing)
 		}
 
 		// If current is a reflect.ValueOf(pongo2.Value), then unpack it
@@ -452,6 +561,10 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 		// into the execution context (e.g. in a for-loop)
 		if current.Type() == typeOfValuePtr {
 			tmpValue := current.Interface().(*Value)
+			if tmpValue.undefined {
+				// Chainable undefined stays undefined
+				return tmpValue, nil
+			}
 			current = tmpValue.val
 			isSafe = tmpValue.safe
 			currentPresent = true
@@ -467,8 +580,11 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 		if part.isFunctionCall || current.Kind() == reflect.Func {
 			// Check for callable
 			if current.Kind() != reflect.Func {
-				getAttr := current.MethodByName(getAttrMethodName)
+				getAttr := methodByName(current, getAttrMethodName)
 				if getAttr.IsValid() {
+					if err := vr.checkAttribute(ctx, current.Type(), getAttrMethodName, true); err != nil {
+						return nil, err
+					}
 					current = getAttr
 					currentPresent = true
 					assumeAttr = true
@@ -648,19 +764,166 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 
 		if !current.IsValid() {
 			// Value is not valid (e. g. NIL value)
-			if !currentPresent {
+			return vr.invalid(ctx, idx, currentPresent, false)
+		}
+	}
+
+	return &Value{val: current, safe: isSafe}, nil
+}
+
+// resolveFast resolves variables which consist of plain lookups in
+// map[string]any and []any values (e. g. decoded JSON) and Resolver
+// implementations without reflection.
+// It returns false if the variable requires the full resolver, which is
+// the case for everything else (structs, methods, function calls, missing
+// keys, nil values, values with a TypeResolver, ...), so the results are
+// always the same.
+func (vr *variableResolver) resolveFast(ctx *ExecutionContext) (*Value, bool) {
+	var current any
+	isSafe := false
+	for idx, part := range vr.parts {
+		if part.isFunctionCall {
+			return nil, false
+		}
 
-				if ctx.AllowMissingVal {
-					return AsValue(nil), nil
+		// Values with a TypeResolver are resolved by the full resolver
+		if idx > 0 {
+			if _, ok := ctx.template.set.lookupTypeResolver(reflect.TypeOf(current)); ok {
+				return nil, false
+			}
+		}
+
+		var has bool
+		switch {
+		case idx == 0:
+			if part.typ != varTypeIdent {
+				return nil, false
+			}
+			if current, has = ctx.Private[part.s]; !has {
+				current, has = ctx.Public[part.s]
+			}
+		case part.typ == varTypeIdent:
+			switch c := current.(type) {
+			case Resolver:
+				if v := reflect.ValueOf(c); v.Kind() == reflect.Ptr && v.IsNil() {
+					return nil, false
 				}
+				current, has = c.Resolve(part.s)
+			case map[string]any:
+				current, has = c[part.s]
+			default:
+				return nil, false
+			}
+		case part.typ == varTypeInt:
+			l, ok := current.([]any)
+			if !ok || part.i < 0 || part.i >= len(l) {
+				return nil, false
+			}
+			current, has = l[part.i], true
+		}
+		if !has || current == nil {
+			return nil, false
+		}
 
-				return AsValue("NOT FOUND"), fmt.Errorf("No value found for %s", vr)
+		// Unpack values injected into the context (e. g. by the for-loop)
+		if v, ok := current.(*Value); ok {
+			if v.undefined || !v.val.IsValid() || !v.val.CanInterface() {
+				return nil, false
+			}
+			current, isSafe = v.val.Interface(), v.safe
+			if current == nil {
+				return nil, false
 			}
-			return AsValue(nil), nil
 		}
 	}
 
-	return &Value{val: current, safe: isSafe}, nil
+	// Functions are called by the full resolver
+	val := reflect.ValueOf(current)
+	if val.Kind() == reflect.Func {
+		return nil, false
+	}
+	return &Value{val: val, safe: isSafe}, true
+}
+
+// invalid handles a part of the variable which resolved to an invalid
+// reflect.Value, either because it's missing (no such key/field) or because
+// it's nil.
+func (vr *variableResolver) invalid(ctx *ExecutionContext, idx int, present, missing bool) (*Value, error) {
+	legacy, legacyErr := valueNil, error(nil)
+	if !present && !ctx.AllowMissingVal {
+		legacy, legacyErr = AsValue("NOT FOUND"), fmt.Errorf("No value found for %s", vr)
+	}
+
+	if missing {
+		return vr.undefined(ctx, idx, legacy, legacyErr)
+	}
+	if idx < len(vr.parts)-1 {
+		// A nil value can't be resolved any further
+		return vr.undefined(ctx, idx+1, legacy, legacyErr)
+	}
+	if ctx.undefinedPolicy == UndefinedDefault {
+		return legacy, legacyErr
+	}
+	return AsValue(nil), nil
+}
+
+// undefined applies the undefined-variable policy for the unresolvable
+// part idx of the variable. UndefinedDefault returns the given legacy
+// result (see UndefinedPolicy). The allowmissingval-tag always makes
+// pongo2 behave like UndefinedLenient.
+func (vr *variableResolver) undefined(ctx *ExecutionContext, idx int, legacy *Value, legacyErr error) (*Value, error) {
+	policy := ctx.undefinedPolicy
+	if ctx.AllowMissingVal && policy != UndefinedChainable {
+		policy = UndefinedLenient
+	}
+
+	switch policy {
+	case UndefinedStrict:
+		parts := make([]string, 0, idx+1)
+		for _, p := range vr.parts[:idx+1] {
+			parts = append(parts, p.String())
+		}
+		return nil, &Error{
+			Sender:    "execution",
+			Kind:      ErrorKindMissingVariable,
+			OrigError: fmt.Errorf("variable '%s' is undefined ('%s' can't be resolved)", vr, strings.Join(parts, ".")),
+		}
+	case UndefinedLenient:
+		return valueNil, nil
+	case UndefinedChainable:
+		return &Value{undefined: true}, nil
+	default:
+		return legacy, legacyErr
+	}
+}
+
+// evaluateDefined evaluates expr without failing on unresolvable variables
+// (whatever the UndefinedPolicy is) and reports whether it's defined; if it
+// isn't, the value is nil. It's used where undefined variables are handled
+// by the template: the default and default_if_none filters and the "is
+// defined" test.
+func evaluateDefined(ctx *ExecutionContext, expr IEvaluator) (*Value, bool, *Error) {
+	policy, allowMissingVal := ctx.undefinedPolicy, ctx.AllowMissingVal
+	ctx.undefinedPolicy, ctx.AllowMissingVal = UndefinedChainable, true
+	value, err := expr.Evaluate(ctx)
+	ctx.undefinedPolicy, ctx.AllowMissingVal = policy, allowMissingVal
+	if err != nil {
+		return nil, false, err
+	}
+	if value.IsUndefined() {
+		return AsValue(nil), false, nil
+	}
+	return value, true, nil
+}
+
+// checkAttribute enforces the set's AttributePolicy (if any) on the access of
+// the field or method name on a value of type t.
+func (vr *variableResolver) checkAttribute(ctx *ExecutionContext, t reflect.Type, name string, isMethod bool) error {
+	policy := ctx.template.set.AttributePolicy
+	if policy == nil || policy(t, name, isMethod) {
+		return nil
+	}
+	return attributeError(t, name, isMethod, "variable "+vr.String())
 }
 
 func (vr *variableResolver) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
@@ -680,8 +943,20 @@ func (v *nodeFilteredVariable) FilterApplied(name string) bool {
 	return false
 }
 
+// handlesUndefined reports whether the filters handle undefined variables
+// (the default and default_if_none filters).
+func (v *nodeFilteredVariable) handlesUndefined() bool {
+	return len(v.filterChain) > 0 && (v.filterChain[0].name == "default" || v.filterChain[0].name == "default_if_none")
+}
+
 func (v *nodeFilteredVariable) Evaluate(ctx *ExecutionContext) (*Value, *Error) {
-	value, err := v.resolver.Evaluate(ctx)
+	var value *Value
+	var err *Error
+	if v.handlesUndefined() {
+		value, _, err = evaluateDefined(ctx, v.resolver)
+	} else {
+		value, err = v.resolver.Evaluate(ctx)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -767,43 +1042,23 @@ func (p *Parser) parseVariableOrLiteral() (IEvaluator, *Error) {
 			if err != nil {
 				return nil, p.Error(err, t)
 			}
-			fr := &floatResolver{
-				locationToken: t,
-				val:           f,
-			}
-			return fr, nil
+			return newFloatResolver(t, f), nil
 		}
 		i, err := strconv.Atoi(t.Val)
 		if err != nil {
 			return nil, p.Error(err, t)
 		}
-		nr := &intResolver{
-			locationToken: t,
-			val:           i,
-		}
-		return nr, nil
+		return newIntResolver(t, i), nil
 	case TokenString:
 		p.Consume()
-		sr := &stringResolver{
-			locationToken: t,
-			val:           t.Val,
-		}
-		return sr, nil
+		return newStringResolver(t, t.Val), nil
 	case TokenKeyword:
 		p.Consume()
 		switch t.Val {
 		case "true":
-			br := &boolResolver{
-				locationToken: t,
-				val:           true,
-			}
-			return br, nil
+			return newBoolResolver(t, true), nil
 		case "false":
-			br := &boolResolver{
-				locationToken: t,
-				val:           false,
-			}
-			return br, nil
+			return newBoolResolver(t, false), nil
 		default:
 			return nil, p.Error(fmt.Errorf("This keyword is not allowed here."), nil)
 
@@ -952,6 +1207,8 @@ variableLoop:
 			if p.Match(TokenSymbol, "]") == nil {
 				return nil, p.Error(fmt.Errorf("Missing closing bracket after subscript argument."), nil)
 			}
+			// Subscripts can be followed by further parts (e. g. a.b[0].c)
+			continue variableLoop
 
 		} else if p.Match(TokenSymbol, "(") != nil {
 			// Function call
@@ -1021,8 +1278,8 @@ filterLoop:
 		}
 
 		// Check sandbox filter restriction
-		if _, isBanned := p.template.set.bannedFilters[filter.name]; isBanned {
-			return nil, p.Error(fmt.Errorf("Usage of filter '%s' is not allowed (sandbox restriction active).", filter.name), nil)
+		if !p.template.set.filterAllowed(filter.name) {
+			return nil, p.sandboxError(fmt.Errorf("Usage of filter '%s' is not allowed (sandbox restriction active).", filter.name), nil)
 		}
 
 		v.filterChain = append(v.filterChain, filter)
@@ -1039,6 +1296,7 @@ func (p *Parser) parseVariableElement() (INode, *Error) {
 	}
 
 	p.Consume() // consume '{{'
+	p.template.variables = append(p.template.variables, node)
 
 	expr, err := p.ParseExpression()
 	if err != nil {